@@ -1,11 +1,13 @@
 package config
 
 import (
-	"os"
 	"bufio"
-	"strings"
-	"path/filepath"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -20,12 +22,32 @@ type Config struct {
 	ServerPort string
 	ServerHost string
 	Env        string
+
+	// Market settings, all optional
+	MarketMaxSlippagePct   float64       // default slippage for market orders that do not set one
+	OrderExpiryInterval    time.Duration // how often good-till-date orders are checked for expiry
+	DefaultSTPMode         string        // self-trade prevention for accounts and orders that do not choose one
+	MatchingAlgorithm      string        // how fills are shared out within a price level: fifo, pro_rata or pro_rata_top
+	LotSizeMWh             float64       // order amounts and fills are whole multiples of the lot size
+	AuctionGateClosure     time.Duration // day-ahead gate closure, as an offset from midnight UTC the day before delivery
+	AuctionInterval        time.Duration // how often auctions are opened and cleared
+	ProductGateClosure     time.Duration // how long before the start of delivery a product stops trading
+	ProductInterval        time.Duration // how often products are listed and closed
+	DefaultZone            string        // bidding zone of users who do not choose one when registering
+	PriceIndexInterval     time.Duration // how often the reference price is published into price_per_mwh
+	PriceIndexWindow       time.Duration // how far back the trades of the reference price go
+	PriceIndexFallback     float64       // reference price while nothing has traded or been published
+	PriceBandPct           float64       // orders priced further than this from the last trade or reference price are rejected, 0 turns bands off
+	CircuitBreakerPct      float64       // trades moving the price further than this within the window halt the product, 0 turns the breaker off
+	CircuitBreakerWindow   time.Duration // how far back the circuit breaker looks for the price a move is measured from
+	CircuitBreakerCooldown time.Duration // how long a product stays halted after its circuit breaker tripped
+	SessionInterval        time.Duration // how often orders queued before the open are checked for matching
 }
 
 func LoadConfig() *Config {
 	// Load .env file first
 	loadEnvFile()
-	
+
 	config := &Config{
 		DBHost:     getRequiredEnv("DB_HOST"),
 		DBPort:     getRequiredEnv("DB_PORT"),
@@ -37,16 +59,38 @@ func LoadConfig() *Config {
 		ServerPort: getRequiredEnv("SERVER_PORT"),
 		ServerHost: getRequiredEnv("SERVER_HOST"),
 		Env:        getRequiredEnv("ENV"),
+
+		MarketMaxSlippagePct:   getEnvFloat("MARKET_MAX_SLIPPAGE_PCT", 5),
+		OrderExpiryInterval:    getEnvDuration("ORDER_EXPIRY_INTERVAL", 30*time.Second),
+		DefaultSTPMode:         getEnvChoice("DEFAULT_STP_MODE", "cancel_newest", "cancel_newest", "cancel_oldest", "cancel_both", "decrement_and_cancel"),
+		MatchingAlgorithm:      getEnvChoice("MATCHING_ALGORITHM", "fifo", "fifo", "pro_rata", "pro_rata_top"),
+		LotSizeMWh:             getEnvFloat("LOT_SIZE_MWH", 0.000001),
+		AuctionGateClosure:     getEnvDuration("AUCTION_GATE_CLOSURE", 12*time.Hour),
+		AuctionInterval:        getEnvDuration("AUCTION_INTERVAL", time.Minute),
+		ProductGateClosure:     getEnvDuration("PRODUCT_GATE_CLOSURE", time.Hour),
+		ProductInterval:        getEnvDuration("PRODUCT_INTERVAL", time.Minute),
+		DefaultZone:            getEnv("DEFAULT_ZONE", "BG"),
+		PriceIndexInterval:     getEnvDuration("PRICE_INDEX_INTERVAL", 15*time.Minute),
+		PriceIndexWindow:       getEnvDuration("PRICE_INDEX_WINDOW", time.Hour),
+		PriceIndexFallback:     getEnvFloat("PRICE_INDEX_FALLBACK", 100),
+		PriceBandPct:           getEnvFloat("PRICE_BAND_PCT", 50),
+		CircuitBreakerPct:      getEnvFloat("CIRCUIT_BREAKER_PCT", 10),
+		CircuitBreakerWindow:   getEnvDuration("CIRCUIT_BREAKER_WINDOW", 5*time.Minute),
+		CircuitBreakerCooldown: getEnvDuration("CIRCUIT_BREAKER_COOLDOWN", 5*time.Minute),
+		SessionInterval:        getEnvDuration("SESSION_INTERVAL", 10*time.Second),
+	}
+	if config.LotSizeMWh <= 0 {
+		panic("Environment variable LOT_SIZE_MWH must be greater than zero")
 	}
-	
+
 	// Construct database connection string
-	config.DBConnStr = "host=" + config.DBHost + 
-		" port=" + config.DBPort + 
-		" user=" + config.DBUser + 
-		" password=" + config.DBPassword + 
-		" dbname=" + config.DBName + 
+	config.DBConnStr = "host=" + config.DBHost +
+		" port=" + config.DBPort +
+		" user=" + config.DBUser +
+		" password=" + config.DBPassword +
+		" dbname=" + config.DBName +
 		" sslmode=" + config.DBSSLMode
-	
+
 	return config
 }
 
@@ -59,38 +103,36 @@ func loadEnvFile() {
 		}
 		envPath = filepath.Join("..", envPath)
 	}
-	
+
 	file, err := os.Open(envPath)
 	if err != nil {
 		return // .env file not found, use system environment variables
 	}
 	defer file.Close()
-	
+
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		
+
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) == 2 {
 			key := strings.TrimSpace(parts[0])
 			value := strings.TrimSpace(parts[1])
-			
+
 			// Remove quotes if present
 			if len(value) > 1 && (value[0] == '"' || value[0] == '\'') {
 				value = value[1 : len(value)-1]
 			}
-			
+
 			// Set environment variable
 			os.Setenv(key, value)
 		}
 	}
 }
 
-
-
 func getRequiredEnv(key string) string {
 	val := os.Getenv(key)
 	if val == "" {
@@ -98,3 +140,44 @@ func getRequiredEnv(key string) string {
 	}
 	return val
 }
+
+func getEnv(key, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
+}
+
+func getEnvChoice(key, fallback string, choices ...string) string {
+	val := getEnv(key, fallback)
+	for _, choice := range choices {
+		if val == choice {
+			return val
+		}
+	}
+	panic(fmt.Sprintf("Environment variable %s must be one of %s, got %q", key, strings.Join(choices, ", "), val))
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		panic(fmt.Sprintf("Environment variable %s must be a number, got %q", key, val))
+	}
+	return f
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		panic(fmt.Sprintf("Environment variable %s must be a duration such as 30s, got %q", key, val))
+	}
+	return d
+}
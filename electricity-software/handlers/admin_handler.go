@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"my-go-project/models"
+	"my-go-project/services"
+)
+
+type AdminHandler struct {
+	orderService *services.OrderService
+}
+
+func NewAdminHandler(orderService *services.OrderService) *AdminHandler {
+	return &AdminHandler{orderService: orderService}
+}
+
+// HaltTrading handles POST /admin/halts
+func (h *AdminHandler) HaltTrading(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req models.HaltRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	halt, err := h.orderService.HaltTrading(userID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, halt)
+}
+
+// SetMatchingAlgorithm handles PUT /admin/products/:id/matching-algorithm
+func (h *AdminHandler) SetMatchingAlgorithm(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var req models.MatchingAlgorithmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.orderService.GetProductByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+
+	product, err := h.orderService.SetProductMatchingAlgorithm(id, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// ResumeTrading handles POST /admin/halts/:id/resume
+func (h *AdminHandler) ResumeTrading(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid halt id"})
+		return
+	}
+
+	halt, err := h.orderService.ResumeTrading(userID, id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, halt)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"my-go-project/models"
+	"my-go-project/services"
+)
+
+type AuctionHandler struct {
+	orderService *services.OrderService
+}
+
+func NewAuctionHandler(orderService *services.OrderService) *AuctionHandler {
+	return &AuctionHandler{orderService: orderService}
+}
+
+// GetAuctions handles GET /auctions
+func (h *AuctionHandler) GetAuctions(c *gin.Context) {
+	var filter models.AuctionFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	auctions, err := h.orderService.GetAuctions(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, auctions)
+}
+
+// GetAuction handles GET /auctions/:id
+func (h *AuctionHandler) GetAuction(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid auction id"})
+		return
+	}
+
+	auction, err := h.orderService.GetAuctionByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "auction not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, auction)
+}
+
+// GetAuctionResults handles GET /auctions/:id/results
+func (h *AuctionHandler) GetAuctionResults(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid auction id"})
+		return
+	}
+
+	auction, err := h.orderService.GetAuctionByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "auction not found"})
+		return
+	}
+
+	results, flows, err := h.orderService.GetAuctionResults(auction)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"auction": auction, "results": results, "flows": flows})
+}
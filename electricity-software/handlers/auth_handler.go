@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"my-go-project/models"
 	"my-go-project/services"
 
 	"github.com/dgrijalva/jwt-go"
@@ -22,6 +23,8 @@ type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
+	// Code of the user's bidding zone, DEFAULT_ZONE when empty
+	Zone string `json:"zone"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -31,7 +34,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	id, err := h.authService.Register(req.Name, req.Email, req.Password)
+	id, err := h.authService.Register(req.Name, req.Email, req.Password, req.Zone)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -84,21 +87,62 @@ func (h *AuthHandler) Profile(c *gin.Context) {
 		return
 	}
 
-	energy, err := h.authService.GetUserEnergy(id)
+	balance, err := h.authService.GetUserBalance(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get energy"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get balance"})
 		return
 	}
 
-	money, err := h.authService.GetUserMoney(id)
+	user, err := h.authService.GetUser(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get money"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return
+	}
+
+	zone, err := h.authService.GetBiddingZone(user.ZoneID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get bidding zone"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"user_id":    id,
-		"energy_mwh": energy,
-		"money_eur":  money,
+		"user_id":       id,
+		"stp_mode":      user.STPMode,
+		"zone":          zone,
+		"is_admin":      user.IsAdmin,
+		"energy_mwh":    balance.EnergyMWh,
+		"reserved_mwh":  balance.ReservedMWh,
+		"available_mwh": balance.AvailableMWh,
+		"money_eur":     balance.MoneyEur,
+		"reserved_eur":  balance.ReservedEur,
+		"available_eur": balance.AvailableEur,
 	})
 }
+
+type STPModeRequest struct {
+	// Empty resets the account to the server default
+	STPMode models.STPMode `json:"stp_mode" binding:"omitempty,oneof=cancel_newest cancel_oldest cancel_both decrement_and_cancel"`
+}
+
+// SetSTPMode handles PUT /auth/stp-mode
+func (h *AuthHandler) SetSTPMode(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req STPModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var mode *models.STPMode
+	if req.STPMode != "" {
+		mode = &req.STPMode
+	}
+
+	if err := h.authService.SetSTPMode(userID, mode); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update stp mode"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"stp_mode": mode})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"my-go-project/models"
+	"my-go-project/services"
+)
+
+type MarketHandler struct {
+	orderService *services.OrderService
+}
+
+func NewMarketHandler(orderService *services.OrderService) *MarketHandler {
+	return &MarketHandler{orderService: orderService}
+}
+
+// GetDepth handles GET /market/depth
+func (h *MarketHandler) GetDepth(c *gin.Context) {
+	var filter models.DepthFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.productExists(c, filter.ProductID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, h.orderService.GetMarketDepth(filter))
+}
+
+// GetCandles handles GET /market/candles
+func (h *MarketHandler) GetCandles(c *gin.Context) {
+	var filter models.CandleFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.productExists(c, filter.ProductID) {
+		return
+	}
+
+	candles, err := h.orderService.GetCandles(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, candles)
+}
+
+// GetTicker handles GET /market/ticker
+func (h *MarketHandler) GetTicker(c *gin.Context) {
+	var filter models.TickerFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.productExists(c, filter.ProductID) {
+		return
+	}
+
+	ticker, err := h.orderService.GetTicker(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ticker)
+}
+
+// GetLimits handles GET /market/limits
+func (h *MarketHandler) GetLimits(c *gin.Context) {
+	var filter models.PriceLimitsFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.productExists(c, filter.ProductID) {
+		return
+	}
+
+	limits, err := h.orderService.GetPriceLimits(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, limits)
+}
+
+// GetHalts handles GET /market/halts
+func (h *MarketHandler) GetHalts(c *gin.Context) {
+	halts, err := h.orderService.GetActiveHalts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, halts)
+}
+
+// GetStatus handles GET /market/status
+func (h *MarketHandler) GetStatus(c *gin.Context) {
+	var filter models.MarketStatusFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.productExists(c, filter.ProductID) {
+		return
+	}
+
+	status, err := h.orderService.GetMarketStatus(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// GetCalendar handles GET /market/calendar
+func (h *MarketHandler) GetCalendar(c *gin.Context) {
+	calendar, err := h.orderService.GetMarketCalendar()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+// productExists answers 404 and reports false when productID is set but
+// there is no such product. Zero stands for the undated market.
+func (h *MarketHandler) productExists(c *gin.Context, productID int) bool {
+	if productID == 0 {
+		return true
+	}
+	if _, err := h.orderService.GetProductByID(productID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return false
+	}
+	return true
+}
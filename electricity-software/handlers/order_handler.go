@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 
@@ -36,6 +37,45 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	c.JSON(http.StatusCreated, order)
 }
 
+// CreateOrders handles POST /orders/batch
+func (h *OrderHandler) CreateOrders(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var req models.BatchOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.orderService.CreateOrders(userID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"results": results})
+}
+
+// CancelAllOrders handles POST /orders/cancel-all
+func (h *OrderHandler) CancelAllOrders(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	// The filters are optional, an empty body cancels everything
+	var req models.CancelAllRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, err := h.orderService.CancelAllOrders(userID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"canceled": len(orders), "orders": orders})
+}
+
 // GetOrders handles GET /orders
 func (h *OrderHandler) GetOrders(c *gin.Context) {
 	userID := c.GetInt("userID")
@@ -90,8 +130,12 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 	}
 
 	// Check if user owns the order or if it's a public sell order
-	if order.UserID != userID && order.OrderType != models.OrderTypeSell {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+	if order.UserID != userID {
+		if order.OrderType != models.OrderTypeSell {
+			c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.JSON(http.StatusOK, order.Public())
 		return
 	}
 
@@ -115,16 +159,16 @@ func (h *OrderHandler) UpdateOrder(c *gin.Context) {
 		return
 	}
 
-	err = h.orderService.UpdateOrder(id, userID, req)
+	order, err := h.orderService.UpdateOrder(id, userID, req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "order updated successfully"})
+	c.JSON(http.StatusOK, order)
 }
 
-// DeleteOrder handles DELETE /orders/:id
+// DeleteOrder handles DELETE /orders/:id, the order is canceled rather than removed
 func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 	userID := c.GetInt("userID")
 	idStr := c.Param("id")
@@ -135,13 +179,13 @@ func (h *OrderHandler) DeleteOrder(c *gin.Context) {
 		return
 	}
 
-	err = h.orderService.DeleteOrder(id, userID)
+	err = h.orderService.CancelOrder(id, userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "order deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "order canceled successfully"})
 }
 
 // GetTransactions handles GET /transactions
@@ -157,18 +201,51 @@ func (h *OrderHandler) GetTransactions(c *gin.Context) {
 	c.JSON(http.StatusOK, transactions)
 }
 
+// GetTrades handles GET /trades (public endpoint with the executed trades)
+func (h *OrderHandler) GetTrades(c *gin.Context) {
+	var filter models.TradeFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trades, err := h.orderService.GetTrades(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, trades)
+}
+
+// GetMyTrades handles GET /trades/mine
+func (h *OrderHandler) GetMyTrades(c *gin.Context) {
+	userID := c.GetInt("userID")
+
+	var filter models.TradeFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trades, err := h.orderService.GetTradesByUser(userID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, trades)
+}
+
 // GetBalance handles GET /balance
 func (h *OrderHandler) GetBalance(c *gin.Context) {
 	userID := c.GetInt("userID")
 
-	money, energy, err := h.orderService.GetUserBalance(userID)
+	balance, err := h.orderService.GetUserBalance(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"money_eur":  money,
-		"energy_mwh": energy,
-	})
-} 
\ No newline at end of file
+	c.JSON(http.StatusOK, balance)
+}
\ No newline at end of file
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"my-go-project/models"
+	"my-go-project/services"
+)
+
+type PriceHandler struct {
+	orderService *services.OrderService
+}
+
+func NewPriceHandler(orderService *services.OrderService) *PriceHandler {
+	return &PriceHandler{orderService: orderService}
+}
+
+// GetCurrentPrice handles GET /prices/current
+func (h *PriceHandler) GetCurrentPrice(c *gin.Context) {
+	price, err := h.orderService.GetCurrentPrice()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, price)
+}
+
+// GetPriceHistory handles GET /prices/history
+func (h *PriceHandler) GetPriceHistory(c *gin.Context) {
+	var filter models.PriceHistoryFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prices, err := h.orderService.GetPriceHistory(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, prices)
+}
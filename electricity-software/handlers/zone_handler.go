@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"my-go-project/models"
+	"my-go-project/services"
+)
+
+type ZoneHandler struct {
+	orderService *services.OrderService
+}
+
+func NewZoneHandler(orderService *services.OrderService) *ZoneHandler {
+	return &ZoneHandler{orderService: orderService}
+}
+
+// GetZones handles GET /zones
+func (h *ZoneHandler) GetZones(c *gin.Context) {
+	var filter models.ZoneFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	zones, err := h.orderService.GetZonePrices(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, zones)
+}
+
+// GetCapacities handles GET /zones/capacities
+func (h *ZoneHandler) GetCapacities(c *gin.Context) {
+	var filter models.ZoneFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	capacities, err := h.orderService.GetTransmissionCapacities(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, capacities)
+}
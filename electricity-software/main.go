@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -62,6 +63,19 @@ func AuthMiddleware(jwtSecret []byte) gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware lets only operators through. It must run after
+// AuthMiddleware.
+func AdminMiddleware(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := authService.GetUser(c.GetInt("userID"))
+		if err != nil || !user.IsAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
 func main() {
 	// Load configuration from environment variables
 	cfg := config.LoadConfig()
@@ -74,11 +88,25 @@ func main() {
 
 	userRepo := repositories.NewUserRepository(db)
 	orderRepo := repositories.NewOrderRepository(db)
-	authService := services.NewAuthService(userRepo)
-	orderService := services.NewOrderService(orderRepo)
+	authService := services.NewAuthService(userRepo, cfg.DefaultZone)
+	orderService := services.NewOrderService(orderRepo, db, cfg)
+	if err := orderService.LoadOrderBook(); err != nil {
+		log.Fatalf("Failed to load order book: %v", err)
+	}
+	go orderService.RunExpiryWorker(context.Background(), cfg.OrderExpiryInterval)
+	go orderService.RunAuctionWorker(context.Background(), cfg.AuctionInterval)
+	go orderService.RunProductWorker(context.Background(), cfg.ProductInterval)
+	go orderService.RunPriceIndexWorker(context.Background(), cfg.PriceIndexInterval)
+	go orderService.RunSessionWorker(context.Background(), cfg.SessionInterval)
 	jwtSecret := []byte(cfg.JWTSecret)
 	authHandler := handlers.NewAuthHandler(authService, jwtSecret)
 	orderHandler := handlers.NewOrderHandler(orderService)
+	auctionHandler := handlers.NewAuctionHandler(orderService)
+	productHandler := handlers.NewProductHandler(orderService)
+	zoneHandler := handlers.NewZoneHandler(orderService)
+	marketHandler := handlers.NewMarketHandler(orderService)
+	priceHandler := handlers.NewPriceHandler(orderService)
+	adminHandler := handlers.NewAdminHandler(orderService)
 
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
@@ -93,11 +121,29 @@ func main() {
 
 	// Public endpoints
 	r.GET("/orders/sell", orderHandler.GetSellOrders)
+	r.GET("/trades", orderHandler.GetTrades)
+	r.GET("/market/depth", marketHandler.GetDepth)
+	r.GET("/market/candles", marketHandler.GetCandles)
+	r.GET("/market/ticker", marketHandler.GetTicker)
+	r.GET("/market/limits", marketHandler.GetLimits)
+	r.GET("/market/halts", marketHandler.GetHalts)
+	r.GET("/market/status", marketHandler.GetStatus)
+	r.GET("/market/calendar", marketHandler.GetCalendar)
+	r.GET("/prices/current", priceHandler.GetCurrentPrice)
+	r.GET("/prices/history", priceHandler.GetPriceHistory)
+	r.GET("/products", productHandler.GetProducts)
+	r.GET("/products/:id", productHandler.GetProduct)
+	r.GET("/zones", zoneHandler.GetZones)
+	r.GET("/zones/capacities", zoneHandler.GetCapacities)
+	r.GET("/auctions", auctionHandler.GetAuctions)
+	r.GET("/auctions/:id", auctionHandler.GetAuction)
+	r.GET("/auctions/:id/results", auctionHandler.GetAuctionResults)
 
 	auth := r.Group("/auth")
 	auth.Use(AuthMiddleware(jwtSecret))
 	{
 		auth.GET("/profile", authHandler.Profile)
+		auth.PUT("/stp-mode", authHandler.SetSTPMode)
 	}
 
 	// Protected order endpoints
@@ -106,6 +152,8 @@ func main() {
 	{
 		orders.GET("", orderHandler.GetOrders)
 		orders.POST("", orderHandler.CreateOrder)
+		orders.POST("/batch", orderHandler.CreateOrders)
+		orders.POST("/cancel-all", orderHandler.CancelAllOrders)
 		orders.GET("/:id", orderHandler.GetOrder)
 		orders.PUT("/:id", orderHandler.UpdateOrder)
 		orders.DELETE("/:id", orderHandler.DeleteOrder)
@@ -117,6 +165,16 @@ func main() {
 	{
 		protected.GET("/transactions", orderHandler.GetTransactions)
 		protected.GET("/balance", orderHandler.GetBalance)
+		protected.GET("/trades/mine", orderHandler.GetMyTrades)
+	}
+
+	// Operator endpoints
+	admin := r.Group("/admin")
+	admin.Use(AuthMiddleware(jwtSecret), AdminMiddleware(authService))
+	{
+		admin.POST("/halts", adminHandler.HaltTrading)
+		admin.POST("/halts/:id/resume", adminHandler.ResumeTrading)
+		admin.PUT("/products/:id/matching-algorithm", adminHandler.SetMatchingAlgorithm)
 	}
 
 	serverAddr := cfg.ServerHost + ":" + cfg.ServerPort
@@ -0,0 +1,20 @@
+-- Funds and energy held by open orders
+-- money_eur / energy_mwh stay the total balance, available = total - reserved
+
+ALTER TABLE user_money ADD COLUMN IF NOT EXISTS reserved_eur NUMERIC(15,6) NOT NULL DEFAULT 0; -- held by open buy orders
+ALTER TABLE user_energy ADD COLUMN IF NOT EXISTS reserved_mwh NUMERIC(15,6) NOT NULL DEFAULT 0; -- held by open sell orders
+
+-- Take the holds for orders that were already resting before this migration
+UPDATE user_money m
+SET reserved_eur = COALESCE((
+    SELECT SUM(o.amount_mwh * o.price_eur_per_mwh)
+    FROM orders o
+    WHERE o.user_id = m.user_id AND o.order_type = 'buy' AND o.status = 'open'
+), 0);
+
+UPDATE user_energy e
+SET reserved_mwh = COALESCE((
+    SELECT SUM(o.amount_mwh)
+    FROM orders o
+    WHERE o.user_id = e.user_id AND o.order_type = 'sell' AND o.status = 'open'
+), 0);
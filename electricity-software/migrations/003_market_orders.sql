@@ -0,0 +1,5 @@
+-- Market orders: swept against the book up to a protection price, never rest
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS order_kind VARCHAR(20) NOT NULL DEFAULT 'limit'; -- limit, market
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS max_slippage_pct NUMERIC(6,3); -- market orders: max distance from the best opposite price
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS max_notional_eur NUMERIC(15,2); -- market orders: cap on the total value traded
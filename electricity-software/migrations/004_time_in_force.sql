@@ -0,0 +1,8 @@
+-- Time in force: gtc (good till cancel), ioc (immediate or cancel),
+-- fok (fill or kill) and gtd (good till date, expires at expires_at)
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS time_in_force VARCHAR(10) NOT NULL DEFAULT 'gtc';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE; -- gtd orders only
+
+-- Used by the expiry worker to find open gtd orders past their expiry
+CREATE INDEX IF NOT EXISTS idx_orders_expires_at ON orders(expires_at) WHERE status = 'open';
@@ -0,0 +1,7 @@
+-- Stop and stop-limit orders wait in the pending status, outside the book,
+-- until the last trade price reaches their stop price
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stop_price_eur_per_mwh NUMERIC(10,2);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS triggered_at TIMESTAMP WITH TIME ZONE; -- when a stop order was converted into a market/limit order
+
+CREATE INDEX IF NOT EXISTS idx_orders_pending_stops ON orders(stop_price_eur_per_mwh) WHERE status = 'pending';
@@ -0,0 +1,11 @@
+-- Iceberg orders show only display_amount_mwh at a time, visible_amount_mwh
+-- is what is left of the current tranche. priority_at is the time priority
+-- of an order in its price level, reset whenever a new tranche is shown.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS display_amount_mwh NUMERIC(15,6);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS visible_amount_mwh NUMERIC(15,6);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS priority_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE orders SET priority_at = created_at WHERE priority_at IS NULL;
+ALTER TABLE orders ALTER COLUMN priority_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE orders ALTER COLUMN priority_at SET NOT NULL;
@@ -0,0 +1,8 @@
+-- Self-trade prevention: what happens when an order would trade against an
+-- order of the same user. Modes: cancel_newest, cancel_oldest, cancel_both,
+-- decrement_and_cancel
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS stp_mode VARCHAR(30); -- account default, NULL uses the server default
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stp_mode VARCHAR(30); -- mode the order was placed with
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS stp_action VARCHAR(30); -- mode that canceled or decremented the order, if any
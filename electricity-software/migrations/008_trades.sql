@@ -0,0 +1,21 @@
+-- One row per fill, linking the buy and the sell side. The two transactions
+-- rows written for a fill reference it through trade_id.
+
+CREATE TABLE IF NOT EXISTS trades (
+    id SERIAL PRIMARY KEY,
+    buy_order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+    sell_order_id INT REFERENCES orders(id) ON DELETE SET NULL,
+    buyer_id INT REFERENCES users(id) ON DELETE SET NULL,
+    seller_id INT REFERENCES users(id) ON DELETE SET NULL,
+    aggressor_side order_type NOT NULL, -- side of the incoming order that took liquidity
+    amount_mwh NUMERIC(15,6) NOT NULL,
+    price_eur_per_mwh NUMERIC(10,2) NOT NULL,
+    total_eur NUMERIC(15,2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS trade_id INT REFERENCES trades(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_trades_created_at ON trades(created_at);
+CREATE INDEX IF NOT EXISTS idx_trades_buyer_id ON trades(buyer_id);
+CREATE INDEX IF NOT EXISTS idx_trades_seller_id ON trades(seller_id);
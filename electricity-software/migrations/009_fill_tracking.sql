@@ -0,0 +1,39 @@
+-- Orders keep their original size next to what has traded and what is left.
+-- amount_mwh stays the remaining amount and reaches 0 once an order is
+-- completed, filled_amount_mwh and avg_fill_price follow every fill.
+-- Orders with fills that still rest on the book are 'partially_filled'.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS original_amount_mwh NUMERIC(15,6);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS filled_amount_mwh NUMERIC(15,6) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS avg_fill_price NUMERIC(12,4);
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_amount_mwh_check;
+ALTER TABLE orders ADD CONSTRAINT orders_amount_mwh_check CHECK (amount_mwh >= 0);
+
+-- Backfill from the fills recorded so far. Completed orders used to keep the
+-- amount of their last fill in amount_mwh.
+UPDATE orders o
+SET filled_amount_mwh = t.filled_mwh,
+    avg_fill_price = t.total_eur / t.filled_mwh
+FROM (
+    SELECT order_id, SUM(amount_mwh) AS filled_mwh, SUM(total_eur) AS total_eur
+    FROM transactions
+    WHERE order_id IS NOT NULL
+    GROUP BY order_id
+) t
+WHERE o.id = t.order_id AND o.original_amount_mwh IS NULL;
+
+UPDATE orders
+SET original_amount_mwh = CASE
+        WHEN status = 'completed' AND filled_amount_mwh > 0 THEN filled_amount_mwh
+        ELSE amount_mwh + filled_amount_mwh
+    END,
+    amount_mwh = CASE
+        WHEN status = 'completed' AND filled_amount_mwh > 0 THEN 0
+        ELSE amount_mwh
+    END
+WHERE original_amount_mwh IS NULL;
+
+UPDATE orders SET status = 'partially_filled' WHERE status = 'open' AND filled_amount_mwh > 0;
+
+ALTER TABLE orders ALTER COLUMN original_amount_mwh SET NOT NULL;
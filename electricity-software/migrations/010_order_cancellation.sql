@@ -0,0 +1,23 @@
+-- Orders are canceled instead of deleted. canceled_at and cancel_reason
+-- record when and why, reasons: user_canceled, immediate_or_cancel,
+-- fill_or_kill, self_trade_prevention
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS canceled_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancel_reason VARCHAR(30);
+
+UPDATE orders SET canceled_at = updated_at WHERE status = 'canceled' AND canceled_at IS NULL;
+UPDATE orders SET cancel_reason = 'self_trade_prevention' WHERE status = 'canceled' AND stp_action IS NOT NULL AND cancel_reason IS NULL;
+UPDATE orders SET cancel_reason = 'fill_or_kill' WHERE status = 'canceled' AND time_in_force = 'fok' AND cancel_reason IS NULL;
+UPDATE orders SET cancel_reason = 'immediate_or_cancel' WHERE status = 'canceled' AND cancel_reason IS NULL;
+
+-- An order with fills must never be removed, its transactions and trades
+-- refer to it
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_order_id_fkey;
+ALTER TABLE transactions ADD CONSTRAINT transactions_order_id_fkey FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE RESTRICT;
+
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_buy_order_id_fkey;
+ALTER TABLE trades ADD CONSTRAINT trades_buy_order_id_fkey FOREIGN KEY (buy_order_id) REFERENCES orders(id) ON DELETE RESTRICT;
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_sell_order_id_fkey;
+ALTER TABLE trades ADD CONSTRAINT trades_sell_order_id_fkey FOREIGN KEY (sell_order_id) REFERENCES orders(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS idx_orders_user_status ON orders(user_id, status);
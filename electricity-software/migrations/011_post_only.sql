@@ -0,0 +1,5 @@
+-- Post-only orders only ever add liquidity. post_only_reprice moves a
+-- crossing price one tick away from the opposite side instead of rejecting it.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS post_only BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS post_only_reprice BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,36 @@
+-- Day-ahead call auctions. Orders for the hourly delivery periods of a day
+-- are collected until gate closure, then every period clears at a single
+-- price and the accepted orders settle at that price.
+
+CREATE TABLE IF NOT EXISTS auctions (
+    id SERIAL PRIMARY KEY,
+    delivery_date DATE NOT NULL UNIQUE,
+    periods INT NOT NULL DEFAULT 24, -- delivery periods of the day, numbered from 1
+    gate_closure_at TIMESTAMP WITH TIME ZONE NOT NULL, -- no orders or cancels after this
+    status VARCHAR(20) NOT NULL DEFAULT 'open', -- open, cleared
+    cleared_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS auction_results (
+    id SERIAL PRIMARY KEY,
+    auction_id INT NOT NULL REFERENCES auctions(id) ON DELETE CASCADE,
+    delivery_period INT NOT NULL,
+    clearing_price NUMERIC(10,2), -- NULL when supply and demand did not cross
+    cleared_volume_mwh NUMERIC(15,6) NOT NULL DEFAULT 0,
+    demand_mwh NUMERIC(15,6) NOT NULL DEFAULT 0, -- total buy volume submitted
+    supply_mwh NUMERIC(15,6) NOT NULL DEFAULT 0, -- total sell volume submitted
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (auction_id, delivery_period)
+);
+
+-- Auction orders never enter the continuous order book
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS auction_id INT REFERENCES auctions(id);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS delivery_period INT;
+
+-- Auction trades have no aggressor
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS auction_id INT REFERENCES auctions(id);
+ALTER TABLE trades ALTER COLUMN aggressor_side DROP NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_auctions_status_gate ON auctions(status, gate_closure_at);
+CREATE INDEX IF NOT EXISTS idx_orders_auction ON orders(auction_id, delivery_period) WHERE auction_id IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Block orders trade the same amount in every delivery period from
+-- block_first_period to block_last_period, all or none. The block itself
+-- holds nothing, it trades through one child order per period.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS parent_order_id INT REFERENCES orders(id) ON DELETE RESTRICT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS block_first_period INT;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS block_last_period INT;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_block_periods_check;
+ALTER TABLE orders ADD CONSTRAINT orders_block_periods_check
+    CHECK (block_first_period IS NULL OR (block_first_period > 0 AND block_last_period >= block_first_period));
+
+CREATE INDEX IF NOT EXISTS idx_orders_parent ON orders(parent_order_id) WHERE parent_order_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_orders_block ON orders(order_type, block_first_period, block_last_period) WHERE block_first_period IS NOT NULL;
@@ -0,0 +1,23 @@
+-- Products are the delivery periods the continuous market trades, each in
+-- its own order book. Trading in a product stops at its gate closure.
+
+CREATE TABLE IF NOT EXISTS products (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(40) NOT NULL UNIQUE, -- e.g. H-2025-01-31-08, Q-2025-01-31-08:15, DB-2025-01-31
+    product_type VARCHAR(20) NOT NULL, -- hourly, quarter_hourly, daily_base, daily_peak, weekly_base, weekly_peak
+    delivery_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    delivery_end TIMESTAMP WITH TIME ZONE NOT NULL,
+    gate_closure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    matching_algorithm VARCHAR(20), -- NULL uses MATCHING_ALGORITHM
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (delivery_end > delivery_start)
+);
+
+-- Orders and trades without a product belong to the undated market
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS product_id INT REFERENCES products(id);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS product_id INT REFERENCES products(id);
+
+CREATE INDEX IF NOT EXISTS idx_products_delivery ON products(delivery_start, product_type);
+CREATE INDEX IF NOT EXISTS idx_products_gate_closure ON products(gate_closure_at);
+CREATE INDEX IF NOT EXISTS idx_orders_product ON orders(product_id, status) WHERE product_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_trades_product ON trades(product_id, created_at) WHERE product_id IS NOT NULL;
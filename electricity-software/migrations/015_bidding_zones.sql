@@ -0,0 +1,55 @@
+-- Bidding zones. Every user and their orders belong to one zone, trades
+-- between zones need transmission capacity from the seller's zone to the
+-- buyer's and use it up.
+
+CREATE TABLE IF NOT EXISTS bidding_zones (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(10) NOT NULL UNIQUE, -- e.g. BG
+    name VARCHAR(100) NOT NULL
+);
+
+INSERT INTO bidding_zones (code, name) VALUES
+    ('BG', 'Bulgaria'),
+    ('RO', 'Romania'),
+    ('GR', 'Greece')
+ON CONFLICT (code) DO NOTHING;
+
+-- Existing users and their orders go to the default zone
+ALTER TABLE users ADD COLUMN IF NOT EXISTS zone_id INT REFERENCES bidding_zones(id);
+UPDATE users SET zone_id = (SELECT id FROM bidding_zones WHERE code = 'BG') WHERE zone_id IS NULL;
+ALTER TABLE users ALTER COLUMN zone_id SET NOT NULL;
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS zone_id INT REFERENCES bidding_zones(id);
+UPDATE orders o SET zone_id = u.zone_id FROM users u WHERE u.id = o.user_id AND o.zone_id IS NULL;
+
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS buyer_zone_id INT REFERENCES bidding_zones(id);
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS seller_zone_id INT REFERENCES bidding_zones(id);
+
+-- Available transfer capacity in one direction between two zones. The row
+-- without a product holds the capacity per delivery product and the
+-- remaining capacity of the undated market, the row of a product is created
+-- from it on the first cross-zone trade in that product. Zones without a row
+-- are not connected.
+CREATE TABLE IF NOT EXISTS transmission_capacities (
+    id SERIAL PRIMARY KEY,
+    from_zone_id INT NOT NULL REFERENCES bidding_zones(id),
+    to_zone_id INT NOT NULL REFERENCES bidding_zones(id),
+    product_id INT REFERENCES products(id),
+    capacity_mwh NUMERIC(15,6) NOT NULL,
+    remaining_mwh NUMERIC(15,6) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_zone_id <> to_zone_id),
+    CHECK (remaining_mwh >= 0 AND remaining_mwh <= capacity_mwh)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transmission_capacities_path
+    ON transmission_capacities(from_zone_id, to_zone_id, COALESCE(product_id, 0));
+
+INSERT INTO transmission_capacities (from_zone_id, to_zone_id, capacity_mwh, remaining_mwh)
+SELECT f.id, t.id, c.capacity_mwh, c.capacity_mwh
+FROM (VALUES ('BG', 'RO', 500), ('RO', 'BG', 500), ('BG', 'GR', 400), ('GR', 'BG', 400)) AS c(from_code, to_code, capacity_mwh)
+JOIN bidding_zones f ON f.code = c.from_code
+JOIN bidding_zones t ON t.code = c.to_code
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_trades_buyer_zone ON trades(buyer_zone_id, created_at);
@@ -0,0 +1,52 @@
+-- OHLCV candles of the continuous market, one row per product, interval and
+-- time bucket that saw a trade. Every fill updates its candles as it is
+-- written, so market data never has to scan the trades. Auction and block
+-- trades are left out, like for the last trade price.
+
+CREATE TABLE IF NOT EXISTS candles (
+    id SERIAL PRIMARY KEY,
+    product_id INT REFERENCES products(id), -- NULL for the undated market
+    candle_interval VARCHAR(3) NOT NULL, -- 1m, 15m, 1h, 1d
+    bucket_start TIMESTAMP WITH TIME ZONE NOT NULL, -- in UTC, days start at midnight UTC
+    open NUMERIC(10,2) NOT NULL,
+    high NUMERIC(10,2) NOT NULL,
+    low NUMERIC(10,2) NOT NULL,
+    close NUMERIC(10,2) NOT NULL,
+    volume_mwh NUMERIC(15,6) NOT NULL,
+    trade_count INT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_candles_bucket
+    ON candles(COALESCE(product_id, 0), candle_interval, bucket_start);
+
+-- Build the candles of the trades made so far
+WITH fills AS (
+    SELECT t.id, t.product_id, t.amount_mwh, t.price_eur_per_mwh, t.created_at AT TIME ZONE 'UTC' AS traded_at
+    FROM trades t
+    LEFT JOIN orders o ON o.id = t.buy_order_id
+    WHERE t.auction_id IS NULL AND o.parent_order_id IS NULL
+),
+buckets AS (
+    SELECT f.*, i.candle_interval,
+        CASE i.candle_interval
+            WHEN '1m' THEN date_trunc('minute', f.traded_at)
+            WHEN '15m' THEN date_trunc('hour', f.traded_at) + floor(date_part('minute', f.traded_at) / 15) * INTERVAL '15 minutes'
+            WHEN '1h' THEN date_trunc('hour', f.traded_at)
+            ELSE date_trunc('day', f.traded_at)
+        END AT TIME ZONE 'UTC' AS bucket_start
+    FROM fills f
+    CROSS JOIN (VALUES ('1m'), ('15m'), ('1h'), ('1d')) AS i(candle_interval)
+)
+INSERT INTO candles (product_id, candle_interval, bucket_start, open, high, low, close, volume_mwh, trade_count, updated_at)
+SELECT product_id, candle_interval, bucket_start,
+    (array_agg(price_eur_per_mwh ORDER BY traded_at ASC, id ASC))[1],
+    MAX(price_eur_per_mwh),
+    MIN(price_eur_per_mwh),
+    (array_agg(price_eur_per_mwh ORDER BY traded_at DESC, id DESC))[1],
+    SUM(amount_mwh),
+    COUNT(*),
+    CURRENT_TIMESTAMP
+FROM buckets
+GROUP BY product_id, candle_interval, bucket_start
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,10 @@
+-- price_per_mwh becomes the history of the reference price index. A worker
+-- appends the volume-weighted average price of the recent trades, or carries
+-- the previous price forward when nothing has traded.
+
+ALTER TABLE price_per_mwh ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'manual'; -- vwap, fallback or manual
+ALTER TABLE price_per_mwh ADD COLUMN IF NOT EXISTS volume_mwh NUMERIC(15,6) NOT NULL DEFAULT 0; -- traded in the window the price is computed over
+ALTER TABLE price_per_mwh ADD COLUMN IF NOT EXISTS trade_count INT NOT NULL DEFAULT 0;
+ALTER TABLE price_per_mwh ALTER COLUMN effective_from SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_price_per_mwh_effective_from ON price_per_mwh(effective_from);
@@ -0,0 +1,16 @@
+-- Trading halts. While a halt is active its product accepts no new orders
+-- or amendments and nothing trades, cancels still go through. A halt ends at
+-- resume_at, or when it is resumed.
+
+CREATE TABLE IF NOT EXISTS trading_halts (
+    id SERIAL PRIMARY KEY,
+    product_id INT REFERENCES products(id), -- NULL for the undated market
+    reason VARCHAR(30) NOT NULL, -- circuit_breaker
+    reference_price NUMERIC(10,2), -- price at the start of the circuit breaker window
+    trigger_price NUMERIC(10,2), -- price the blocked trade would have traded at
+    halted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    resume_at TIMESTAMP WITH TIME ZONE, -- NULL halts until resumed
+    resumed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_trading_halts_active ON trading_halts(product_id, resume_at) WHERE resumed_at IS NULL;
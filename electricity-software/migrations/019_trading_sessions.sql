@@ -0,0 +1,36 @@
+-- Trading sessions. The market calendar gives the session of each weekday in
+-- UTC: from pre_open_time orders are taken but queued, from open_time they
+-- are matched and at close_time the market closes. A weekday without a row
+-- and a holiday have no session at all. The seed keeps the market open
+-- around the clock.
+
+CREATE TABLE IF NOT EXISTS market_calendar (
+    weekday INT PRIMARY KEY CHECK (weekday BETWEEN 0 AND 6), -- 0 is Sunday
+    pre_open_time TIME, -- NULL opens without a pre-open phase
+    open_time TIME NOT NULL,
+    close_time TIME NOT NULL, -- 24:00 closes at midnight
+    CHECK (pre_open_time IS NULL OR pre_open_time <= open_time),
+    CHECK (open_time < close_time)
+);
+
+INSERT INTO market_calendar (weekday, pre_open_time, open_time, close_time)
+SELECT d, NULL, '00:00', '24:00'
+FROM generate_series(0, 6) AS d
+ON CONFLICT (weekday) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS market_holidays (
+    holiday_date DATE PRIMARY KEY,
+    name VARCHAR(100) NOT NULL
+);
+
+-- Orders taken during pre-open, matched once the market opens
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS queued BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_orders_queued ON orders(priority_at) WHERE queued;
+
+-- Operators halt and resume trading through the admin endpoints
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE trading_halts ADD COLUMN IF NOT EXISTS halted_by INT REFERENCES users(id);
+ALTER TABLE trading_halts ADD COLUMN IF NOT EXISTS resumed_by INT REFERENCES users(id);
+ALTER TABLE trading_halts ADD COLUMN IF NOT EXISTS note TEXT;
@@ -0,0 +1,4 @@
+-- Holds are kept in whole cents like money_eur. Converts reserved_eur from
+-- 002, rounding the holds taken with more decimals.
+
+ALTER TABLE user_money ALTER COLUMN reserved_eur TYPE NUMERIC(15,2) USING ROUND(reserved_eur, 2);
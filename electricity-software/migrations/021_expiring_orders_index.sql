@@ -0,0 +1,6 @@
+-- GTD orders expire while open, partially filled or pending as a stop order,
+-- the index covers every status GetExpiredOrders looks at.
+
+DROP INDEX IF EXISTS idx_orders_expires_at;
+CREATE INDEX IF NOT EXISTS idx_orders_expires_at ON orders(expires_at)
+    WHERE status IN ('open', 'partially_filled', 'pending');
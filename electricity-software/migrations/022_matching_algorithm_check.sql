@@ -0,0 +1,9 @@
+-- A product may only choose the algorithms MATCHING_ALGORITHM knows, NULL
+-- still uses MATCHING_ALGORITHM. Products with an unknown one fall back to it.
+
+UPDATE products SET matching_algorithm = NULL
+WHERE matching_algorithm NOT IN ('fifo', 'pro_rata', 'pro_rata_top');
+
+ALTER TABLE products DROP CONSTRAINT IF EXISTS products_matching_algorithm_check;
+ALTER TABLE products ADD CONSTRAINT products_matching_algorithm_check
+    CHECK (matching_algorithm IN ('fifo', 'pro_rata', 'pro_rata_top'));
@@ -0,0 +1,21 @@
+-- Day-ahead auctions clear every zone at its own price, with one result per
+-- zone and period. The flow between two zones is limited to the capacity of
+-- the row without a product, every period getting the full capacity.
+
+ALTER TABLE auction_results ADD COLUMN IF NOT EXISTS zone_id INT REFERENCES bidding_zones(id);
+ALTER TABLE auction_results DROP CONSTRAINT IF EXISTS auction_results_auction_id_delivery_period_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_auction_results_zone
+    ON auction_results(auction_id, delivery_period, COALESCE(zone_id, 0));
+
+CREATE TABLE IF NOT EXISTS auction_flows (
+    id SERIAL PRIMARY KEY,
+    auction_id INT NOT NULL REFERENCES auctions(id) ON DELETE CASCADE,
+    delivery_period INT NOT NULL,
+    from_zone_id INT NOT NULL REFERENCES bidding_zones(id),
+    to_zone_id INT NOT NULL REFERENCES bidding_zones(id),
+    capacity_mwh NUMERIC(15,6) NOT NULL,
+    flow_mwh NUMERIC(15,6) NOT NULL, -- the part of the capacity the auction used
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (auction_id, delivery_period, from_zone_id, to_zone_id),
+    CHECK (flow_mwh >= 0 AND flow_mwh <= capacity_mwh)
+);
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+)
+
+type AuctionStatus string
+
+const (
+	AuctionStatusOpen    AuctionStatus = "open"    // collecting orders until gate closure
+	AuctionStatusCleared AuctionStatus = "cleared" // results published, accepted orders settled
+)
+
+// Auction is a day-ahead call auction: orders for each delivery period of
+// DeliveryDate are collected until GateClosureAt and then cleared at a
+// single price per period.
+type Auction struct {
+	ID            int           `db:"id" json:"id"`
+	DeliveryDate  time.Time     `db:"delivery_date" json:"delivery_date"`
+	Periods       int           `db:"periods" json:"periods"`
+	GateClosureAt time.Time     `db:"gate_closure_at" json:"gate_closure_at"`
+	Status        AuctionStatus `db:"status" json:"status"`
+	ClearedAt     *time.Time    `db:"cleared_at" json:"cleared_at,omitempty"`
+	CreatedAt     time.Time     `db:"created_at" json:"created_at"`
+}
+
+// AuctionResult is the outcome of one delivery period in one bidding zone,
+// ZoneID is nil for orders without a zone. ClearingPrice is nil when supply
+// and demand did not cross. ClearedVolumeMWh includes the energy the zone
+// imported or exported.
+type AuctionResult struct {
+	ID               int       `db:"id" json:"id"`
+	AuctionID        int       `db:"auction_id" json:"auction_id"`
+	DeliveryPeriod   int       `db:"delivery_period" json:"delivery_period"`
+	ZoneID           *int      `db:"zone_id" json:"zone_id,omitempty"`
+	ClearingPrice    *float64  `db:"clearing_price" json:"clearing_price_eur_per_mwh"`
+	ClearedVolumeMWh float64   `db:"cleared_volume_mwh" json:"cleared_volume_mwh"`
+	DemandMWh        float64   `db:"demand_mwh" json:"demand_mwh"`
+	SupplyMWh        float64   `db:"supply_mwh" json:"supply_mwh"`
+	CreatedAt        time.Time `db:"created_at" json:"created_at"`
+}
+
+// AuctionFlow is the energy an auction sent from one zone into another in a
+// delivery period, out of the capacity between them.
+type AuctionFlow struct {
+	ID             int       `db:"id" json:"id"`
+	AuctionID      int       `db:"auction_id" json:"auction_id"`
+	DeliveryPeriod int       `db:"delivery_period" json:"delivery_period"`
+	FromZoneID     int       `db:"from_zone_id" json:"from_zone_id"`
+	ToZoneID       int       `db:"to_zone_id" json:"to_zone_id"`
+	CapacityMWh    float64   `db:"capacity_mwh" json:"capacity_mwh"`
+	FlowMWh        float64   `db:"flow_mwh" json:"flow_mwh"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+}
+
+type AuctionFilter struct {
+	Status AuctionStatus `form:"status" json:"status" binding:"omitempty,oneof=open cleared"`
+	From   string        `form:"from" json:"from"`
+	To     string        `form:"to" json:"to"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+type HaltReason string
+
+const (
+	HaltReasonCircuitBreaker HaltReason = "circuit_breaker" // trades would have moved the price too far too fast
+	HaltReasonOperator       HaltReason = "operator"        // halted by an operator through the admin endpoints
+)
+
+// TradingHalt stops trading in a product, nil for the undated market, from
+// HaltedAt until ResumeAt or until it is resumed early.
+type TradingHalt struct {
+	ID             int        `db:"id" json:"id"`
+	ProductID      *int       `db:"product_id" json:"product_id,omitempty"`
+	Reason         HaltReason `db:"reason" json:"reason"`
+	ReferencePrice *float64   `db:"reference_price" json:"reference_price,omitempty"`
+	TriggerPrice   *float64   `db:"trigger_price" json:"trigger_price,omitempty"`
+	HaltedAt       time.Time  `db:"halted_at" json:"halted_at"`
+	ResumeAt       *time.Time `db:"resume_at" json:"resume_at,omitempty"`
+	ResumedAt      *time.Time `db:"resumed_at" json:"resumed_at,omitempty"`
+	// HaltedBy and ResumedBy are the operators who halted and resumed
+	HaltedBy  *int    `db:"halted_by" json:"halted_by,omitempty"`
+	ResumedBy *int    `db:"resumed_by" json:"resumed_by,omitempty"`
+	Note      *string `db:"note" json:"note,omitempty"`
+}
+
+// HaltRequest halts a product, or the undated market when ProductID is nil.
+// Without ResumeAt the halt lasts until it is resumed.
+type HaltRequest struct {
+	ProductID *int       `json:"product_id"`
+	ResumeAt  *time.Time `json:"resume_at"`
+	Note      string     `json:"note" binding:"max=500"`
+}
+
+// PriceLimits are the prices a product currently accepts. The band is nil
+// while there is no reference price or price bands are off.
+type PriceLimits struct {
+	ProductID      *int         `json:"product_id,omitempty"`
+	ReferencePrice *float64     `json:"reference_price"`
+	BandLow        *float64     `json:"band_low"`
+	BandHigh       *float64     `json:"band_high"`
+	Halt           *TradingHalt `json:"halt"`
+}
+
+type PriceLimitsFilter struct {
+	ProductID int `form:"product_id" json:"product_id"`
+}
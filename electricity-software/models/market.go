@@ -0,0 +1,116 @@
+package models
+
+import (
+	"time"
+)
+
+// DepthLevel is one price level of the order book, summed over the orders
+// resting at that price. Icebergs count with their visible tranche only.
+type DepthLevel struct {
+	PriceEurPerMWh float64 `json:"price_eur_per_mwh"`
+	AmountMWh      float64 `json:"amount_mwh"`
+	OrderCount     int     `json:"order_count"`
+}
+
+// MarketDepth is the aggregated order book of a product, nil for the undated
+// market. Bids and asks are best price first, Spread is set only when both
+// sides have orders.
+type MarketDepth struct {
+	ProductID *int         `json:"product_id,omitempty"`
+	Bids      []DepthLevel `json:"bids"`
+	Asks      []DepthLevel `json:"asks"`
+	BestBid   *float64     `json:"best_bid,omitempty"`
+	BestAsk   *float64     `json:"best_ask,omitempty"`
+	Spread    *float64     `json:"spread,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+type DepthFilter struct {
+	ProductID int `form:"product_id" json:"product_id"`
+	// Depth is the number of price levels per side, 10 when empty
+	Depth int `form:"depth" json:"depth" binding:"omitempty,gt=0,lte=100"`
+}
+
+type CandleInterval string
+
+const (
+	CandleInterval1m  CandleInterval = "1m"
+	CandleInterval15m CandleInterval = "15m"
+	CandleInterval1h  CandleInterval = "1h"
+	CandleInterval1d  CandleInterval = "1d"
+)
+
+// CandleIntervals lists every interval candles are kept for.
+var CandleIntervals = []CandleInterval{CandleInterval1m, CandleInterval15m, CandleInterval1h, CandleInterval1d}
+
+// Duration is the length of a candle of this interval.
+func (i CandleInterval) Duration() time.Duration {
+	switch i {
+	case CandleInterval1m:
+		return time.Minute
+	case CandleInterval15m:
+		return 15 * time.Minute
+	case CandleInterval1h:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// BucketStart is the start of the candle of this interval that t falls in.
+// Buckets are aligned to UTC, days start at midnight UTC.
+func (i CandleInterval) BucketStart(t time.Time) time.Time {
+	return t.UTC().Truncate(i.Duration())
+}
+
+// Candle sums up the trades of a product in one time bucket: the first,
+// highest, lowest and last price and the volume traded.
+type Candle struct {
+	ProductID   *int           `db:"product_id" json:"product_id,omitempty"`
+	Interval    CandleInterval `db:"candle_interval" json:"interval"`
+	BucketStart time.Time      `db:"bucket_start" json:"start"`
+	Open        float64        `db:"open" json:"open"`
+	High        float64        `db:"high" json:"high"`
+	Low         float64        `db:"low" json:"low"`
+	Close       float64        `db:"close" json:"close"`
+	VolumeMWh   float64        `db:"volume_mwh" json:"volume_mwh"`
+	TradeCount  int            `db:"trade_count" json:"trade_count"`
+}
+
+// CandleFilter selects the candles of one product and interval. Without from
+// and to the latest candles are returned.
+type CandleFilter struct {
+	ProductID int            `form:"product_id" json:"product_id"`
+	Interval  CandleInterval `form:"interval" json:"interval" binding:"required,oneof=1m 15m 1h 1d"`
+	From      string         `form:"from" json:"from"`
+	To        string         `form:"to" json:"to"`
+	Limit     int            `form:"limit" json:"limit" binding:"omitempty,gt=0,lte=1000"`
+}
+
+// MarketStats sums up the 1m candles of a product over a time window.
+// The prices are nil when nothing traded in the window.
+type MarketStats struct {
+	VolumeMWh float64  `db:"volume_mwh"`
+	Open      *float64 `db:"open"`
+	High      *float64 `db:"high"`
+	Low       *float64 `db:"low"`
+}
+
+// Ticker is the market summary of a product over the last 24 hours.
+// Change24h is the last price less the first price traded in the window.
+type Ticker struct {
+	ProductID    *int      `json:"product_id,omitempty"`
+	LastPrice    *float64  `json:"last_price"`
+	BestBid      *float64  `json:"best_bid"`
+	BestAsk      *float64  `json:"best_ask"`
+	Volume24hMWh float64   `json:"volume_24h_mwh"`
+	High24h      *float64  `json:"high_24h"`
+	Low24h       *float64  `json:"low_24h"`
+	Change24h    *float64  `json:"change_24h"`
+	ChangePct24h *float64  `json:"change_pct_24h"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+type TickerFilter struct {
+	ProductID int `form:"product_id" json:"product_id"`
+}
@@ -11,30 +11,183 @@ const (
 	OrderTypeSell OrderType = "sell"
 )
 
+type OrderKind string
+
+const (
+	OrderKindLimit     OrderKind = "limit"
+	OrderKindMarket    OrderKind = "market"
+	OrderKindStop      OrderKind = "stop"       // becomes a market order once triggered
+	OrderKindStopLimit OrderKind = "stop_limit" // becomes a limit order once triggered
+)
+
+type TimeInForce string
+
+const (
+	TimeInForceGTC TimeInForce = "gtc" // good till cancel
+	TimeInForceIOC TimeInForce = "ioc" // immediate or cancel, the unfilled remainder is canceled
+	TimeInForceFOK TimeInForce = "fok" // fill or kill, filled completely or not at all
+	TimeInForceGTD TimeInForce = "gtd" // good till date, expires at ExpiresAt
+)
+
+// STPMode decides what happens when an order would trade against another
+// order of the same user. The mode of the incoming order applies.
+type STPMode string
+
+const (
+	STPCancelNewest       STPMode = "cancel_newest"        // cancel the incoming order
+	STPCancelOldest       STPMode = "cancel_oldest"        // cancel the resting order
+	STPCancelBoth         STPMode = "cancel_both"          // cancel both orders
+	STPDecrementAndCancel STPMode = "decrement_and_cancel" // reduce both by the overlap, cancel what reaches zero
+)
+
 type OrderStatus string
 
 const (
+	OrderStatusPending   OrderStatus = "pending" // stop order waiting for its trigger
 	OrderStatusOpen      OrderStatus = "open"
+	OrderStatusPartial   OrderStatus = "partially_filled" // open with some of it already traded
 	OrderStatusCompleted OrderStatus = "completed"
 	OrderStatusCanceled  OrderStatus = "canceled"
+	OrderStatusExpired   OrderStatus = "expired"
 )
 
+// CancelReason records why an order was canceled.
+type CancelReason string
+
+const (
+	CancelReasonUser      CancelReason = "user_canceled"
+	CancelReasonIOC       CancelReason = "immediate_or_cancel" // unfilled remainder of an ioc or market order
+	CancelReasonFOK       CancelReason = "fill_or_kill"
+	CancelReasonSelfTrade CancelReason = "self_trade_prevention"
+	CancelReasonAuction   CancelReason = "auction_not_accepted" // not accepted when the auction cleared
+	CancelReasonGate      CancelReason = "gate_closure"         // still open when its product stopped trading
+	CancelReasonHalt      CancelReason = "trading_halted"       // unfilled when trading in its product was halted
+	CancelReasonClosed    CancelReason = "market_closed"        // could not wait for the market to open
+	CancelReasonPriceBand CancelReason = "price_band"           // priced outside the price band when its stop triggered
+	CancelReasonPostOnly  CancelReason = "post_only"            // a queued post-only order would have traded at the open
+)
+
+// Resting reports whether an order with this status is waiting to trade.
+func (s OrderStatus) Resting() bool {
+	return s == OrderStatusOpen || s == OrderStatusPartial
+}
+
 type Order struct {
-	ID              int         `db:"id" json:"id"`
-	UserID          int         `db:"user_id" json:"user_id"`
-	OrderType       OrderType   `db:"order_type" json:"order_type"`
-	AmountMWh       float64     `db:"amount_mwh" json:"amount_mwh"`
-	PriceEurPerMWh  float64     `db:"price_eur_per_mwh" json:"price_eur_per_mwh"`
-	Status          OrderStatus `db:"status" json:"status"`
-	CreatedAt       time.Time   `db:"created_at" json:"created_at"`
-	UpdatedAt       time.Time   `db:"updated_at" json:"updated_at"`
-	UserName        string      `db:"user_name" json:"user_name,omitempty"`
+	ID        int       `db:"id" json:"id"`
+	UserID    int       `db:"user_id" json:"user_id,omitempty"`
+	OrderType OrderType `db:"order_type" json:"order_type"`
+	OrderKind OrderKind `db:"order_kind" json:"order_kind"`
+	// AmountMWh is what is left to trade, OriginalAmountMWh what the order
+	// was placed for and FilledAmountMWh what has traded at AvgFillPrice
+	AmountMWh         float64  `db:"amount_mwh" json:"amount_mwh"`
+	OriginalAmountMWh float64  `db:"original_amount_mwh" json:"original_amount_mwh"`
+	FilledAmountMWh   float64  `db:"filled_amount_mwh" json:"filled_amount_mwh"`
+	AvgFillPrice      *float64 `db:"avg_fill_price" json:"avg_fill_price,omitempty"`
+	// For market orders this is the protection price: the worst price the
+	// order accepts, derived from the best opposite price and the slippage
+	PriceEurPerMWh float64  `db:"price_eur_per_mwh" json:"price_eur_per_mwh"`
+	MaxSlippagePct *float64 `db:"max_slippage_pct" json:"max_slippage_pct,omitempty"`
+	MaxNotionalEur *float64 `db:"max_notional_eur" json:"max_notional_eur,omitempty"`
+	// Stop orders trigger when the last trade price reaches the stop price:
+	// at or below it for sells, at or above it for buys
+	StopPriceEurPerMWh *float64    `db:"stop_price_eur_per_mwh" json:"stop_price_eur_per_mwh,omitempty"`
+	TriggeredAt        *time.Time  `db:"triggered_at" json:"triggered_at,omitempty"`
+	TimeInForce        TimeInForce `db:"time_in_force" json:"time_in_force"`
+	ExpiresAt          *time.Time  `db:"expires_at" json:"expires_at,omitempty"`
+	// Iceberg orders show at most DisplayAmountMWh at a time, VisibleAmountMWh
+	// is what is left of the current tranche
+	DisplayAmountMWh *float64 `db:"display_amount_mwh" json:"display_amount_mwh,omitempty"`
+	VisibleAmountMWh *float64 `db:"visible_amount_mwh" json:"visible_amount_mwh,omitempty"`
+	// Orders for a product trade in that product's book, orders without one
+	// in the undated market
+	ProductID *int `db:"product_id" json:"product_id,omitempty"`
+	// ZoneID is the bidding zone of the order's owner when it was placed
+	ZoneID *int `db:"zone_id" json:"zone_id,omitempty"`
+	// Auction orders rest outside the order book until their auction clears
+	AuctionID      *int `db:"auction_id" json:"auction_id,omitempty"`
+	DeliveryPeriod *int `db:"delivery_period" json:"delivery_period,omitempty"`
+	// A block order trades AmountMWh in every period from BlockFirstPeriod to
+	// BlockLastPeriod, all or none, through one child order per period that
+	// points back at it with ParentOrderID
+	BlockFirstPeriod *int    `db:"block_first_period" json:"block_first_period,omitempty"`
+	BlockLastPeriod  *int    `db:"block_last_period" json:"block_last_period,omitempty"`
+	ParentOrderID    *int    `db:"parent_order_id" json:"parent_order_id,omitempty"`
+	Children         []Order `db:"-" json:"children,omitempty"`
+	// Post-only orders never take liquidity, with PostOnlyReprice a crossing
+	// price is moved one tick away from the opposite side instead of rejected
+	PostOnly        bool `db:"post_only" json:"post_only,omitempty"`
+	PostOnlyReprice bool `db:"post_only_reprice" json:"post_only_reprice,omitempty"`
+	// Queued orders were taken while the market was not open and are
+	// matched once it opens
+	Queued bool `db:"queued" json:"queued,omitempty"`
+	// STPAction records the self-trade prevention mode that canceled or
+	// reduced the order
+	STPMode   *STPMode    `db:"stp_mode" json:"stp_mode,omitempty"`
+	STPAction *STPMode    `db:"stp_action" json:"stp_action,omitempty"`
+	Status    OrderStatus `db:"status" json:"status"`
+	// Canceled orders are kept with the time and reason of the cancellation
+	CanceledAt   *time.Time    `db:"canceled_at" json:"canceled_at,omitempty"`
+	CancelReason *CancelReason `db:"cancel_reason" json:"cancel_reason,omitempty"`
+	// PriorityAt orders the queue within a price level, it starts at
+	// CreatedAt and moves forward whenever the order loses time priority
+	PriorityAt time.Time `db:"priority_at" json:"priority_at"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+	UserName   string    `db:"user_name" json:"user_name,omitempty"`
+}
+
+// OnBook reports whether the order rests in the continuous order book.
+// Block orders and their children are matched outside of it.
+func (o Order) OnBook() bool {
+	return o.Status.Resting() && o.AuctionID == nil && !o.IsBlock() && o.ParentOrderID == nil
+}
+
+// IsBlock reports whether the order is a block order.
+func (o Order) IsBlock() bool {
+	return o.BlockFirstPeriod != nil
+}
+
+// BlockPeriods is the number of delivery periods a block order covers.
+func (o Order) BlockPeriods() int {
+	if !o.IsBlock() {
+		return 0
+	}
+	return *o.BlockLastPeriod - *o.BlockFirstPeriod + 1
+}
+
+// Public returns the order as other users may see it: an iceberg order only
+// shows its visible tranche, and the owner and the owner's self-trade
+// prevention and post-only settings are left out so trades cannot be traced
+// back to a counterparty through the order. The children of a block order
+// are made public the same way.
+func (o Order) Public() Order {
+	if o.VisibleAmountMWh != nil {
+		o.AmountMWh = *o.VisibleAmountMWh
+		o.OriginalAmountMWh = o.FilledAmountMWh + o.AmountMWh
+	}
+	o.DisplayAmountMWh = nil
+	o.VisibleAmountMWh = nil
+	o.UserID = 0
+	o.UserName = ""
+	o.STPMode = nil
+	o.STPAction = nil
+	o.PostOnly = false
+	o.PostOnlyReprice = false
+	if o.Children != nil {
+		children := make([]Order, len(o.Children))
+		for i, child := range o.Children {
+			children[i] = child.Public()
+		}
+		o.Children = children
+	}
+	return o
 }
 
 type Transaction struct {
 	ID              int       `db:"id" json:"id"`
 	UserID          int       `db:"user_id" json:"user_id"`
 	OrderID         *int      `db:"order_id" json:"order_id,omitempty"`
+	TradeID         *int      `db:"trade_id" json:"trade_id,omitempty"`
 	TransactionType OrderType `db:"transaction_type" json:"transaction_type"`
 	AmountMWh       float64   `db:"amount_mwh" json:"amount_mwh"`
 	PriceEurPerMWh  float64   `db:"price_eur_per_mwh" json:"price_eur_per_mwh"`
@@ -42,19 +195,108 @@ type Transaction struct {
 	CreatedAt       time.Time `db:"created_at" json:"created_at"`
 }
 
+// Trade is a single fill between a buy and a sell order. Counterparties are
+// never serialized, the order ids are cleared for anyone but the order owner.
+type Trade struct {
+	ID             int        `db:"id" json:"id"`
+	BuyOrderID     *int       `db:"buy_order_id" json:"buy_order_id,omitempty"`
+	SellOrderID    *int       `db:"sell_order_id" json:"sell_order_id,omitempty"`
+	BuyerID        *int       `db:"buyer_id" json:"-"`
+	SellerID       *int       `db:"seller_id" json:"-"`
+	ProductID      *int       `db:"product_id" json:"product_id,omitempty"`
+	AuctionID      *int       `db:"auction_id" json:"auction_id,omitempty"`
+	BuyerZoneID    *int       `db:"buyer_zone_id" json:"buyer_zone_id,omitempty"`
+	SellerZoneID   *int       `db:"seller_zone_id" json:"seller_zone_id,omitempty"`
+	AggressorSide  *OrderType `db:"aggressor_side" json:"aggressor_side,omitempty"` // nil for auction trades
+	AmountMWh      float64    `db:"amount_mwh" json:"amount_mwh"`
+	PriceEurPerMWh float64    `db:"price_eur_per_mwh" json:"price_eur_per_mwh"`
+	TotalEur       float64    `db:"total_eur" json:"total_eur"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	// Side is the caller's side of the trade, only set on their own trades
+	Side OrderType `db:"-" json:"side,omitempty"`
+}
+
+type TradeFilter struct {
+	ProductID int    `form:"product_id" json:"product_id"`
+	From      string `form:"from" json:"from"`
+	To        string `form:"to" json:"to"`
+	Limit     int    `form:"limit" json:"limit" binding:"omitempty,gt=0,lte=1000"`
+}
+
 type CreateOrderRequest struct {
-	OrderType      OrderType `json:"order_type" binding:"required,oneof=buy sell"`
-	AmountMWh      float64   `json:"amount_mwh" binding:"required,gt=0"`
-	PriceEurPerMWh float64   `json:"price_eur_per_mwh" binding:"required,gt=0"`
+	OrderType OrderType `json:"order_type" binding:"required,oneof=buy sell"`
+	OrderKind OrderKind `json:"order_kind" binding:"omitempty,oneof=limit market stop stop_limit"`
+	AmountMWh float64   `json:"amount_mwh" binding:"required,gt=0"`
+	// Required for limit and stop-limit orders, market orders derive it from
+	// the book and stop orders from the stop price
+	PriceEurPerMWh float64 `json:"price_eur_per_mwh" binding:"omitempty,gt=0"`
+	// Required for stop and stop-limit orders
+	StopPriceEurPerMWh *float64 `json:"stop_price_eur_per_mwh,omitempty" binding:"omitempty,gt=0"`
+	// Market and stop orders only: how far from the reference price the
+	// order may sweep, and an optional cap on the total value traded
+	MaxSlippagePct *float64 `json:"max_slippage_pct,omitempty" binding:"omitempty,gt=0,lt=100"`
+	MaxNotionalEur *float64 `json:"max_notional_eur,omitempty" binding:"omitempty,gt=0"`
+	// Defaults to gtc for limit and ioc for market orders, expires_at is
+	// required for gtd and not allowed otherwise
+	TimeInForce TimeInForce `json:"time_in_force" binding:"omitempty,oneof=gtc ioc fok gtd"`
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
+	// Turns a resting limit order into an iceberg that only shows this much
+	// of its amount at a time
+	DisplayAmountMWh *float64 `json:"display_amount_mwh,omitempty" binding:"omitempty,gt=0"`
+	// Overrides the account's self-trade prevention mode for this order
+	STPMode STPMode `json:"stp_mode" binding:"omitempty,oneof=cancel_newest cancel_oldest cancel_both decrement_and_cancel"`
+	// gtc and gtd limit orders only: reject the order if it would trade on
+	// placement, or with post_only_reprice move it one tick off the book
+	PostOnly        bool `json:"post_only"`
+	PostOnlyReprice bool `json:"post_only_reprice"`
+	// Trades the order in the book of this product, see GET /products
+	ProductID *int `json:"product_id,omitempty" binding:"omitempty,gt=0"`
+	// Places a limit order into a day-ahead auction for one delivery period
+	// instead of the continuous market
+	AuctionID      *int `json:"auction_id,omitempty" binding:"omitempty,gt=0"`
+	DeliveryPeriod *int `json:"delivery_period,omitempty" binding:"omitempty,gt=0"`
+	// Makes a gtc limit order a block order over these delivery periods,
+	// amount_mwh is traded in each of them and price_eur_per_mwh is the
+	// limit on the average price
+	BlockFirstPeriod *int `json:"block_first_period,omitempty" binding:"omitempty,gt=0"`
+	BlockLastPeriod  *int `json:"block_last_period,omitempty" binding:"omitempty,gt=0"`
 }
 
+// BatchOrderRequest places several orders at once. An atomic batch is placed
+// all or nothing, otherwise each order succeeds or fails on its own.
+type BatchOrderRequest struct {
+	Orders []CreateOrderRequest `json:"orders" binding:"required,min=1,max=100,dive"`
+	Atomic bool                 `json:"atomic"`
+}
+
+type BatchOrderResult struct {
+	Index int    `json:"index"`
+	Order *Order `json:"order,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// CancelAllRequest selects the orders canceled by POST /orders/cancel-all,
+// every open order of the user when empty.
+type CancelAllRequest struct {
+	OrderType         OrderType `json:"order_type" binding:"omitempty,oneof=buy sell"`
+	ProductID         *int      `json:"product_id,omitempty" binding:"omitempty,gt=0"`
+	MinPriceEurPerMWh *float64  `json:"min_price_eur_per_mwh,omitempty" binding:"omitempty,gte=0"`
+	MaxPriceEurPerMWh *float64  `json:"max_price_eur_per_mwh,omitempty" binding:"omitempty,gte=0"`
+}
+
+// UpdateOrderRequest amends a resting order. AmountMWh is the new total size
+// of the order including what has already been filled.
 type UpdateOrderRequest struct {
-	AmountMWh      *float64 `json:"amount_mwh,omitempty"`
-	PriceEurPerMWh *float64 `json:"price_eur_per_mwh,omitempty"`
+	AmountMWh      *float64 `json:"amount_mwh,omitempty" binding:"omitempty,gt=0"`
+	PriceEurPerMWh *float64 `json:"price_eur_per_mwh,omitempty" binding:"omitempty,gt=0"`
 }
 
 type OrderFilter struct {
-	Type OrderType `form:"type" json:"type"`
-	From string    `form:"from" json:"from"`
-	To   string    `form:"to" json:"to"`
-} 
\ No newline at end of file
+	Type      OrderType   `form:"type" json:"type"`
+	Status    OrderStatus `form:"status" json:"status" binding:"omitempty,oneof=pending open partially_filled completed canceled expired"`
+	ProductID int         `form:"product_id" json:"product_id"`
+	// DeliveryDate (YYYY-MM-DD) matches orders for products delivered that day
+	DeliveryDate string `form:"delivery_date" json:"delivery_date"`
+	From         string `form:"from" json:"from"`
+	To           string `form:"to" json:"to"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// privateFields are the JSON fields only the owner of an order may see.
+var privateFields = []string{"user_id", "user_name", "stp_mode", "stp_action", "post_only", "post_only_reprice", "display_amount_mwh", "visible_amount_mwh"}
+
+// findFields returns the private fields present anywhere in a decoded JSON
+// value, nested objects and arrays included.
+func findFields(value interface{}, found map[string]bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, field := range privateFields {
+			if _, ok := v[field]; ok {
+				found[field] = true
+			}
+		}
+		for _, nested := range v {
+			findFields(nested, found)
+		}
+	case []interface{}:
+		for _, nested := range v {
+			findFields(nested, found)
+		}
+	}
+}
+
+func TestOrderPublic(t *testing.T) {
+	first, last := 8, 9
+	display, visible := 2.0, 1.5
+	mode := STPCancelNewest
+	owned := func(id int) Order {
+		return Order{
+			ID:               id,
+			UserID:           7,
+			UserName:         "Seller",
+			OrderType:        OrderTypeSell,
+			AmountMWh:        10,
+			STPMode:          &mode,
+			STPAction:        &mode,
+			PostOnly:         true,
+			PostOnlyReprice:  true,
+			DisplayAmountMWh: &display,
+			VisibleAmountMWh: &visible,
+		}
+	}
+
+	block := owned(1)
+	block.BlockFirstPeriod = &first
+	block.BlockLastPeriod = &last
+	block.Children = []Order{owned(2), owned(3)}
+
+	tests := []struct {
+		name  string
+		order Order
+	}{
+		{"single order", owned(1)},
+		{"block order with children", block},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(tt.order.Public())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded interface{}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			found := make(map[string]bool)
+			findFields(decoded, found)
+			if len(found) > 0 {
+				t.Errorf("Public() shows %v in %s", found, body)
+			}
+		})
+	}
+
+	// The owner's own view is left alone
+	block.Public()
+	if block.Children[0].UserID != 7 {
+		t.Errorf("Public() changed the children of the original order")
+	}
+}
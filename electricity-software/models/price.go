@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+type PriceSource string
+
+const (
+	PriceSourceVWAP     PriceSource = "vwap"     // volume-weighted average of the trades in the window
+	PriceSourceFallback PriceSource = "fallback" // nothing traded, the previous price carried forward
+	PriceSourceManual   PriceSource = "manual"   // entered directly into price_per_mwh
+)
+
+// PriceIndex is a reference price published into price_per_mwh. It applies
+// from EffectiveFrom until the next one.
+type PriceIndex struct {
+	ID            int         `db:"id" json:"id"`
+	PriceEur      float64     `db:"price_eur" json:"price_eur_per_mwh"`
+	Source        PriceSource `db:"source" json:"source"`
+	VolumeMWh     float64     `db:"volume_mwh" json:"volume_mwh"`
+	TradeCount    int         `db:"trade_count" json:"trade_count"`
+	EffectiveFrom time.Time   `db:"effective_from" json:"effective_from"`
+}
+
+type PriceHistoryFilter struct {
+	From  string `form:"from" json:"from"`
+	To    string `form:"to" json:"to"`
+	Limit int    `form:"limit" json:"limit" binding:"omitempty,gt=0,lte=1000"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+)
+
+type ProductType string
+
+const (
+	ProductTypeHourly        ProductType = "hourly"
+	ProductTypeQuarterHourly ProductType = "quarter_hourly"
+	ProductTypeDailyBase     ProductType = "daily_base"  // every hour of the day
+	ProductTypeDailyPeak     ProductType = "daily_peak"  // 08:00-20:00
+	ProductTypeWeeklyBase    ProductType = "weekly_base" // every hour, Monday to Sunday
+	ProductTypeWeeklyPeak    ProductType = "weekly_peak" // 08:00-20:00, Monday to Friday
+)
+
+// Product is a delivery period that is traded in its own order book, from
+// DeliveryStart up to DeliveryEnd. Trading stops at GateClosureAt.
+type Product struct {
+	ID            int         `db:"id" json:"id"`
+	Code          string      `db:"code" json:"code"`
+	ProductType   ProductType `db:"product_type" json:"product_type"`
+	DeliveryStart time.Time   `db:"delivery_start" json:"delivery_start"`
+	DeliveryEnd   time.Time   `db:"delivery_end" json:"delivery_end"`
+	GateClosureAt time.Time   `db:"gate_closure_at" json:"gate_closure_at"`
+	// MatchingAlgorithm overrides MATCHING_ALGORITHM for this product
+	MatchingAlgorithm *string   `db:"matching_algorithm" json:"matching_algorithm,omitempty"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+}
+
+// Trading reports whether the product still accepts orders at now.
+func (p Product) Trading(now time.Time) bool {
+	return now.Before(p.GateClosureAt)
+}
+
+// MatchingAlgorithmRequest sets the matching algorithm of a product, empty
+// goes back to MATCHING_ALGORITHM.
+type MatchingAlgorithmRequest struct {
+	MatchingAlgorithm string `json:"matching_algorithm" binding:"omitempty,oneof=fifo pro_rata pro_rata_top"`
+}
+
+type ProductFilter struct {
+	Type         ProductType `form:"type" json:"type" binding:"omitempty,oneof=hourly quarter_hourly daily_base daily_peak weekly_base weekly_peak"`
+	DeliveryDate string      `form:"delivery_date" json:"delivery_date"`
+	Trading      bool        `form:"trading" json:"trading"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+type MarketState string
+
+const (
+	MarketStateOpen    MarketState = "open"     // orders are matched
+	MarketStatePreOpen MarketState = "pre_open" // orders are taken and queued until the open
+	MarketStateClosed  MarketState = "closed"   // no orders are taken
+	MarketStateHalted  MarketState = "halted"   // no orders are taken until trading resumes
+)
+
+// CalendarDay is the trading session of a weekday, 0 being Sunday. Times are
+// UTC times of day as HH:MM, the close may be 24:00.
+type CalendarDay struct {
+	Weekday     int     `db:"weekday" json:"weekday"`
+	PreOpenTime *string `db:"pre_open_time" json:"pre_open_time,omitempty"`
+	OpenTime    string  `db:"open_time" json:"open_time"`
+	CloseTime   string  `db:"close_time" json:"close_time"`
+}
+
+// MarketHoliday is a day without a trading session.
+type MarketHoliday struct {
+	Date string `db:"holiday_date" json:"date"`
+	Name string `db:"name" json:"name"`
+}
+
+// MarketCalendar is the weekly schedule with the upcoming holidays.
+type MarketCalendar struct {
+	Days     []CalendarDay   `json:"days"`
+	Holidays []MarketHoliday `json:"holidays"`
+}
+
+// MarketSession is the trading session of one day.
+type MarketSession struct {
+	PreOpenAt *time.Time `json:"pre_open_at,omitempty"`
+	OpenAt    time.Time  `json:"open_at"`
+	CloseAt   time.Time  `json:"close_at"`
+}
+
+// MarketTransition is a change of the market state at At.
+type MarketTransition struct {
+	State MarketState `json:"state"`
+	At    time.Time   `json:"at"`
+}
+
+// MarketStatus is the state of a product, nil for the undated market, with
+// the session in progress or the next one and the state changes ahead.
+type MarketStatus struct {
+	ProductID   *int               `json:"product_id,omitempty"`
+	State       MarketState        `json:"state"`
+	Session     *MarketSession     `json:"session"`
+	Halt        *TradingHalt       `json:"halt"`
+	Transitions []MarketTransition `json:"transitions"`
+}
+
+type MarketStatusFilter struct {
+	ProductID int `form:"product_id" json:"product_id"`
+}
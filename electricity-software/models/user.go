@@ -7,5 +7,17 @@ type User struct {
 	Name         string    `db:"name"`
 	Email        string    `db:"email"`
 	PasswordHash string    `db:"password_hash"`
+	STPMode      *STPMode  `db:"stp_mode"`
 	CreatedAt    time.Time `db:"created_at"`
 }
+
+// Balance is a user's money and energy. Open orders hold part of the total,
+// only the available amount can back new orders.
+type Balance struct {
+	MoneyEur     float64 `db:"money_eur" json:"money_eur"`
+	ReservedEur  float64 `db:"reserved_eur" json:"reserved_eur"`
+	AvailableEur float64 `json:"available_eur"`
+	EnergyMWh    float64 `db:"energy_mwh" json:"energy_mwh"`
+	ReservedMWh  float64 `db:"reserved_mwh" json:"reserved_mwh"`
+	AvailableMWh float64 `json:"available_mwh"`
+}
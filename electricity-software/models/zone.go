@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// BiddingZone is an area of the grid with its own price. Energy reaches
+// another zone only through the transmission capacity between them.
+type BiddingZone struct {
+	ID   int    `db:"id" json:"id"`
+	Code string `db:"code" json:"code"`
+	Name string `db:"name" json:"name"`
+}
+
+// ZonePrice is the last price paid for energy delivered into a zone.
+// LastPrice is nil while nothing has traded there yet.
+type ZonePrice struct {
+	BiddingZone
+	LastPrice   *float64   `db:"last_price" json:"last_price_eur_per_mwh"`
+	LastTradeAt *time.Time `db:"last_trade_at" json:"last_trade_at,omitempty"`
+}
+
+// TransmissionCapacity is the capacity from one zone into another for a
+// product (nil for the undated market). RemainingMWh is what cross-zone
+// trades have not used up yet.
+type TransmissionCapacity struct {
+	FromZoneID   int       `db:"from_zone_id" json:"from_zone_id"`
+	FromZone     string    `db:"from_zone" json:"from_zone"`
+	ToZoneID     int       `db:"to_zone_id" json:"to_zone_id"`
+	ToZone       string    `db:"to_zone" json:"to_zone"`
+	ProductID    *int      `db:"product_id" json:"product_id,omitempty"`
+	CapacityMWh  float64   `db:"capacity_mwh" json:"capacity_mwh"`
+	RemainingMWh float64   `db:"remaining_mwh" json:"remaining_mwh"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// ZoneFilter selects the product the zone prices and capacities are for,
+// the undated market when empty, or a delivery period of an auction.
+type ZoneFilter struct {
+	ProductID      int `form:"product_id" json:"product_id"`
+	AuctionID      int `form:"auction_id" json:"auction_id"`
+	DeliveryPeriod int `form:"delivery_period" json:"delivery_period" binding:"required_with=AuctionID"`
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"my-go-project/models"
+)
+
+// Auction queries live on OrderRepository so that clearing an auction can
+// settle its orders in the same transaction.
+
+// EnsureAuction creates the auction for a delivery date unless it exists.
+func (r *OrderRepository) EnsureAuction(deliveryDate time.Time, periods int, gateClosureAt time.Time) error {
+	query := `
+		INSERT INTO auctions (delivery_date, periods, gate_closure_at, status, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (delivery_date) DO NOTHING`
+
+	_, err := r.db.Exec(query, deliveryDate, periods, gateClosureAt, models.AuctionStatusOpen, time.Now())
+	return err
+}
+
+func (r *OrderRepository) GetAuctionByID(id int) (*models.Auction, error) {
+	var auction models.Auction
+	err := r.db.Get(&auction, "SELECT * FROM auctions WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &auction, nil
+}
+
+// LockAuctionByID reads an auction and locks its row until the surrounding
+// transaction ends.
+func (r *OrderRepository) LockAuctionByID(id int) (*models.Auction, error) {
+	var auction models.Auction
+	err := r.db.Get(&auction, "SELECT * FROM auctions WHERE id = $1 FOR UPDATE", id)
+	if err != nil {
+		return nil, err
+	}
+	return &auction, nil
+}
+
+func (r *OrderRepository) GetAuctions(filter models.AuctionFilter) ([]models.Auction, error) {
+	query := "SELECT * FROM auctions WHERE TRUE"
+	args := []interface{}{}
+	argIndex := 1
+
+	if filter.Status != "" {
+		query += fmt.Sprintf(" AND status = $%d", argIndex)
+		args = append(args, filter.Status)
+		argIndex++
+	}
+
+	if filter.From != "" {
+		query += fmt.Sprintf(" AND delivery_date >= $%d", argIndex)
+		args = append(args, filter.From)
+		argIndex++
+	}
+
+	if filter.To != "" {
+		query += fmt.Sprintf(" AND delivery_date <= $%d", argIndex)
+		args = append(args, filter.To)
+		argIndex++
+	}
+
+	query += " ORDER BY delivery_date DESC"
+
+	var auctions []models.Auction
+	err := r.db.Select(&auctions, query, args...)
+	return auctions, err
+}
+
+// GetDueAuctions returns the open auctions whose gate has closed.
+func (r *OrderRepository) GetDueAuctions(now time.Time) ([]models.Auction, error) {
+	query := `
+		SELECT *
+		FROM auctions
+		WHERE status = $1 AND gate_closure_at <= $2
+		ORDER BY gate_closure_at ASC`
+
+	var auctions []models.Auction
+	err := r.db.Select(&auctions, query, models.AuctionStatusOpen, now)
+	return auctions, err
+}
+
+// LockAuctionOrders returns the orders waiting in an auction, by delivery
+// period and in time priority, and locks them.
+func (r *OrderRepository) LockAuctionOrders(auctionID int) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.auction_id = $1 AND o.status IN ($2, $3)
+		ORDER BY o.delivery_period ASC, o.priority_at ASC, o.id ASC
+		FOR UPDATE OF o`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, auctionID, models.OrderStatusOpen, models.OrderStatusPartial)
+	return orders, err
+}
+
+func (r *OrderRepository) CreateAuctionResult(result *models.AuctionResult) error {
+	query := `
+		INSERT INTO auction_results (auction_id, delivery_period, zone_id, clearing_price, cleared_volume_mwh, demand_mwh, supply_mwh, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+
+	result.CreatedAt = time.Now()
+	return r.db.QueryRow(
+		query,
+		result.AuctionID,
+		result.DeliveryPeriod,
+		result.ZoneID,
+		result.ClearingPrice,
+		result.ClearedVolumeMWh,
+		result.DemandMWh,
+		result.SupplyMWh,
+		result.CreatedAt,
+	).Scan(&result.ID)
+}
+
+func (r *OrderRepository) GetAuctionResults(auctionID int) ([]models.AuctionResult, error) {
+	query := `
+		SELECT *
+		FROM auction_results
+		WHERE auction_id = $1
+		ORDER BY delivery_period ASC, zone_id ASC NULLS FIRST`
+
+	var results []models.AuctionResult
+	err := r.db.Select(&results, query, auctionID)
+	return results, err
+}
+
+func (r *OrderRepository) CreateAuctionFlow(flow *models.AuctionFlow) error {
+	query := `
+		INSERT INTO auction_flows (auction_id, delivery_period, from_zone_id, to_zone_id, capacity_mwh, flow_mwh, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+
+	flow.CreatedAt = time.Now()
+	return r.db.QueryRow(
+		query,
+		flow.AuctionID,
+		flow.DeliveryPeriod,
+		flow.FromZoneID,
+		flow.ToZoneID,
+		flow.CapacityMWh,
+		flow.FlowMWh,
+		flow.CreatedAt,
+	).Scan(&flow.ID)
+}
+
+func (r *OrderRepository) GetAuctionFlows(auctionID int) ([]models.AuctionFlow, error) {
+	query := `
+		SELECT *
+		FROM auction_flows
+		WHERE auction_id = $1
+		ORDER BY delivery_period ASC, from_zone_id ASC, to_zone_id ASC`
+
+	flows := []models.AuctionFlow{}
+	err := r.db.Select(&flows, query, auctionID)
+	return flows, err
+}
+
+func (r *OrderRepository) MarkAuctionCleared(id int, clearedAt time.Time) error {
+	query := "UPDATE auctions SET status = $1, cleared_at = $2 WHERE id = $3"
+	_, err := r.db.Exec(query, models.AuctionStatusCleared, clearedAt, id)
+	return err
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"my-go-project/models"
+)
+
+// GetChildOrders returns the per-period child orders of a block order.
+func (r *OrderRepository) GetChildOrders(parentID int) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.parent_order_id = $1
+		ORDER BY o.delivery_period ASC`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, parentID)
+	return orders, err
+}
+
+// LockChildOrders returns the per-period child orders of a block order and
+// locks them until the surrounding transaction ends.
+func (r *OrderRepository) LockChildOrders(parentID int) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.parent_order_id = $1
+		ORDER BY o.delivery_period ASC
+		FOR UPDATE OF o`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, parentID)
+	return orders, err
+}
+
+// GetRestingBlockOrders returns the block orders of the continuous market
+// that have not traded yet, in time priority.
+func (r *OrderRepository) GetRestingBlockOrders() ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.status = $1 AND o.auction_id IS NULL AND o.block_first_period IS NOT NULL
+		ORDER BY o.priority_at ASC, o.id ASC`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, models.OrderStatusOpen)
+	return orders, err
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"my-go-project/models"
+)
+
+// RecordCandles adds a trade to its candle of every interval.
+func (r *OrderRepository) RecordCandles(trade *models.Trade) error {
+	query := `
+		INSERT INTO candles (product_id, candle_interval, bucket_start, open, high, low, close, volume_mwh, trade_count, updated_at)
+		VALUES ($1, $2, $3, $4, $4, $4, $4, $5, 1, $6)
+		ON CONFLICT (COALESCE(product_id, 0), candle_interval, bucket_start) DO UPDATE SET
+			high = GREATEST(candles.high, EXCLUDED.high),
+			low = LEAST(candles.low, EXCLUDED.low),
+			close = EXCLUDED.close,
+			volume_mwh = candles.volume_mwh + EXCLUDED.volume_mwh,
+			trade_count = candles.trade_count + 1,
+			updated_at = EXCLUDED.updated_at`
+
+	for _, interval := range models.CandleIntervals {
+		_, err := r.db.Exec(
+			query,
+			trade.ProductID,
+			interval,
+			interval.BucketStart(trade.CreatedAt),
+			trade.PriceEurPerMWh,
+			trade.AmountMWh,
+			trade.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCandles returns the candles matching the filter oldest first, the
+// latest ones when the filter has no time range.
+func (r *OrderRepository) GetCandles(productID *int, filter models.CandleFilter) ([]models.Candle, error) {
+	query := `
+		SELECT product_id, candle_interval, bucket_start, open, high, low, close, volume_mwh, trade_count
+		FROM candles
+		WHERE product_id IS NOT DISTINCT FROM $1 AND candle_interval = $2`
+
+	args := []interface{}{productID, filter.Interval}
+	argIndex := 3
+
+	if filter.From != "" {
+		query += fmt.Sprintf(" AND bucket_start >= $%d", argIndex)
+		args = append(args, filter.From)
+		argIndex++
+	}
+
+	if filter.To != "" {
+		query += fmt.Sprintf(" AND bucket_start <= $%d", argIndex)
+		args = append(args, filter.To)
+		argIndex++
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = 500
+	}
+
+	// Without a start take the latest candles and put them back in order
+	order := "ASC"
+	if filter.From == "" {
+		order = "DESC"
+	}
+	query = fmt.Sprintf("SELECT * FROM (%s ORDER BY bucket_start %s LIMIT $%d) c ORDER BY bucket_start ASC", query, order, argIndex)
+	args = append(args, limit)
+
+	candles := []models.Candle{}
+	err := r.db.Select(&candles, query, args...)
+	return candles, err
+}
+
+// GetMarketStats sums up the 1m candles of a product (nil for the undated
+// market) from since on.
+func (r *OrderRepository) GetMarketStats(productID *int, since time.Time) (*models.MarketStats, error) {
+	query := `
+		SELECT COALESCE(SUM(volume_mwh), 0) AS volume_mwh,
+			(array_agg(open ORDER BY bucket_start ASC))[1] AS open,
+			MAX(high) AS high,
+			MIN(low) AS low
+		FROM candles
+		WHERE product_id IS NOT DISTINCT FROM $1 AND candle_interval = $2 AND bucket_start >= $3`
+
+	var stats models.MarketStats
+	err := r.db.Get(&stats, query, productID, models.CandleInterval1m, since)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetLastCandlePrice returns the close of the latest candle of a product
+// (nil for the undated market). ok is false while nothing has traded yet.
+func (r *OrderRepository) GetLastCandlePrice(productID *int) (price float64, ok bool, err error) {
+	query := `
+		SELECT close
+		FROM candles
+		WHERE product_id IS NOT DISTINCT FROM $1 AND candle_interval = $2
+		ORDER BY bucket_start DESC
+		LIMIT 1`
+	err = r.db.Get(&price, query, productID, models.CandleInterval1m)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return price, true, nil
+}
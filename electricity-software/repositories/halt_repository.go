@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"my-go-project/models"
+)
+
+func (r *OrderRepository) CreateTradingHalt(halt *models.TradingHalt) error {
+	query := `
+		INSERT INTO trading_halts (product_id, reason, reference_price, trigger_price, halted_at, resume_at, halted_by, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+
+	return r.db.QueryRow(
+		query,
+		halt.ProductID,
+		halt.Reason,
+		halt.ReferencePrice,
+		halt.TriggerPrice,
+		halt.HaltedAt,
+		halt.ResumeAt,
+		halt.HaltedBy,
+		halt.Note,
+	).Scan(&halt.ID)
+}
+
+// LockTradingHalt returns a halt and locks it until the surrounding
+// transaction ends.
+func (r *OrderRepository) LockTradingHalt(id int) (*models.TradingHalt, error) {
+	var halt models.TradingHalt
+	err := r.db.Get(&halt, "SELECT * FROM trading_halts WHERE id = $1 FOR UPDATE", id)
+	if err != nil {
+		return nil, err
+	}
+	return &halt, nil
+}
+
+// ResumeTradingHalt ends a halt early on behalf of an operator.
+func (r *OrderRepository) ResumeTradingHalt(id, resumedBy int, now time.Time) error {
+	_, err := r.db.Exec("UPDATE trading_halts SET resumed_at = $1, resumed_by = $2 WHERE id = $3", now, resumedBy, id)
+	return err
+}
+
+// GetActiveHalt returns the halt of a product (nil for the undated market)
+// that is in force at now, the one lasting longest if there are several.
+// It returns nil when the product is trading.
+func (r *OrderRepository) GetActiveHalt(productID *int, now time.Time) (*models.TradingHalt, error) {
+	query := `
+		SELECT *
+		FROM trading_halts
+		WHERE product_id IS NOT DISTINCT FROM $1 AND resumed_at IS NULL AND halted_at <= $2 AND (resume_at IS NULL OR resume_at > $2)
+		ORDER BY resume_at DESC NULLS FIRST, id DESC
+		LIMIT 1`
+
+	var halt models.TradingHalt
+	err := r.db.Get(&halt, query, productID, now)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &halt, nil
+}
+
+// GetActiveHalts returns every halt in force at now, newest first.
+func (r *OrderRepository) GetActiveHalts(now time.Time) ([]models.TradingHalt, error) {
+	query := `
+		SELECT *
+		FROM trading_halts
+		WHERE resumed_at IS NULL AND halted_at <= $1 AND (resume_at IS NULL OR resume_at > $1)
+		ORDER BY halted_at DESC, id DESC`
+
+	halts := []models.TradingHalt{}
+	err := r.db.Select(&halts, query, now)
+	return halts, err
+}
+
+// GetReferenceTradePrice returns the price of the last trade of a product
+// (nil for the undated market) at or before at, or of the first one after it
+// if there is none, leaving out auction and block trades like
+// GetLastTradePrice. ok is false while nothing has traded yet.
+func (r *OrderRepository) GetReferenceTradePrice(productID *int, at time.Time) (price float64, ok bool, err error) {
+	query := `
+		WITH fills AS (
+			SELECT t.id, t.price_eur_per_mwh, t.created_at
+			FROM trades t
+			WHERE t.auction_id IS NULL AND t.product_id IS NOT DISTINCT FROM $1
+			  AND NOT EXISTS (
+			    SELECT 1 FROM orders b
+			    WHERE b.id IN (t.buy_order_id, t.sell_order_id) AND b.parent_order_id IS NOT NULL)
+		)
+		SELECT price_eur_per_mwh FROM (
+			(SELECT price_eur_per_mwh, 0 AS rank FROM fills WHERE created_at <= $2 ORDER BY created_at DESC, id DESC LIMIT 1)
+			UNION ALL
+			(SELECT price_eur_per_mwh, 1 AS rank FROM fills WHERE created_at > $2 ORDER BY created_at ASC, id ASC LIMIT 1)
+		) p
+		ORDER BY rank
+		LIMIT 1`
+	err = r.db.Get(&price, query, productID, at)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return price, true, nil
+}
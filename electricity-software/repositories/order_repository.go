@@ -6,33 +6,72 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"my-go-project/models"
 )
 
+// DBTX is implemented by both *sqlx.DB and *sqlx.Tx, so repository methods
+// can run either on their own or inside a transaction owned by the caller.
+type DBTX interface {
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type OrderRepository struct {
-	db *sqlx.DB
+	db DBTX
 }
 
 func NewOrderRepository(db *sqlx.DB) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
+// WithTx returns a repository whose queries run inside the given transaction.
+func (r *OrderRepository) WithTx(tx *sqlx.Tx) *OrderRepository {
+	return &OrderRepository{db: tx}
+}
+
 func (r *OrderRepository) CreateOrder(order *models.Order) error {
 	query := `
-		INSERT INTO orders (user_id, order_type, amount_mwh, price_eur_per_mwh, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO orders (user_id, order_type, order_kind, amount_mwh, original_amount_mwh, filled_amount_mwh, price_eur_per_mwh, max_slippage_pct, max_notional_eur, stop_price_eur_per_mwh, time_in_force, expires_at, display_amount_mwh, visible_amount_mwh, product_id, zone_id, auction_id, delivery_period, block_first_period, block_last_period, parent_order_id, post_only, post_only_reprice, stp_mode, status, priority_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28)
 		RETURNING id`
 	
 	now := time.Now()
+	order.PriorityAt = now
+	order.CreatedAt = now
+	order.UpdatedAt = now
 	return r.db.QueryRow(
 		query,
 		order.UserID,
 		order.OrderType,
+		order.OrderKind,
 		order.AmountMWh,
+		order.OriginalAmountMWh,
+		order.FilledAmountMWh,
 		order.PriceEurPerMWh,
+		order.MaxSlippagePct,
+		order.MaxNotionalEur,
+		order.StopPriceEurPerMWh,
+		order.TimeInForce,
+		order.ExpiresAt,
+		order.DisplayAmountMWh,
+		order.VisibleAmountMWh,
+		order.ProductID,
+		order.ZoneID,
+		order.AuctionID,
+		order.DeliveryPeriod,
+		order.BlockFirstPeriod,
+		order.BlockLastPeriod,
+		order.ParentOrderID,
+		order.PostOnly,
+		order.PostOnlyReprice,
+		order.STPMode,
 		order.Status,
 		now,
 		now,
+		now,
 	).Scan(&order.ID)
 }
 
@@ -51,6 +90,24 @@ func (r *OrderRepository) GetOrderByID(id int) (*models.Order, error) {
 	return &order, nil
 }
 
+// LockOrderByID reads an order and locks its row until the surrounding
+// transaction ends.
+func (r *OrderRepository) LockOrderByID(id int) (*models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.id = $1
+		FOR UPDATE OF o`
+	
+	var order models.Order
+	err := r.db.Get(&order, query, id)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
 func (r *OrderRepository) GetOrdersByUser(userID int, filter models.OrderFilter) ([]models.Order, error) {
 	query := `
 		SELECT o.*, u.name as user_name
@@ -67,6 +124,24 @@ func (r *OrderRepository) GetOrdersByUser(userID int, filter models.OrderFilter)
 		argIndex++
 	}
 
+	if filter.Status != "" {
+		query += fmt.Sprintf(" AND o.status = $%d", argIndex)
+		args = append(args, filter.Status)
+		argIndex++
+	}
+
+	if filter.ProductID != 0 {
+		query += fmt.Sprintf(" AND o.product_id = $%d", argIndex)
+		args = append(args, filter.ProductID)
+		argIndex++
+	}
+
+	if filter.DeliveryDate != "" {
+		query += fmt.Sprintf(" AND o.product_id IN (SELECT id FROM products WHERE delivery_start >= $%d::date AND delivery_start < $%d::date + 1)", argIndex, argIndex)
+		args = append(args, filter.DeliveryDate)
+		argIndex++
+	}
+
 	if filter.From != "" {
 		query += fmt.Sprintf(" AND o.created_at >= $%d", argIndex)
 		args = append(args, filter.From)
@@ -91,10 +166,23 @@ func (r *OrderRepository) GetSellOrders(filter models.OrderFilter) ([]models.Ord
 		SELECT o.*, u.name as user_name
 		FROM orders o
 		JOIN users u ON o.user_id = u.id
-		WHERE o.order_type = 'sell' AND o.status = $1`
+		WHERE o.order_type = 'sell' AND o.status IN ($1, $2)
+		  AND o.auction_id IS NULL AND o.block_first_period IS NULL AND o.parent_order_id IS NULL`
 	
-	args := []interface{}{models.OrderStatusOpen}
-	argIndex := 2
+	args := []interface{}{models.OrderStatusOpen, models.OrderStatusPartial}
+	argIndex := 3
+
+	if filter.ProductID != 0 {
+		query += fmt.Sprintf(" AND o.product_id = $%d", argIndex)
+		args = append(args, filter.ProductID)
+		argIndex++
+	}
+
+	if filter.DeliveryDate != "" {
+		query += fmt.Sprintf(" AND o.product_id IN (SELECT id FROM products WHERE delivery_start >= $%d::date AND delivery_start < $%d::date + 1)", argIndex, argIndex)
+		args = append(args, filter.DeliveryDate)
+		argIndex++
+	}
 
 	if filter.From != "" {
 		query += fmt.Sprintf(" AND o.created_at >= $%d", argIndex)
@@ -108,7 +196,128 @@ func (r *OrderRepository) GetSellOrders(filter models.OrderFilter) ([]models.Ord
 		argIndex++
 	}
 
-	query += " ORDER BY o.price_eur_per_mwh ASC, o.created_at ASC"
+	query += " ORDER BY o.price_eur_per_mwh ASC, o.priority_at ASC, o.id ASC"
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, args...)
+	return orders, err
+}
+
+func (r *OrderRepository) GetBuyOrders(filter models.OrderFilter) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.order_type = 'buy' AND o.status IN ($1, $2)
+		  AND o.auction_id IS NULL AND o.block_first_period IS NULL AND o.parent_order_id IS NULL`
+	
+	args := []interface{}{models.OrderStatusOpen, models.OrderStatusPartial}
+	argIndex := 3
+
+	if filter.ProductID != 0 {
+		query += fmt.Sprintf(" AND o.product_id = $%d", argIndex)
+		args = append(args, filter.ProductID)
+		argIndex++
+	}
+
+	if filter.DeliveryDate != "" {
+		query += fmt.Sprintf(" AND o.product_id IN (SELECT id FROM products WHERE delivery_start >= $%d::date AND delivery_start < $%d::date + 1)", argIndex, argIndex)
+		args = append(args, filter.DeliveryDate)
+		argIndex++
+	}
+
+	if filter.From != "" {
+		query += fmt.Sprintf(" AND o.created_at >= $%d", argIndex)
+		args = append(args, filter.From)
+		argIndex++
+	}
+
+	if filter.To != "" {
+		query += fmt.Sprintf(" AND o.created_at <= $%d", argIndex)
+		args = append(args, filter.To)
+		argIndex++
+	}
+
+	query += " ORDER BY o.price_eur_per_mwh DESC, o.priority_at ASC, o.id ASC"
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, args...)
+	return orders, err
+}
+
+// GetExpiredOrders returns resting or pending good-till-date orders whose
+// expiry has passed.
+func (r *OrderRepository) GetExpiredOrders(now time.Time) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.status IN ($1, $2, $3) AND o.time_in_force = $4 AND o.expires_at <= $5
+		ORDER BY o.expires_at ASC`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, models.OrderStatusOpen, models.OrderStatusPartial, models.OrderStatusPending, models.TimeInForceGTD, now)
+	return orders, err
+}
+
+// GetTriggeredStopOrders returns the pending stop orders of a product (nil
+// for the undated market) that a trade at lastPrice triggers, oldest first.
+func (r *OrderRepository) GetTriggeredStopOrders(productID *int, lastPrice float64) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.status = $1 AND o.product_id IS NOT DISTINCT FROM $3
+		  AND (o.expires_at IS NULL OR o.expires_at > NOW())
+		  AND ((o.order_type = 'sell' AND o.stop_price_eur_per_mwh >= $2)
+		    OR (o.order_type = 'buy' AND o.stop_price_eur_per_mwh <= $2))
+		ORDER BY o.created_at ASC, o.id ASC
+		FOR UPDATE OF o`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, models.OrderStatusPending, lastPrice, productID)
+	return orders, err
+}
+
+// LockActiveOrdersByUser returns the user's resting and pending orders that
+// match the filter and locks them until the surrounding transaction ends.
+func (r *OrderRepository) LockActiveOrdersByUser(userID int, filter models.CancelAllRequest) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.user_id = $1 AND o.status IN ($2, $3, $4)
+		  AND (o.auction_id IS NULL OR EXISTS (
+		    SELECT 1 FROM auctions a WHERE a.id = o.auction_id AND a.status = 'open' AND a.gate_closure_at > NOW()))`
+
+	args := []interface{}{userID, models.OrderStatusOpen, models.OrderStatusPartial, models.OrderStatusPending}
+	argIndex := 5
+
+	if filter.OrderType != "" {
+		query += fmt.Sprintf(" AND o.order_type = $%d", argIndex)
+		args = append(args, filter.OrderType)
+		argIndex++
+	}
+
+	if filter.ProductID != nil {
+		query += fmt.Sprintf(" AND o.product_id = $%d", argIndex)
+		args = append(args, *filter.ProductID)
+		argIndex++
+	}
+
+	if filter.MinPriceEurPerMWh != nil {
+		query += fmt.Sprintf(" AND o.price_eur_per_mwh >= $%d", argIndex)
+		args = append(args, *filter.MinPriceEurPerMWh)
+		argIndex++
+	}
+
+	if filter.MaxPriceEurPerMWh != nil {
+		query += fmt.Sprintf(" AND o.price_eur_per_mwh <= $%d", argIndex)
+		args = append(args, *filter.MaxPriceEurPerMWh)
+		argIndex++
+	}
+
+	query += " ORDER BY o.id ASC FOR UPDATE OF o"
 
 	var orders []models.Order
 	err := r.db.Select(&orders, query, args...)
@@ -137,22 +346,17 @@ func (r *OrderRepository) UpdateOrder(id int, updates map[string]interface{}) er
 	return err
 }
 
-func (r *OrderRepository) DeleteOrder(id int) error {
-	query := "DELETE FROM orders WHERE id = $1"
-	_, err := r.db.Exec(query, id)
-	return err
-}
-
 func (r *OrderRepository) CreateTransaction(transaction *models.Transaction) error {
 	query := `
-		INSERT INTO transactions (user_id, order_id, transaction_type, amount_mwh, price_eur_per_mwh, total_eur, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO transactions (user_id, order_id, trade_id, transaction_type, amount_mwh, price_eur_per_mwh, total_eur, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id`
 	
 	return r.db.QueryRow(
 		query,
 		transaction.UserID,
 		transaction.OrderID,
+		transaction.TradeID,
 		transaction.TransactionType,
 		transaction.AmountMWh,
 		transaction.PriceEurPerMWh,
@@ -161,6 +365,74 @@ func (r *OrderRepository) CreateTransaction(transaction *models.Transaction) err
 	).Scan(&transaction.ID)
 }
 
+func (r *OrderRepository) CreateTrade(trade *models.Trade) error {
+	query := `
+		INSERT INTO trades (buy_order_id, sell_order_id, buyer_id, seller_id, product_id, auction_id, buyer_zone_id, seller_zone_id, aggressor_side, amount_mwh, price_eur_per_mwh, total_eur, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id`
+
+	trade.CreatedAt = time.Now()
+	return r.db.QueryRow(
+		query,
+		trade.BuyOrderID,
+		trade.SellOrderID,
+		trade.BuyerID,
+		trade.SellerID,
+		trade.ProductID,
+		trade.AuctionID,
+		trade.BuyerZoneID,
+		trade.SellerZoneID,
+		trade.AggressorSide,
+		trade.AmountMWh,
+		trade.PriceEurPerMWh,
+		trade.TotalEur,
+		trade.CreatedAt,
+	).Scan(&trade.ID)
+}
+
+// GetTrades returns the most recent trades of the market, newest first.
+func (r *OrderRepository) GetTrades(filter models.TradeFilter) ([]models.Trade, error) {
+	return r.selectTrades("SELECT * FROM trades WHERE TRUE", nil, filter)
+}
+
+// GetTradesByUser returns the trades the user took part in on either side.
+func (r *OrderRepository) GetTradesByUser(userID int, filter models.TradeFilter) ([]models.Trade, error) {
+	return r.selectTrades("SELECT * FROM trades WHERE (buyer_id = $1 OR seller_id = $1)", []interface{}{userID}, filter)
+}
+
+func (r *OrderRepository) selectTrades(query string, args []interface{}, filter models.TradeFilter) ([]models.Trade, error) {
+	argIndex := len(args) + 1
+
+	if filter.ProductID != 0 {
+		query += fmt.Sprintf(" AND product_id = $%d", argIndex)
+		args = append(args, filter.ProductID)
+		argIndex++
+	}
+
+	if filter.From != "" {
+		query += fmt.Sprintf(" AND created_at >= $%d", argIndex)
+		args = append(args, filter.From)
+		argIndex++
+	}
+
+	if filter.To != "" {
+		query += fmt.Sprintf(" AND created_at <= $%d", argIndex)
+		args = append(args, filter.To)
+		argIndex++
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", argIndex)
+	args = append(args, limit)
+
+	var trades []models.Trade
+	err := r.db.Select(&trades, query, args...)
+	return trades, err
+}
+
 func (r *OrderRepository) GetTransactionsByUser(userID int) ([]models.Transaction, error) {
 	query := `
 		SELECT *
@@ -173,35 +445,82 @@ func (r *OrderRepository) GetTransactionsByUser(userID int) ([]models.Transactio
 	return transactions, err
 }
 
-func (r *OrderRepository) GetUserBalance(userID int) (money float64, energy float64, err error) {
+// GetUserSTPMode returns the account's self-trade prevention mode, nil when
+// the user has not chosen one.
+func (r *OrderRepository) GetUserSTPMode(userID int) (*models.STPMode, error) {
+	var mode *models.STPMode
+	err := r.db.Get(&mode, "SELECT stp_mode FROM users WHERE id = $1", userID)
+	return mode, err
+}
+
+// GetLastTradePrice returns the price of the most recent transaction in a
+// product of the continuous market (nil for the undated market), leaving out
+// block trades. ok is false while nothing has traded yet.
+func (r *OrderRepository) GetLastTradePrice(productID *int) (price float64, ok bool, err error) {
+	query := `
+		SELECT t.price_eur_per_mwh
+		FROM transactions t
+		LEFT JOIN trades tr ON tr.id = t.trade_id
+		LEFT JOIN orders o ON o.id = t.order_id
+		WHERE tr.auction_id IS NULL AND o.product_id IS NOT DISTINCT FROM $1
+		  AND NOT EXISTS (
+		    SELECT 1 FROM orders b
+		    WHERE b.id IN (tr.buy_order_id, tr.sell_order_id) AND b.parent_order_id IS NOT NULL)
+		ORDER BY t.created_at DESC, t.id DESC
+		LIMIT 1`
+	err = r.db.Get(&price, query, productID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return price, true, nil
+}
+
+func (r *OrderRepository) GetUserBalance(userID int) (*models.Balance, error) {
+	var balance models.Balance
+
 	// Get user money
-	moneyQuery := "SELECT money_eur FROM user_money WHERE user_id = $1"
-	err = r.db.Get(&money, moneyQuery, userID)
+	moneyQuery := "SELECT money_eur, reserved_eur FROM user_money WHERE user_id = $1"
+	err := r.db.QueryRow(moneyQuery, userID).Scan(&balance.MoneyEur, &balance.ReservedEur)
 	if err == sql.ErrNoRows {
-		money = 10000 // Default starting amount
+		balance.MoneyEur = 10000 // Default starting amount
 	} else if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
 	// Get user energy
-	energyQuery := "SELECT energy_mwh FROM user_energy WHERE user_id = $1"
-	err = r.db.Get(&energy, energyQuery, userID)
+	energyQuery := "SELECT energy_mwh, reserved_mwh FROM user_energy WHERE user_id = $1"
+	err = r.db.QueryRow(energyQuery, userID).Scan(&balance.EnergyMWh, &balance.ReservedMWh)
 	if err == sql.ErrNoRows {
-		energy = 10000 // Default starting amount
+		balance.EnergyMWh = 10000 // Default starting amount
 	} else if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	return money, energy, nil
+	balance.AvailableEur = balance.MoneyEur - balance.ReservedEur
+	balance.AvailableMWh = balance.EnergyMWh - balance.ReservedMWh
+	return &balance, nil
 }
 
-func (r *OrderRepository) UpdateUserBalance(userID int, moneyDelta, energyDelta float64) error {
-	tx, err := r.db.Beginx()
+// LockUserBalances locks the money and energy rows of the given users until
+// the surrounding transaction ends. Rows are locked in user id order so that
+// concurrent trades between the same users cannot deadlock.
+func (r *OrderRepository) LockUserBalances(userIDs ...int) error {
+	var locked []int
+	moneyQuery := "SELECT user_id FROM user_money WHERE user_id = ANY($1) ORDER BY user_id FOR UPDATE"
+	err := r.db.Select(&locked, moneyQuery, pq.Array(userIDs))
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
+	energyQuery := "SELECT user_id FROM user_energy WHERE user_id = ANY($1) ORDER BY user_id FOR UPDATE"
+	return r.db.Select(&locked, energyQuery, pq.Array(userIDs))
+}
+
+// UpdateUserBalance applies money and energy deltas to a user. It issues two
+// statements and is meant to run inside a transaction, see WithTx.
+func (r *OrderRepository) UpdateUserBalance(userID int, moneyDelta, energyDelta float64) error {
 	// Update or insert money
 	moneyQuery := `
 		INSERT INTO user_money (user_id, money_eur)
@@ -209,7 +528,7 @@ func (r *OrderRepository) UpdateUserBalance(userID int, moneyDelta, energyDelta
 		ON CONFLICT (user_id)
 		DO UPDATE SET money_eur = user_money.money_eur + $2`
 	
-	_, err = tx.Exec(moneyQuery, userID, moneyDelta)
+	_, err := r.db.Exec(moneyQuery, userID, moneyDelta)
 	if err != nil {
 		return err
 	}
@@ -221,10 +540,38 @@ func (r *OrderRepository) UpdateUserBalance(userID int, moneyDelta, energyDelta
 		ON CONFLICT (user_id)
 		DO UPDATE SET energy_mwh = user_energy.energy_mwh + $2`
 	
-	_, err = tx.Exec(energyQuery, userID, energyDelta)
-	if err != nil {
-		return err
+	_, err = r.db.Exec(energyQuery, userID, energyDelta)
+	return err
+}
+
+// ReserveBalance moves money and energy between the available and reserved
+// part of a user's balance. Positive deltas take a hold, negative release it.
+func (r *OrderRepository) ReserveBalance(userID int, eurDelta, mwhDelta float64) error {
+	if eurDelta != 0 {
+		moneyQuery := `
+			INSERT INTO user_money (user_id, reserved_eur)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id)
+			DO UPDATE SET reserved_eur = user_money.reserved_eur + $2`
+
+		_, err := r.db.Exec(moneyQuery, userID, eurDelta)
+		if err != nil {
+			return err
+		}
 	}
 
-	return tx.Commit()
-} 
\ No newline at end of file
+	if mwhDelta != 0 {
+		energyQuery := `
+			INSERT INTO user_energy (user_id, reserved_mwh)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id)
+			DO UPDATE SET reserved_mwh = user_energy.reserved_mwh + $2`
+
+		_, err := r.db.Exec(energyQuery, userID, mwhDelta)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
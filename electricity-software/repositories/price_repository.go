@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"my-go-project/models"
+)
+
+// GetTradeVWAP returns the volume-weighted average price of the trades of
+// the undated continuous market made from from up to to, with their volume
+// and count. Product, auction and block trades are left out like for the
+// last trade price. price is 0 when nothing traded.
+func (r *OrderRepository) GetTradeVWAP(from, to time.Time) (price, volumeMWh float64, count int, err error) {
+	query := `
+		SELECT COALESCE(SUM(t.total_eur) / NULLIF(SUM(t.amount_mwh), 0), 0), COALESCE(SUM(t.amount_mwh), 0), COUNT(*)
+		FROM trades t
+		WHERE t.product_id IS NULL AND t.auction_id IS NULL
+		  AND NOT EXISTS (
+		    SELECT 1 FROM orders b
+		    WHERE b.id IN (t.buy_order_id, t.sell_order_id) AND b.parent_order_id IS NOT NULL)
+		  AND t.created_at >= $1 AND t.created_at < $2`
+	err = r.db.QueryRow(query, from, to).Scan(&price, &volumeMWh, &count)
+	return price, volumeMWh, count, err
+}
+
+func (r *OrderRepository) CreatePriceIndex(price *models.PriceIndex) error {
+	query := `
+		INSERT INTO price_per_mwh (price_eur, source, volume_mwh, trade_count, effective_from)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	return r.db.QueryRow(
+		query,
+		price.PriceEur,
+		price.Source,
+		price.VolumeMWh,
+		price.TradeCount,
+		price.EffectiveFrom,
+	).Scan(&price.ID)
+}
+
+// GetCurrentPriceIndex returns the reference price in effect at now, nil
+// when none has been published yet.
+func (r *OrderRepository) GetCurrentPriceIndex(now time.Time) (*models.PriceIndex, error) {
+	query := `
+		SELECT *
+		FROM price_per_mwh
+		WHERE effective_from <= $1
+		ORDER BY effective_from DESC, id DESC
+		LIMIT 1`
+
+	var price models.PriceIndex
+	err := r.db.Get(&price, query, now)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+// GetPriceHistory returns the published reference prices, newest first.
+func (r *OrderRepository) GetPriceHistory(filter models.PriceHistoryFilter) ([]models.PriceIndex, error) {
+	query := "SELECT * FROM price_per_mwh WHERE TRUE"
+	args := []interface{}{}
+	argIndex := 1
+
+	if filter.From != "" {
+		query += fmt.Sprintf(" AND effective_from >= $%d", argIndex)
+		args = append(args, filter.From)
+		argIndex++
+	}
+
+	if filter.To != "" {
+		query += fmt.Sprintf(" AND effective_from <= $%d", argIndex)
+		args = append(args, filter.To)
+		argIndex++
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = 100
+	}
+	query += fmt.Sprintf(" ORDER BY effective_from DESC, id DESC LIMIT $%d", argIndex)
+	args = append(args, limit)
+
+	prices := []models.PriceIndex{}
+	err := r.db.Select(&prices, query, args...)
+	return prices, err
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"my-go-project/models"
+)
+
+// EnsureProduct creates a product unless one with the same code exists.
+func (r *OrderRepository) EnsureProduct(product *models.Product) error {
+	query := `
+		INSERT INTO products (code, product_type, delivery_start, delivery_end, gate_closure_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (code) DO NOTHING`
+
+	_, err := r.db.Exec(
+		query,
+		product.Code,
+		product.ProductType,
+		product.DeliveryStart,
+		product.DeliveryEnd,
+		product.GateClosureAt,
+		time.Now(),
+	)
+	return err
+}
+
+func (r *OrderRepository) GetProductByID(id int) (*models.Product, error) {
+	var product models.Product
+	err := r.db.Get(&product, "SELECT * FROM products WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// GetProductByDelivery returns the product of a type whose delivery starts
+// at start.
+func (r *OrderRepository) GetProductByDelivery(productType models.ProductType, start time.Time) (*models.Product, error) {
+	var product models.Product
+	err := r.db.Get(&product, "SELECT * FROM products WHERE product_type = $1 AND delivery_start = $2", productType, start)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// SetProductMatchingAlgorithm sets the matching algorithm of a product, nil
+// for MATCHING_ALGORITHM.
+func (r *OrderRepository) SetProductMatchingAlgorithm(id int, name *string) error {
+	_, err := r.db.Exec("UPDATE products SET matching_algorithm = $1 WHERE id = $2", name, id)
+	return err
+}
+
+// GetProducts returns the products matching the filter in delivery order.
+// With filter.Trading only products whose gate is still open at now.
+func (r *OrderRepository) GetProducts(filter models.ProductFilter, now time.Time) ([]models.Product, error) {
+	query := "SELECT * FROM products WHERE TRUE"
+	args := []interface{}{}
+	argIndex := 1
+
+	if filter.Type != "" {
+		query += fmt.Sprintf(" AND product_type = $%d", argIndex)
+		args = append(args, filter.Type)
+		argIndex++
+	}
+
+	if filter.DeliveryDate != "" {
+		query += fmt.Sprintf(" AND delivery_start >= $%d::date AND delivery_start < $%d::date + 1", argIndex, argIndex)
+		args = append(args, filter.DeliveryDate)
+		argIndex++
+	}
+
+	if filter.Trading {
+		query += fmt.Sprintf(" AND gate_closure_at > $%d", argIndex)
+		args = append(args, now)
+		argIndex++
+	}
+
+	query += " ORDER BY delivery_start ASC, delivery_end ASC, id ASC"
+
+	var products []models.Product
+	err := r.db.Select(&products, query, args...)
+	return products, err
+}
+
+// LockGateClosedOrders returns the resting and pending orders whose product
+// has stopped trading at now and locks them.
+func (r *OrderRepository) LockGateClosedOrders(now time.Time) ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		JOIN products p ON p.id = o.product_id
+		WHERE o.status IN ($1, $2, $3) AND p.gate_closure_at <= $4
+		ORDER BY o.id ASC
+		FOR UPDATE OF o`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, models.OrderStatusOpen, models.OrderStatusPartial, models.OrderStatusPending, now)
+	return orders, err
+}
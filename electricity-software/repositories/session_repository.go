@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"time"
+
+	"my-go-project/models"
+)
+
+// GetMarketCalendar returns the trading session of every weekday that has
+// one, Sunday first.
+func (r *OrderRepository) GetMarketCalendar() ([]models.CalendarDay, error) {
+	query := `
+		SELECT weekday,
+			to_char(pre_open_time, 'HH24:MI') AS pre_open_time,
+			to_char(open_time, 'HH24:MI') AS open_time,
+			to_char(close_time, 'HH24:MI') AS close_time
+		FROM market_calendar
+		ORDER BY weekday ASC`
+
+	days := []models.CalendarDay{}
+	err := r.db.Select(&days, query)
+	return days, err
+}
+
+// GetMarketHolidays returns the holidays from the day of from up to and
+// including the day of to, in date order.
+func (r *OrderRepository) GetMarketHolidays(from, to time.Time) ([]models.MarketHoliday, error) {
+	query := `
+		SELECT to_char(holiday_date, 'YYYY-MM-DD') AS holiday_date, name
+		FROM market_holidays
+		WHERE holiday_date BETWEEN $1::date AND $2::date
+		ORDER BY holiday_date ASC`
+
+	holidays := []models.MarketHoliday{}
+	err := r.db.Select(&holidays, query, from.UTC().Format("2006-01-02"), to.UTC().Format("2006-01-02"))
+	return holidays, err
+}
+
+// GetQueuedOrders returns the resting orders queued while the market was not
+// open, in time priority.
+func (r *OrderRepository) GetQueuedOrders() ([]models.Order, error) {
+	query := `
+		SELECT o.*, u.name as user_name
+		FROM orders o
+		JOIN users u ON o.user_id = u.id
+		WHERE o.queued AND o.status IN ($1, $2)
+		ORDER BY o.priority_at ASC, o.id ASC`
+
+	var orders []models.Order
+	err := r.db.Select(&orders, query, models.OrderStatusOpen, models.OrderStatusPartial)
+	return orders, err
+}
@@ -4,23 +4,29 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"my-go-project/models"
 )
 
 type User struct {
-	ID           int       `db:"id"`
-	Name         string    `db:"name"`
-	Email        string    `db:"email"`
-	PasswordHash string    `db:"password_hash"`
-	CreatedAt    time.Time `db:"created_at"`
+	ID           int             `db:"id"`
+	Name         string          `db:"name"`
+	Email        string          `db:"email"`
+	PasswordHash string          `db:"password_hash"`
+	STPMode      *models.STPMode `db:"stp_mode"`
+	ZoneID       int             `db:"zone_id"`
+	IsAdmin      bool            `db:"is_admin"`
+	CreatedAt    time.Time       `db:"created_at"`
 }
 
 type UserRepository interface {
-	CreateUser(name, email, passwordHash string) (int, error)
+	CreateUser(name, email, passwordHash string, zoneID int) (int, error)
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
 
-	GetUserEnergy(userID int) (float64, error)
-	GetUserMoney(userID int) (float64, error)
+	GetUserBalance(userID int) (*models.Balance, error)
+	UpdateSTPMode(userID int, mode *models.STPMode) error
+	GetBiddingZoneByCode(code string) (*models.BiddingZone, error)
+	GetBiddingZoneByID(id int) (*models.BiddingZone, error)
 }
 
 type userRepository struct {
@@ -31,12 +37,12 @@ func NewUserRepository(db *sqlx.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (r *userRepository) CreateUser(name, email, passwordHash string) (int, error) {
+func (r *userRepository) CreateUser(name, email, passwordHash string, zoneID int) (int, error) {
 	var id int
 	err := r.db.QueryRow(
-		`INSERT INTO users (name, email, password_hash, created_at) 
-         VALUES ($1, $2, $3, NOW()) RETURNING id`,
-		name, email, passwordHash,
+		`INSERT INTO users (name, email, password_hash, zone_id, created_at) 
+         VALUES ($1, $2, $3, $4, NOW()) RETURNING id`,
+		name, email, passwordHash, zoneID,
 	).Scan(&id)
 	if err != nil {
 		return 0, err
@@ -81,14 +87,41 @@ func (r *userRepository) GetUserByID(id int) (*User, error) {
 	return &user, nil
 }
 
-func (r *userRepository) GetUserEnergy(userID int) (float64, error) {
-	var energy float64
-	err := r.db.Get(&energy, "SELECT energy_mwh FROM user_energy WHERE user_id=$1", userID)
-	return energy, err
+func (r *userRepository) UpdateSTPMode(userID int, mode *models.STPMode) error {
+	_, err := r.db.Exec("UPDATE users SET stp_mode=$1 WHERE id=$2", mode, userID)
+	return err
 }
 
-func (r *userRepository) GetUserMoney(userID int) (float64, error) {
-	var money float64
-	err := r.db.Get(&money, "SELECT money_eur FROM user_money WHERE user_id=$1", userID)
-	return money, err
+func (r *userRepository) GetBiddingZoneByCode(code string) (*models.BiddingZone, error) {
+	var zone models.BiddingZone
+	err := r.db.Get(&zone, "SELECT * FROM bidding_zones WHERE code=$1", code)
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func (r *userRepository) GetBiddingZoneByID(id int) (*models.BiddingZone, error) {
+	var zone models.BiddingZone
+	err := r.db.Get(&zone, "SELECT * FROM bidding_zones WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func (r *userRepository) GetUserBalance(userID int) (*models.Balance, error) {
+	var balance models.Balance
+	err := r.db.Get(&balance, `
+		SELECT m.money_eur, m.reserved_eur, e.energy_mwh, e.reserved_mwh
+		FROM user_money m
+		JOIN user_energy e ON e.user_id = m.user_id
+		WHERE m.user_id=$1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	balance.AvailableEur = balance.MoneyEur - balance.ReservedEur
+	balance.AvailableMWh = balance.EnergyMWh - balance.ReservedMWh
+	return &balance, nil
 }
@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"my-go-project/models"
+)
+
+func (r *OrderRepository) GetBiddingZones() ([]models.BiddingZone, error) {
+	var zones []models.BiddingZone
+	err := r.db.Select(&zones, "SELECT * FROM bidding_zones ORDER BY id ASC")
+	return zones, err
+}
+
+// GetUserZoneID returns the bidding zone of a user.
+func (r *OrderRepository) GetUserZoneID(userID int) (int, error) {
+	var zoneID int
+	err := r.db.Get(&zoneID, "SELECT zone_id FROM users WHERE id = $1", userID)
+	return zoneID, err
+}
+
+// GetZonePrices returns every zone with the price of the latest trade of a
+// product (nil for the undated market) delivered into it.
+func (r *OrderRepository) GetZonePrices(productID *int) ([]models.ZonePrice, error) {
+	query := `
+		SELECT z.*, t.price_eur_per_mwh AS last_price, t.created_at AS last_trade_at
+		FROM bidding_zones z
+		LEFT JOIN LATERAL (
+			SELECT price_eur_per_mwh, created_at
+			FROM trades
+			WHERE buyer_zone_id = z.id AND auction_id IS NULL AND product_id IS NOT DISTINCT FROM $1
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		) t ON TRUE
+		ORDER BY z.id ASC`
+
+	var prices []models.ZonePrice
+	err := r.db.Select(&prices, query, productID)
+	return prices, err
+}
+
+// GetAuctionZonePrices returns every zone with its clearing price in a
+// delivery period of an auction, nil before the auction has cleared or when
+// the zone did not clear.
+func (r *OrderRepository) GetAuctionZonePrices(auctionID, period int) ([]models.ZonePrice, error) {
+	query := `
+		SELECT z.*, r.clearing_price AS last_price,
+			CASE WHEN r.clearing_price IS NOT NULL THEN r.created_at END AS last_trade_at
+		FROM bidding_zones z
+		LEFT JOIN auction_results r ON r.zone_id = z.id AND r.auction_id = $1 AND r.delivery_period = $2
+		ORDER BY z.id ASC`
+
+	var prices []models.ZonePrice
+	err := r.db.Select(&prices, query, auctionID, period)
+	return prices, err
+}
+
+// GetTransmissionCapacities returns the capacity between every pair of
+// connected zones for a product (nil for the undated market). Products that
+// have not traded across zones yet still have the full capacity.
+func (r *OrderRepository) GetTransmissionCapacities(productID *int) ([]models.TransmissionCapacity, error) {
+	query := `
+		SELECT c.from_zone_id, f.code AS from_zone, c.to_zone_id, t.code AS to_zone,
+			$1::int AS product_id, c.capacity_mwh,
+			COALESCE(p.remaining_mwh, CASE WHEN $1::int IS NULL THEN c.remaining_mwh ELSE c.capacity_mwh END) AS remaining_mwh,
+			COALESCE(p.updated_at, c.updated_at) AS updated_at
+		FROM transmission_capacities c
+		JOIN bidding_zones f ON f.id = c.from_zone_id
+		JOIN bidding_zones t ON t.id = c.to_zone_id
+		LEFT JOIN transmission_capacities p
+			ON p.from_zone_id = c.from_zone_id AND p.to_zone_id = c.to_zone_id AND p.product_id = $1::int
+		WHERE c.product_id IS NULL
+		ORDER BY c.from_zone_id ASC, c.to_zone_id ASC`
+
+	var capacities []models.TransmissionCapacity
+	err := r.db.Select(&capacities, query, productID)
+	return capacities, err
+}
+
+// GetAuctionCapacities returns the capacity between every pair of connected
+// zones in a delivery period of an auction, less what the auction used. It is
+// empty until the auction has cleared.
+func (r *OrderRepository) GetAuctionCapacities(auctionID, period int) ([]models.TransmissionCapacity, error) {
+	query := `
+		SELECT a.from_zone_id, f.code AS from_zone, a.to_zone_id, t.code AS to_zone,
+			NULL::int AS product_id, a.capacity_mwh, a.capacity_mwh - a.flow_mwh AS remaining_mwh,
+			a.created_at AS updated_at
+		FROM auction_flows a
+		JOIN bidding_zones f ON f.id = a.from_zone_id
+		JOIN bidding_zones t ON t.id = a.to_zone_id
+		WHERE a.auction_id = $1 AND a.delivery_period = $2
+		ORDER BY a.from_zone_id ASC, a.to_zone_id ASC`
+
+	capacities := []models.TransmissionCapacity{}
+	err := r.db.Select(&capacities, query, auctionID, period)
+	return capacities, err
+}
+
+// LockTransmissionCapacity returns the capacity from one zone into another
+// for a product (nil for the undated market) and locks it, creating the
+// product's row from the default capacity first. It returns nil when the
+// zones are not connected.
+func (r *OrderRepository) LockTransmissionCapacity(fromZoneID, toZoneID int, productID *int) (*models.TransmissionCapacity, error) {
+	if productID != nil {
+		_, err := r.db.Exec(`
+			INSERT INTO transmission_capacities (from_zone_id, to_zone_id, product_id, capacity_mwh, remaining_mwh, updated_at)
+			SELECT from_zone_id, to_zone_id, $3, capacity_mwh, capacity_mwh, $4
+			FROM transmission_capacities
+			WHERE from_zone_id = $1 AND to_zone_id = $2 AND product_id IS NULL
+			ON CONFLICT (from_zone_id, to_zone_id, COALESCE(product_id, 0)) DO NOTHING`,
+			fromZoneID, toZoneID, *productID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	query := `
+		SELECT c.from_zone_id, f.code AS from_zone, c.to_zone_id, t.code AS to_zone,
+			c.product_id, c.capacity_mwh, c.remaining_mwh, c.updated_at
+		FROM transmission_capacities c
+		JOIN bidding_zones f ON f.id = c.from_zone_id
+		JOIN bidding_zones t ON t.id = c.to_zone_id
+		WHERE c.from_zone_id = $1 AND c.to_zone_id = $2 AND c.product_id IS NOT DISTINCT FROM $3
+		FOR UPDATE OF c`
+
+	var capacity models.TransmissionCapacity
+	err := r.db.Get(&capacity, query, fromZoneID, toZoneID, productID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &capacity, nil
+}
+
+// UseTransmissionCapacity takes amountMWh off the remaining capacity from
+// one zone into another for a product.
+func (r *OrderRepository) UseTransmissionCapacity(fromZoneID, toZoneID int, productID *int, amountMWh float64) error {
+	query := `
+		UPDATE transmission_capacities
+		SET remaining_mwh = remaining_mwh - $4, updated_at = $5
+		WHERE from_zone_id = $1 AND to_zone_id = $2 AND product_id IS NOT DISTINCT FROM $3`
+
+	_, err := r.db.Exec(query, fromZoneID, toZoneID, productID, amountMWh, time.Now())
+	return err
+}
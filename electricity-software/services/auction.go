@@ -0,0 +1,468 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// auctionPeriods is the number of hourly delivery periods of an auction day.
+const auctionPeriods = 24
+
+// auctionDaysAhead is how many delivery days ahead auctions are opened.
+const auctionDaysAhead = 2
+
+// RunAuctionWorker opens upcoming day-ahead auctions and clears those whose
+// gate has closed, every interval until ctx is canceled. It is meant to run
+// in its own goroutine.
+func (s *OrderService) RunAuctionWorker(ctx context.Context, interval time.Duration) {
+	s.runAuctions(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runAuctions(now)
+		}
+	}
+}
+
+func (s *OrderService) runAuctions(now time.Time) {
+	if err := s.ScheduleAuctions(now); err != nil {
+		log.Printf("Failed to schedule auctions: %v", err)
+	}
+	if err := s.ClearDueAuctions(now); err != nil {
+		log.Printf("Failed to clear auctions: %v", err)
+	}
+}
+
+// ScheduleAuctions makes sure an auction exists for each of the next delivery
+// days whose gate is still open. Gate closure is AUCTION_GATE_CLOSURE after
+// midnight UTC on the day before delivery.
+func (s *OrderService) ScheduleAuctions(now time.Time) error {
+	today := now.UTC().Truncate(24 * time.Hour)
+	for days := 1; days <= auctionDaysAhead; days++ {
+		deliveryDate := today.AddDate(0, 0, days)
+		gateClosureAt := deliveryDate.AddDate(0, 0, -1).Add(s.cfg.AuctionGateClosure)
+		if !gateClosureAt.After(now) {
+			continue
+		}
+
+		err := s.orderRepo.EnsureAuction(deliveryDate, auctionPeriods, gateClosureAt)
+		if err != nil {
+			return fmt.Errorf("failed to create auction for %s: %w", deliveryDate.Format("2006-01-02"), err)
+		}
+	}
+	return nil
+}
+
+// ClearDueAuctions clears every open auction whose gate has closed, each in
+// its own transaction.
+func (s *OrderService) ClearDueAuctions(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auctions, err := s.orderRepo.GetDueAuctions(now)
+	if err != nil {
+		return fmt.Errorf("failed to get due auctions: %w", err)
+	}
+
+	for _, due := range auctions {
+		err = s.withTx(func(repo *repositories.OrderRepository) error {
+			auction, err := repo.LockAuctionByID(due.ID)
+			if err != nil {
+				return err
+			}
+			if auction.Status != models.AuctionStatusOpen {
+				return nil
+			}
+			return s.clearAuction(repo, auction)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to clear auction %d: %w", due.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// clearAuction clears every delivery period of the auction and publishes the
+// results.
+func (s *OrderService) clearAuction(repo *repositories.OrderRepository, auction *models.Auction) error {
+	orders, err := repo.LockAuctionOrders(auction.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction orders: %w", err)
+	}
+
+	// Block orders clear through their children, one in each period
+	byPeriod := make(map[int][]*models.Order)
+	legsOf := make(map[int][]*models.Order)
+	var blocks []*models.Order
+	for i := range orders {
+		order := &orders[i]
+		switch {
+		case order.IsBlock():
+			blocks = append(blocks, order)
+		case order.ParentOrderID != nil:
+			legsOf[*order.ParentOrderID] = append(legsOf[*order.ParentOrderID], order)
+		default:
+			byPeriod[*order.DeliveryPeriod] = append(byPeriod[*order.DeliveryPeriod], order)
+		}
+	}
+
+	// Every period gets the full capacity between the zones
+	capacities, err := repo.GetTransmissionCapacities(nil)
+	if err != nil {
+		return fmt.Errorf("failed to get transmission capacities: %w", err)
+	}
+	links := make([]zoneLink, len(capacities))
+	for i, capacity := range capacities {
+		links[i] = zoneLink{fromZoneID: capacity.FromZoneID, toZoneID: capacity.ToZoneID, capacityMWh: capacity.CapacityMWh}
+	}
+
+	legs := acceptBlocks(byPeriod, blocks, legsOf, links, s.cfg.LotSizeMWh)
+	for _, block := range blocks {
+		for _, leg := range legsOf[block.ID] {
+			if legs[leg.ID] {
+				byPeriod[*leg.DeliveryPeriod] = append(byPeriod[*leg.DeliveryPeriod], leg)
+			}
+		}
+	}
+
+	for period := 1; period <= auction.Periods; period++ {
+		err = s.clearPeriod(repo, auction, period, byPeriod[period], legs, links)
+		if err != nil {
+			return fmt.Errorf("failed to clear period %d: %w", period, err)
+		}
+	}
+
+	// Accepted blocks have traded in every period, rejected ones not at all
+	for _, block := range blocks {
+		err = s.closeBlock(repo, block, legsOf[block.ID], models.CancelReasonAuction)
+		if err != nil {
+			return fmt.Errorf("failed to settle block order %d: %w", block.ID, err)
+		}
+	}
+
+	return repo.MarkAuctionCleared(auction.ID, time.Now())
+}
+
+// clearPeriod clears one delivery period, every bidding zone at its own
+// price with the flows between the zones limited by their capacity (see
+// periodCoupling). Within a zone, children of accepted block orders (legs)
+// and orders priced better than the clearing price are accepted in full,
+// orders at the price in time priority up to the cleared volume. Accepted
+// orders trade at the price of their zone, those left over in a zone that
+// exports with orders in the zones it sends energy to, at the price of the
+// buyer's zone. The rest is canceled and its hold released.
+func (s *OrderService) clearPeriod(repo *repositories.OrderRepository, auction *models.Auction, period int, orders []*models.Order, legs map[int]bool, links []zoneLink) error {
+	coupling := newPeriodCoupling(orders, legs, links, s.cfg.LotSizeMWh)
+	coupling.couple()
+	clearings := coupling.clear()
+
+	for _, zone := range coupling.zones {
+		clearing := clearings[zone]
+		result := &models.AuctionResult{
+			AuctionID:      auction.ID,
+			DeliveryPeriod: period,
+			DemandMWh:      totalAmount(coupling.buys[zone]),
+			SupplyMWh:      totalAmount(coupling.sells[zone]),
+		}
+		if zone != 0 {
+			result.ZoneID = &zone
+		}
+		if clearing.ok {
+			result.ClearingPrice = &clearing.price
+			result.ClearedVolumeMWh = clearing.volumeMWh
+		}
+
+		err := repo.CreateAuctionResult(result)
+		if err != nil {
+			return fmt.Errorf("failed to store auction result: %w", err)
+		}
+	}
+
+	err := s.settlePeriod(repo, coupling, clearings)
+	if err != nil {
+		return err
+	}
+
+	for i, link := range links {
+		flow := &models.AuctionFlow{
+			AuctionID:      auction.ID,
+			DeliveryPeriod: period,
+			FromZoneID:     link.fromZoneID,
+			ToZoneID:       link.toZoneID,
+			CapacityMWh:    link.capacityMWh,
+			FlowMWh:        coupling.flows[i],
+		}
+		err = repo.CreateAuctionFlow(flow)
+		if err != nil {
+			return fmt.Errorf("failed to store auction flow: %w", err)
+		}
+	}
+
+	for _, order := range orders {
+		if order.Status.Resting() {
+			err = s.cancelRemainder(repo, order, models.CancelReasonAuction)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// auctionFill is the amount of an order an auction accepted and that has not
+// traded yet.
+type auctionFill struct {
+	order     *models.Order
+	amountMWh float64
+}
+
+// acceptedFills hands volumeMWh out to orders of one side of a zone: block
+// legs and then the best prices first, orders are already in time priority.
+func acceptedFills(orders []*models.Order, legs map[int]bool, volumeMWh float64) []auctionFill {
+	sorted := append([]*models.Order(nil), orders...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if legs[sorted[i].ID] != legs[sorted[j].ID] {
+			return legs[sorted[i].ID]
+		}
+		if sorted[i].OrderType == models.OrderTypeBuy {
+			return sorted[i].PriceEurPerMWh > sorted[j].PriceEurPerMWh
+		}
+		return sorted[i].PriceEurPerMWh < sorted[j].PriceEurPerMWh
+	})
+
+	var fills []auctionFill
+	for _, order := range sorted {
+		if volumeMWh <= 0 {
+			break
+		}
+		amount := math.Min(volumeMWh, order.AmountMWh)
+		fills = append(fills, auctionFill{order: order, amountMWh: amount})
+		volumeMWh = roundAmount(volumeMWh - amount)
+	}
+	return fills
+}
+
+// settlePeriod trades what the zones of a period accepted. Buyers and
+// sellers of a zone trade with each other at the zone price first, then the
+// sellers left in exporting zones trade with the buyers left in importing
+// zones along the flows, at the price of the buyer's zone.
+func (s *OrderService) settlePeriod(repo *repositories.OrderRepository, coupling *periodCoupling, clearings map[int]zoneClearing) error {
+	buys := make(map[int][]auctionFill)
+	sells := make(map[int][]auctionFill)
+	for _, zone := range coupling.zones {
+		clearing := clearings[zone]
+		if !clearing.ok {
+			continue
+		}
+
+		// The flow into a zone takes the place of sellers, the flow out of
+		// it that of buyers
+		buyVolume, sellVolume := clearing.volumeMWh, clearing.volumeMWh
+		if net := coupling.netImport(zone); net > 0 {
+			sellVolume = roundAmount(sellVolume - net)
+		} else {
+			buyVolume = roundAmount(buyVolume + net)
+		}
+
+		zoneBuys := acceptedFills(coupling.buys[zone], coupling.legs, buyVolume)
+		zoneSells := acceptedFills(coupling.sells[zone], coupling.legs, sellVolume)
+		_, err := s.settleFills(repo, &zoneBuys, &zoneSells, math.Min(buyVolume, sellVolume), clearing.price)
+		if err != nil {
+			return err
+		}
+		buys[zone], sells[zone] = zoneBuys, zoneSells
+	}
+
+	remaining := append([]float64(nil), coupling.flows...)
+	for _, from := range coupling.zones {
+		for len(sells[from]) > 0 {
+			path, to, ok := coupling.flowPath(from, remaining, func(zone int) bool { return len(buys[zone]) > 0 })
+			if !ok {
+				break
+			}
+
+			volume := math.Inf(1)
+			for _, link := range path {
+				volume = math.Min(volume, remaining[link])
+			}
+			zoneBuys, zoneSells := buys[to], sells[from]
+			traded, err := s.settleFills(repo, &zoneBuys, &zoneSells, volume, clearings[to].price)
+			if err != nil {
+				return err
+			}
+			buys[to], sells[from] = zoneBuys, zoneSells
+
+			for _, link := range path {
+				remaining[link] = roundAmount(remaining[link] - traded)
+			}
+			if traded <= 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// settleFills trades up to volumeMWh off the front of the accepted buy and
+// sell amounts at priceEurPerMWh and returns what it traded. Amounts that are
+// used up are taken off the queues.
+func (s *OrderService) settleFills(repo *repositories.OrderRepository, buys, sells *[]auctionFill, volumeMWh, priceEurPerMWh float64) (float64, error) {
+	traded := 0.0
+	for volumeMWh > 0 && len(*buys) > 0 && len(*sells) > 0 {
+		buy, sell := &(*buys)[0], &(*sells)[0]
+		amount := math.Min(volumeMWh, math.Min(buy.amountMWh, sell.amountMWh))
+
+		_, err := s.executeFill(repo, buy.order, sell.order, nil, amount, priceEurPerMWh)
+		if err != nil {
+			return traded, err
+		}
+
+		for _, order := range []*models.Order{buy.order, sell.order} {
+			recordFill(order, amount, priceEurPerMWh)
+			err = s.updateRemaining(repo, order, roundAmount(order.AmountMWh-amount))
+			if err != nil {
+				return traded, fmt.Errorf("failed to update auction order: %w", err)
+			}
+		}
+
+		buy.amountMWh = roundAmount(buy.amountMWh - amount)
+		sell.amountMWh = roundAmount(sell.amountMWh - amount)
+		volumeMWh = roundAmount(volumeMWh - amount)
+		traded = roundAmount(traded + amount)
+		if buy.amountMWh <= 0 {
+			*buys = (*buys)[1:]
+		}
+		if sell.amountMWh <= 0 {
+			*sells = (*sells)[1:]
+		}
+	}
+	return traded, nil
+}
+
+// clearingPrice finds the price at which the most volume trades, given the
+// buy and sell orders of one period. Among prices with the same volume the
+// one with the smallest surplus of supply or demand wins, and if several are
+// left the middle one is taken. Orders in legs trade at any price and do not
+// set it. ok is false when the curves do not cross.
+func clearingPrice(buys, sells []*models.Order, legs map[int]bool) (price float64, volumeMWh float64, ok bool) {
+	demandAt := make(map[int64]float64)
+	supplyAt := make(map[int64]float64)
+	seen := make(map[int64]bool)
+	var keys []int64
+	supply := 0.0
+	for _, order := range append(append([]*models.Order(nil), buys...), sells...) {
+		if legs[order.ID] {
+			if order.OrderType == models.OrderTypeSell {
+				supply = roundAmount(supply + order.AmountMWh)
+			}
+			continue
+		}
+
+		key := priceKey(order.PriceEurPerMWh)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		if order.OrderType == models.OrderTypeBuy {
+			demandAt[key] += order.AmountMWh
+		} else {
+			supplyAt[key] += order.AmountMWh
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	// Walking up the prices, supply grows and demand shrinks
+	demand := totalAmount(buys)
+	bestVolume, bestSurplus := 0.0, 0.0
+	var best []int64
+	for _, key := range keys {
+		supply = roundAmount(supply + supplyAt[key])
+		volume := math.Min(demand, supply)
+		surplus := roundAmount(math.Abs(demand - supply))
+
+		switch {
+		case volume > bestVolume || (volume == bestVolume && surplus < bestSurplus):
+			bestVolume, bestSurplus = volume, surplus
+			best = []int64{key}
+		case volume == bestVolume && surplus == bestSurplus:
+			best = append(best, key)
+		}
+
+		// Buyers at this price are not willing to pay the next one
+		demand = roundAmount(demand - demandAt[key])
+	}
+
+	if bestVolume <= 0 {
+		return 0, 0, false
+	}
+	return float64(best[(len(best)-1)/2]) / 100, bestVolume, true
+}
+
+func totalAmount(orders []*models.Order) float64 {
+	total := 0.0
+	for _, order := range orders {
+		total = roundAmount(total + order.AmountMWh)
+	}
+	return total
+}
+
+// checkAuctionOrder makes sure an order can still be placed into or canceled
+// from its auction.
+func (s *OrderService) checkAuctionOrder(repo *repositories.OrderRepository, order *models.Order) error {
+	auction, err := repo.GetAuctionByID(*order.AuctionID)
+	if err != nil {
+		return fmt.Errorf("auction not found: %w", err)
+	}
+	if auction.Status != models.AuctionStatusOpen || !auction.GateClosureAt.After(time.Now()) {
+		return errors.New("auction gate has closed")
+	}
+	if order.DeliveryPeriod != nil && *order.DeliveryPeriod > auction.Periods {
+		return fmt.Errorf("delivery_period must be between 1 and %d", auction.Periods)
+	}
+	if order.IsBlock() && *order.BlockLastPeriod > auction.Periods {
+		return fmt.Errorf("block_last_period must be at most %d", auction.Periods)
+	}
+	return nil
+}
+
+func (s *OrderService) GetAuctions(filter models.AuctionFilter) ([]models.Auction, error) {
+	return s.orderRepo.GetAuctions(filter)
+}
+
+func (s *OrderService) GetAuctionByID(id int) (*models.Auction, error) {
+	return s.orderRepo.GetAuctionByID(id)
+}
+
+// GetAuctionResults returns the clearing price and volume of every delivery
+// period and zone with the flows between the zones, once the auction has
+// cleared.
+func (s *OrderService) GetAuctionResults(auction *models.Auction) ([]models.AuctionResult, []models.AuctionFlow, error) {
+	if auction.Status != models.AuctionStatusCleared {
+		return nil, nil, errors.New("auction has not cleared yet")
+	}
+
+	results, err := s.orderRepo.GetAuctionResults(auction.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	flows, err := s.orderRepo.GetAuctionFlows(auction.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return results, flows, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+
+	"my-go-project/models"
+)
+
+func orderRef(id int, orderType models.OrderType, price, amount float64) *models.Order {
+	order := bookOrder(id, orderType, price, amount)
+	return &order
+}
+
+func TestClearingPrice(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+
+	tests := []struct {
+		name       string
+		buys       []*models.Order
+		sells      []*models.Order
+		legs       map[int]bool
+		wantPrice  float64
+		wantVolume float64
+		wantOK     bool
+	}{
+		{
+			name:  "curves do not cross",
+			buys:  []*models.Order{orderRef(1, buy, 40, 10)},
+			sells: []*models.Order{orderRef(2, sell, 60, 10)},
+		},
+		{
+			name:       "the price with the most volume wins",
+			buys:       []*models.Order{orderRef(1, buy, 70, 5), orderRef(2, buy, 50, 5)},
+			sells:      []*models.Order{orderRef(3, sell, 40, 4), orderRef(4, sell, 60, 6)},
+			wantPrice:  60,
+			wantVolume: 5,
+			wantOK:     true,
+		},
+		{
+			name:       "equal volume goes to the smallest surplus",
+			buys:       []*models.Order{orderRef(1, buy, 60, 10)},
+			sells:      []*models.Order{orderRef(2, sell, 40, 10), orderRef(3, sell, 50, 5)},
+			wantPrice:  40,
+			wantVolume: 10,
+			wantOK:     true,
+		},
+		{
+			name:       "an even number of equal prices takes the lower middle one",
+			buys:       []*models.Order{orderRef(1, buy, 60, 10)},
+			sells:      []*models.Order{orderRef(2, sell, 40, 10)},
+			wantPrice:  40,
+			wantVolume: 10,
+			wantOK:     true,
+		},
+		{
+			name:       "prices are compared in whole cents",
+			buys:       []*models.Order{orderRef(1, buy, 50.004, 3), orderRef(2, buy, 50, 2)},
+			sells:      []*models.Order{orderRef(3, sell, 49.996, 5)},
+			wantPrice:  50,
+			wantVolume: 5,
+			wantOK:     true,
+		},
+		{
+			name:       "sell legs trade at any price and do not set it",
+			buys:       []*models.Order{orderRef(1, buy, 50, 10)},
+			sells:      []*models.Order{orderRef(2, sell, 90, 10)},
+			legs:       map[int]bool{2: true},
+			wantPrice:  50,
+			wantVolume: 10,
+			wantOK:     true,
+		},
+		{
+			name:       "buy legs trade at any price and do not set it",
+			buys:       []*models.Order{orderRef(1, buy, 10, 10)},
+			sells:      []*models.Order{orderRef(2, sell, 45, 10)},
+			legs:       map[int]bool{1: true},
+			wantPrice:  45,
+			wantVolume: 10,
+			wantOK:     true,
+		},
+		{
+			name:  "legs alone set no price",
+			buys:  []*models.Order{orderRef(1, buy, 50, 10)},
+			sells: []*models.Order{orderRef(2, sell, 40, 10)},
+			legs:  map[int]bool{1: true, 2: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, volume, ok := clearingPrice(tt.buys, tt.sells, tt.legs)
+			if ok != tt.wantOK || price != tt.wantPrice || volume != tt.wantVolume {
+				t.Errorf("clearingPrice() = %v, %v, %v, want %v, %v, %v", price, volume, ok, tt.wantPrice, tt.wantVolume, tt.wantOK)
+			}
+		})
+	}
+}
@@ -2,39 +2,56 @@ package services
 
 import (
 	"errors"
+	"fmt"
 
+	"my-go-project/models"
 	"my-go-project/repositories"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService interface {
-	Register(name, email, password string) (int, error)
+	Register(name, email, password, zone string) (int, error)
 	Login(email, password string) (int, error)
-	GetUserEnergy(userID int) (float64, error)
-	GetUserMoney(userID int) (float64, error)
+	GetUserBalance(userID int) (*models.Balance, error)
+	GetUser(userID int) (*repositories.User, error)
+	SetSTPMode(userID int, mode *models.STPMode) error
+	GetBiddingZone(zoneID int) (*models.BiddingZone, error)
 }
 
 type authService struct {
-	userRepo repositories.UserRepository
+	userRepo    repositories.UserRepository
+	defaultZone string
 }
 
-func NewAuthService(userRepo repositories.UserRepository) AuthService {
-	return &authService{userRepo: userRepo}
+// NewAuthService creates the service, users who do not pick a bidding zone
+// when registering are placed in defaultZone.
+func NewAuthService(userRepo repositories.UserRepository, defaultZone string) AuthService {
+	return &authService{userRepo: userRepo, defaultZone: defaultZone}
 }
 
-func (s *authService) Register(name, email, password string) (int, error) {
+// Register creates a user in the bidding zone with the given code, the
+// default zone when empty.
+func (s *authService) Register(name, email, password, zone string) (int, error) {
 	existingUser, _ := s.userRepo.GetUserByEmail(email)
 	if existingUser != nil {
 		return 0, errors.New("email already in use")
 	}
 
+	if zone == "" {
+		zone = s.defaultZone
+	}
+	biddingZone, err := s.userRepo.GetBiddingZoneByCode(zone)
+	if err != nil {
+		return 0, fmt.Errorf("unknown bidding zone %q", zone)
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, err
 	}
 
-	return s.userRepo.CreateUser(name, email, string(hashedPassword))
+	return s.userRepo.CreateUser(name, email, string(hashedPassword), biddingZone.ID)
 }
 
 func (s *authService) Login(email, password string) (int, error) {
@@ -51,10 +68,20 @@ func (s *authService) Login(email, password string) (int, error) {
 	return user.ID, nil
 }
 
-func (s *authService) GetUserEnergy(userID int) (float64, error) {
-	return s.userRepo.GetUserEnergy(userID)
+func (s *authService) GetUserBalance(userID int) (*models.Balance, error) {
+	return s.userRepo.GetUserBalance(userID)
+}
+
+func (s *authService) GetUser(userID int) (*repositories.User, error) {
+	return s.userRepo.GetUserByID(userID)
+}
+
+// SetSTPMode sets the account's default self-trade prevention mode, nil
+// falls back to the server default.
+func (s *authService) SetSTPMode(userID int, mode *models.STPMode) error {
+	return s.userRepo.UpdateSTPMode(userID, mode)
 }
 
-func (s *authService) GetUserMoney(userID int) (float64, error) {
-	return s.userRepo.GetUserMoney(userID)
+func (s *authService) GetBiddingZone(zoneID int) (*models.BiddingZone, error) {
+	return s.userRepo.GetBiddingZoneByID(zoneID)
 }
@@ -0,0 +1,405 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// placeBlock creates the per-period children of a new block order, each
+// holding what its period needs. An auction block then waits for the
+// clearing, in the continuous market the children trade in the hourly
+// products of their periods and the block tries to match straight away.
+func (s *OrderService) placeBlock(repo *repositories.OrderRepository, block *models.Order, result *matchResult) error {
+	var products []int
+	if block.AuctionID == nil {
+		var err error
+		products, err = s.blockProducts(repo, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	var legs []*models.Order
+	for period := *block.BlockFirstPeriod; period <= *block.BlockLastPeriod; period++ {
+		leg := &models.Order{
+			UserID:            block.UserID,
+			OrderType:         block.OrderType,
+			OrderKind:         block.OrderKind,
+			AmountMWh:         block.AmountMWh,
+			OriginalAmountMWh: block.AmountMWh,
+			PriceEurPerMWh:    block.PriceEurPerMWh,
+			TimeInForce:       block.TimeInForce,
+			AuctionID:         block.AuctionID,
+			ZoneID:            block.ZoneID,
+			DeliveryPeriod:    &period,
+			ParentOrderID:     &block.ID,
+			STPMode:           block.STPMode,
+			Status:            block.Status,
+		}
+		if products != nil {
+			leg.ProductID = &products[period-*block.BlockFirstPeriod]
+		}
+
+		err := s.reserveHold(repo, leg, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		err = repo.CreateOrder(leg)
+		if err != nil {
+			return fmt.Errorf("failed to create block order for period %d: %w", period, err)
+		}
+		legs = append(legs, leg)
+	}
+
+	if block.AuctionID != nil {
+		return nil
+	}
+	return s.matchBlock(repo, block, legs, result)
+}
+
+// blockProducts returns the hourly products a continuous block order trades
+// in, one per period. The block names the daily product of its delivery day
+// and period p is the hour starting p-1 hours into that day, which must lie
+// within the daily product and still be trading.
+func (s *OrderService) blockProducts(repo *repositories.OrderRepository, block *models.Order) ([]int, error) {
+	daily, err := repo.GetProductByID(*block.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("product not found: %w", err)
+	}
+	if daily.ProductType != models.ProductTypeDailyBase && daily.ProductType != models.ProductTypeDailyPeak {
+		return nil, errors.New("block orders trade under a daily_base or daily_peak product")
+	}
+
+	now := time.Now()
+	day := daily.DeliveryStart.UTC().Truncate(24 * time.Hour)
+	var products []int
+	for period := *block.BlockFirstPeriod; period <= *block.BlockLastPeriod; period++ {
+		start := day.Add(time.Duration(period-1) * time.Hour)
+		if start.Before(daily.DeliveryStart) || !start.Before(daily.DeliveryEnd) {
+			return nil, fmt.Errorf("block period %d is outside the delivery of %s", period, daily.Code)
+		}
+
+		hourly, err := repo.GetProductByDelivery(models.ProductTypeHourly, start)
+		if err != nil {
+			return nil, fmt.Errorf("no hourly product for block period %d: %w", period, err)
+		}
+		if !hourly.Trading(now) {
+			return nil, fmt.Errorf("gate has closed for block period %d", period)
+		}
+		products = append(products, hourly.ID)
+	}
+	return products, nil
+}
+
+// blockFill is a trade a leg of a block order would make with a resting
+// order.
+type blockFill struct {
+	leg       *models.Order
+	resting   *models.Order
+	capacity  *zoneCapacity
+	amountMWh float64
+}
+
+// matchBlock trades a continuous block order against the books of the
+// hourly products of its periods, all or none. Each leg takes the resting
+// orders of its product in price-time priority, at their own prices, until
+// it has the block amount. The block trades only if every leg fills
+// completely and the average price of all the fills is within its limit,
+// otherwise nothing trades and the block waits for MatchBlockOrders. A
+// resting order of the same user goes through self-trade prevention with the
+// leg as the incoming order, and a mode that cancels or reduces the leg
+// cancels the whole block.
+func (s *OrderService) matchBlock(repo *repositories.OrderRepository, block *models.Order, legs []*models.Order, result *matchResult) error {
+	now := time.Now()
+	for _, leg := range legs {
+		state, _, err := s.marketState(repo, leg.ProductID, now)
+		if err != nil {
+			return err
+		}
+		if state != models.MarketStateOpen {
+			return nil
+		}
+	}
+
+	var fills []blockFill
+	for _, leg := range legs {
+		legFills, ok, err := s.planLeg(repo, leg, now, result)
+		if err != nil {
+			return err
+		}
+		if leg.STPAction != nil {
+			block.STPAction = leg.STPAction
+			return s.closeBlock(repo, block, legs, models.CancelReasonSelfTrade)
+		}
+		if !ok {
+			return nil
+		}
+		fills = append(fills, legFills...)
+	}
+	if !blockCrosses(block, blockAverage(fills)) {
+		return nil
+	}
+
+	// Legs are reduced after each fill, executeFill works out the hold
+	// released from the amount before it
+	aggressor := block.OrderType
+	for _, fill := range fills {
+		buy, sell := fill.leg, fill.resting
+		if block.OrderType == models.OrderTypeSell {
+			buy, sell = fill.resting, fill.leg
+		}
+
+		price := fill.resting.PriceEurPerMWh
+		trade, err := s.executeFill(repo, buy, sell, &aggressor, fill.amountMWh, price)
+		if err != nil {
+			return err
+		}
+		err = fill.capacity.use(repo, fill.resting, fill.amountMWh)
+		if err != nil {
+			return err
+		}
+		result.trades = append(result.trades, *trade)
+		recordFill(fill.leg, fill.amountMWh, price)
+		recordFill(fill.resting, fill.amountMWh, price)
+		fill.leg.AmountMWh = roundAmount(fill.leg.AmountMWh - fill.amountMWh)
+
+		consumeTranche(fill.resting, fill.amountMWh, now)
+		err = s.updateRemaining(repo, fill.resting, roundAmount(fill.resting.AmountMWh-fill.amountMWh))
+		if err != nil {
+			return fmt.Errorf("failed to update resting order: %w", err)
+		}
+		result.changed = append(result.changed, *fill.resting)
+	}
+
+	for _, leg := range legs {
+		err := s.updateRemaining(repo, leg, leg.AmountMWh)
+		if err != nil {
+			return fmt.Errorf("failed to update block order: %w", err)
+		}
+	}
+	recordFill(block, block.AmountMWh, blockAverage(fills))
+	return s.updateRemaining(repo, block, 0)
+}
+
+// planLeg picks the resting orders a leg of a block would trade with, up to
+// its amount. Expired orders and those beyond the circuit breaker's limit are
+// left alone, orders in other zones only offer the transmission capacity
+// left. ok is false when the book cannot fill the leg completely.
+func (s *OrderService) planLeg(repo *repositories.OrderRepository, leg *models.Order, now time.Time, result *matchResult) ([]blockFill, bool, error) {
+	breaker, err := s.newCircuitBreaker(repo, leg.ProductID, now)
+	if err != nil {
+		return nil, false, err
+	}
+	capacity := newZoneCapacity(leg, s.cfg.LotSizeMWh)
+
+	var fills []blockFill
+	needed := leg.AmountMWh
+	for _, level := range s.books.Book(leg.ProductID).Levels(opposite(leg.OrderType)) {
+		for _, candidate := range level {
+			if needed <= 0 {
+				return fills, true, nil
+			}
+			if isExpired(&candidate, now) {
+				continue
+			}
+			if !breaker.allows(candidate.PriceEurPerMWh) {
+				return nil, false, nil
+			}
+
+			resting, err := repo.LockOrderByID(candidate.ID)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to lock resting order: %w", err)
+			}
+			if !resting.Status.Resting() {
+				continue
+			}
+
+			if resting.UserID == leg.UserID {
+				err = s.preventSelfTrade(repo, leg, resting, result)
+				if err != nil || leg.STPAction != nil {
+					return nil, false, err
+				}
+				continue
+			}
+
+			amount, err := capacity.limit(repo, resting, math.Min(needed, resting.AmountMWh))
+			if err != nil {
+				return nil, false, err
+			}
+			if amount <= 0 {
+				continue
+			}
+			capacity.take(resting, amount)
+			fills = append(fills, blockFill{leg: leg, resting: resting, capacity: capacity, amountMWh: amount})
+			needed = roundAmount(needed - amount)
+		}
+	}
+	return fills, needed <= 0, nil
+}
+
+// blockAverage is the volume-weighted average price of the fills of a block.
+// Every leg fills the same amount, so it is also the average over the
+// periods of their own average prices.
+func blockAverage(fills []blockFill) float64 {
+	totalEur, totalMWh := 0.0, 0.0
+	for _, fill := range fills {
+		totalEur += fill.amountMWh * fill.resting.PriceEurPerMWh
+		totalMWh += fill.amountMWh
+	}
+	if totalMWh == 0 {
+		return 0
+	}
+	return totalEur / totalMWh
+}
+
+// blockCrosses reports whether a block order accepts trading at an average
+// price: no more than its limit for a buy, no less for a sell.
+func blockCrosses(block *models.Order, average float64) bool {
+	if block.OrderType == models.OrderTypeBuy {
+		return average <= block.PriceEurPerMWh+1e-9
+	}
+	return average >= block.PriceEurPerMWh-1e-9
+}
+
+// MatchBlockOrders tries the resting block orders of the continuous market
+// again in time priority, as the books of their periods have changed since.
+func (s *OrderService) MatchBlockOrders() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blocks, err := s.orderRepo.GetRestingBlockOrders()
+	if err != nil {
+		return fmt.Errorf("failed to get block orders: %w", err)
+	}
+
+	for _, resting := range blocks {
+		var result matchResult
+		err = s.withTx(func(repo *repositories.OrderRepository) error {
+			block, err := repo.LockOrderByID(resting.ID)
+			if err != nil {
+				return err
+			}
+			if block.Status != models.OrderStatusOpen {
+				return nil
+			}
+
+			legs, err := repo.LockChildOrders(block.ID)
+			if err != nil {
+				return fmt.Errorf("failed to get block orders: %w", err)
+			}
+			return s.matchBlock(repo, block, orderRefs(legs), &result)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to match block order %d: %w", resting.ID, err)
+		}
+
+		s.syncBook(result.changed)
+	}
+	return nil
+}
+
+// closeBlock brings a block order in line with its children: completed at
+// their average price once every child has traded in full, otherwise the
+// children still resting are canceled together with the block.
+func (s *OrderService) closeBlock(repo *repositories.OrderRepository, block *models.Order, legs []*models.Order, reason models.CancelReason) error {
+	filled := len(legs) > 0
+	total := 0.0
+	for _, leg := range legs {
+		if leg.Status != models.OrderStatusCompleted {
+			filled = false
+			break
+		}
+		total += *leg.AvgFillPrice
+	}
+
+	if filled {
+		recordFill(block, block.AmountMWh, total/float64(len(legs)))
+		return s.updateRemaining(repo, block, 0)
+	}
+
+	for _, leg := range legs {
+		if leg.Status.Resting() {
+			err := s.cancelRemainder(repo, leg, reason)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return s.cancelRemainder(repo, block, reason)
+}
+
+// acceptBlocks decides which block orders an auction accepts, given the
+// single-period orders of each delivery period, the children of each block
+// and the links between the zones. Accepted blocks take part in the clearing
+// of their periods at any price. A block holds if it trades in full in every
+// period and the average clearing price of its zone over its periods is no
+// worse than its limit, otherwise the block furthest out of the money is
+// rejected and the periods are cleared again. It returns the IDs of the
+// children of the accepted blocks.
+func acceptBlocks(byPeriod map[int][]*models.Order, blocks []*models.Order, legsOf map[int][]*models.Order, links []zoneLink, lotMWh float64) map[int]bool {
+	accepted := append([]*models.Order(nil), blocks...)
+	for {
+		legs := make(map[int]bool)
+		legsByPeriod := make(map[int][]*models.Order)
+		for _, block := range accepted {
+			for _, leg := range legsOf[block.ID] {
+				legs[leg.ID] = true
+				legsByPeriod[*leg.DeliveryPeriod] = append(legsByPeriod[*leg.DeliveryPeriod], leg)
+			}
+		}
+
+		// Clear every period with blocks in it
+		clearings := make(map[int]map[int]zoneClearing)
+		for period, periodLegs := range legsByPeriod {
+			orders := append(append([]*models.Order(nil), byPeriod[period]...), periodLegs...)
+			coupling := newPeriodCoupling(orders, legs, links, lotMWh)
+			coupling.couple()
+			clearings[period] = coupling.clear()
+		}
+
+		// Find the block that is worst off, later blocks go first on a tie
+		worst, worstLoss := -1, 0.0
+		for i, block := range accepted {
+			loss := 0.0
+			total := 0.0
+			for period := *block.BlockFirstPeriod; period <= *block.BlockLastPeriod; period++ {
+				clearing := clearings[period][zoneKey(block)]
+				if !clearing.ok || !clearing.covered {
+					loss = math.Inf(1)
+					break
+				}
+				total += clearing.price
+			}
+			if !math.IsInf(loss, 1) {
+				average := total / float64(block.BlockPeriods())
+				loss = average - block.PriceEurPerMWh
+				if block.OrderType == models.OrderTypeSell {
+					loss = block.PriceEurPerMWh - average
+				}
+			}
+
+			if loss > 1e-9 && (worst < 0 || loss > worstLoss || (loss == worstLoss && block.PriorityAt.After(accepted[worst].PriorityAt))) {
+				worst, worstLoss = i, loss
+			}
+		}
+
+		if worst < 0 {
+			return legs
+		}
+		accepted = append(accepted[:worst], accepted[worst+1:]...)
+	}
+}
+
+func orderRefs(orders []models.Order) []*models.Order {
+	refs := make([]*models.Order, len(orders))
+	for i := range orders {
+		refs[i] = &orders[i]
+	}
+	return refs
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"my-go-project/models"
+)
+
+// blockRef returns a block order over the periods first to last with one leg
+// per period, the leg of period p having the ID id*100+p.
+func blockRef(id int, orderType models.OrderType, price, amount float64, first, last int) (*models.Order, []*models.Order) {
+	block := orderRef(id, orderType, price, amount)
+	block.BlockFirstPeriod = &first
+	block.BlockLastPeriod = &last
+
+	var legs []*models.Order
+	for period := first; period <= last; period++ {
+		leg := orderRef(id*100+period, orderType, price, amount)
+		leg.DeliveryPeriod = &period
+		leg.ParentOrderID = &block.ID
+		legs = append(legs, leg)
+	}
+	return block, legs
+}
+
+func TestAcceptBlocks(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+
+	type block struct {
+		id          int
+		orderType   models.OrderType
+		price       float64
+		amount      float64
+		first, last int
+	}
+
+	tests := []struct {
+		name     string
+		byPeriod map[int][]*models.Order
+		blocks   []block
+		want     []int
+	}{
+		{
+			name:     "in the money in every period",
+			byPeriod: map[int][]*models.Order{1: {orderRef(1, buy, 60, 10)}, 2: {orderRef(2, buy, 60, 10)}},
+			blocks:   []block{{10, sell, 50, 10, 1, 2}},
+			want:     []int{1001, 1002},
+		},
+		{
+			name:     "out of the money",
+			byPeriod: map[int][]*models.Order{1: {orderRef(1, buy, 60, 10)}, 2: {orderRef(2, buy, 60, 10)}},
+			blocks:   []block{{10, sell, 70, 10, 1, 2}},
+		},
+		{
+			name:     "the average price counts, not every period",
+			byPeriod: map[int][]*models.Order{1: {orderRef(1, buy, 60, 10)}, 2: {orderRef(2, buy, 50, 10)}},
+			blocks:   []block{{10, sell, 55, 10, 1, 2}},
+			want:     []int{1001, 1002},
+		},
+		{
+			name:     "a period that cannot take the whole block rejects it",
+			byPeriod: map[int][]*models.Order{1: {orderRef(1, buy, 60, 10)}, 2: {orderRef(2, buy, 60, 5)}},
+			blocks:   []block{{10, sell, 50, 10, 1, 2}},
+		},
+		{
+			name:     "buy blocks",
+			byPeriod: map[int][]*models.Order{3: {orderRef(1, sell, 40, 10)}},
+			blocks:   []block{{10, buy, 50, 10, 3, 3}},
+			want:     []int{1003},
+		},
+		{
+			name:     "the block furthest out of the money goes first",
+			byPeriod: map[int][]*models.Order{1: {orderRef(1, buy, 60, 10), orderRef(2, buy, 80, 10)}},
+			blocks:   []block{{10, sell, 62, 10, 1, 1}, {11, sell, 70, 10, 1, 1}},
+			want:     []int{1001},
+		},
+		{
+			name:     "the later of two equally bad blocks goes first",
+			byPeriod: map[int][]*models.Order{1: {orderRef(1, buy, 60, 10)}},
+			blocks:   []block{{10, sell, 50, 10, 1, 1}, {11, sell, 50, 10, 1, 1}},
+			want:     []int{1001},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var blocks []*models.Order
+			legsOf := make(map[int][]*models.Order)
+			for _, b := range tt.blocks {
+				order, legs := blockRef(b.id, b.orderType, b.price, b.amount, b.first, b.last)
+				blocks = append(blocks, order)
+				legsOf[order.ID] = legs
+			}
+
+			want := make(map[int]bool)
+			for _, id := range tt.want {
+				want[id] = true
+			}
+
+			got := acceptBlocks(tt.byPeriod, blocks, legsOf, nil, 0.1)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("acceptBlocks() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBlockAverage(t *testing.T) {
+	fill := func(price, amount float64) blockFill {
+		return blockFill{resting: orderRef(1, models.OrderTypeSell, price, amount), amountMWh: amount}
+	}
+
+	tests := []struct {
+		name  string
+		fills []blockFill
+		want  float64
+	}{
+		{"no fills", nil, 0},
+		{"one fill per period", []blockFill{fill(48, 1), fill(52, 1)}, 50},
+		{"weighted by amount", []blockFill{fill(45, 0.5), fill(47, 0.5), fill(54, 1)}, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockAverage(tt.fills); got != tt.want {
+				t.Errorf("blockAverage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockCrosses(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+
+	tests := []struct {
+		name      string
+		orderType models.OrderType
+		average   float64
+		want      bool
+	}{
+		{"buy below the limit", buy, 49, true},
+		{"buy at the limit", buy, 50, true},
+		{"buy above the limit", buy, 50.01, false},
+		{"sell above the limit", sell, 51, true},
+		{"sell at the limit", sell, 50, true},
+		{"sell below the limit", sell, 49.99, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockCrosses(orderRef(1, tt.orderType, 50, 1), tt.average); got != tt.want {
+				t.Errorf("blockCrosses(%v) = %v, want %v", tt.average, got, tt.want)
+			}
+		})
+	}
+}
+
+// tomorrowProducts schedules the products and returns tomorrow's daily base
+// and daily peak products and its hourly products by block period.
+func tomorrowProducts(t *testing.T, s *OrderService) (base, peak int, hourly map[int]*int) {
+	t.Helper()
+
+	err := s.ScheduleProducts(time.Now())
+	if err != nil {
+		t.Fatalf("ScheduleProducts() failed: %v", err)
+	}
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	product := func(productType models.ProductType, start time.Time) *models.Product {
+		found, err := s.orderRepo.GetProductByDelivery(productType, start)
+		if err != nil {
+			t.Fatalf("no %s product starting at %s: %v", productType, start, err)
+		}
+		return found
+	}
+
+	hourly = make(map[int]*int)
+	for period := 1; period <= 24; period++ {
+		hourly[period] = &product(models.ProductTypeHourly, day.Add(time.Duration(period-1)*time.Hour)).ID
+	}
+	return product(models.ProductTypeDailyBase, day).ID, product(models.ProductTypeDailyPeak, day.Add(8*time.Hour)).ID, hourly
+}
+
+func blockOrder(orderType models.OrderType, price, amount float64, productID, first, last int) models.CreateOrderRequest {
+	req := limitOrder(orderType, price, amount)
+	req.ProductID = &productID
+	req.BlockFirstPeriod = &first
+	req.BlockLastPeriod = &last
+	return req
+}
+
+func TestContinuousBlockOrders(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+
+	type resting struct {
+		own    bool
+		period int
+		price  float64
+		amount float64
+	}
+
+	tests := []struct {
+		name       string
+		orderType  models.OrderType
+		stpMode    models.STPMode
+		resting    []resting
+		wantPrices []float64
+		wantStatus models.OrderStatus
+		wantReason *models.CancelReason
+	}{
+		{
+			name:       "trades when every period fills within the average",
+			orderType:  buy,
+			resting:    []resting{{false, 9, 48, 1}, {false, 10, 52, 1}},
+			wantPrices: []float64{48, 52},
+			wantStatus: models.OrderStatusCompleted,
+		},
+		{
+			name:       "fills over several levels of a period",
+			orderType:  buy,
+			resting:    []resting{{false, 9, 47, 1}, {false, 9, 45, 0.5}, {false, 10, 54, 1}},
+			wantPrices: []float64{45, 47, 54},
+			wantStatus: models.OrderStatusCompleted,
+		},
+		{
+			name:       "sell blocks",
+			orderType:  sell,
+			resting:    []resting{{false, 9, 52, 1}, {false, 10, 48, 1}},
+			wantPrices: []float64{52, 48},
+			wantStatus: models.OrderStatusCompleted,
+		},
+		{
+			name:       "an average beyond the limit rests",
+			orderType:  buy,
+			resting:    []resting{{false, 9, 49, 1}, {false, 10, 52, 1}},
+			wantStatus: models.OrderStatusOpen,
+		},
+		{
+			name:       "a period that cannot fill rests",
+			orderType:  buy,
+			resting:    []resting{{false, 9, 40, 1}, {false, 10, 40, 0.5}},
+			wantStatus: models.OrderStatusOpen,
+		},
+		{
+			name:       "an own order cancels the newest block",
+			orderType:  buy,
+			resting:    []resting{{true, 9, 48, 1}, {false, 9, 48, 1}, {false, 10, 52, 1}},
+			wantStatus: models.OrderStatusCanceled,
+			wantReason: reason(models.CancelReasonSelfTrade),
+		},
+		{
+			name:       "cancel_oldest clears the way for the block",
+			orderType:  buy,
+			stpMode:    models.STPCancelOldest,
+			resting:    []resting{{true, 9, 48, 1}, {false, 9, 48, 1}, {false, 10, 52, 1}},
+			wantPrices: []float64{48, 52},
+			wantStatus: models.OrderStatusCompleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			daily, _, hourly := tomorrowProducts(t, s)
+			trader := testUser(t, s, "trader", "BG", 10000, 100)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+
+			var own []*models.Order
+			for _, r := range tt.resting {
+				req := limitOrder(opposite(tt.orderType), r.price, r.amount)
+				req.ProductID = hourly[r.period]
+				if r.own {
+					own = append(own, placeOrder(t, s, trader, req))
+				} else {
+					placeOrder(t, s, maker, req)
+				}
+			}
+
+			req := blockOrder(tt.orderType, 50, 1, daily, 9, 10)
+			req.STPMode = tt.stpMode
+			block := placeOrder(t, s, trader, req)
+
+			var prices []float64
+			for _, trade := range storedTrades(t, s) {
+				prices = append(prices, trade.PriceEurPerMWh)
+			}
+			if !reflect.DeepEqual(prices, tt.wantPrices) {
+				t.Errorf("trade prices = %v, want %v", prices, tt.wantPrices)
+			}
+
+			got := storedOrder(t, s, block.ID)
+			if got.Status != tt.wantStatus || !reflect.DeepEqual(got.CancelReason, tt.wantReason) {
+				t.Errorf("block is %s (reason %v), want %s (reason %v)", got.Status, got.CancelReason, tt.wantStatus, tt.wantReason)
+			}
+			if tt.wantStatus == models.OrderStatusCompleted && (got.AvgFillPrice == nil || *got.AvgFillPrice != 50) {
+				t.Errorf("block average fill price = %v, want 50", got.AvgFillPrice)
+			}
+
+			legs, err := s.orderRepo.GetChildOrders(block.ID)
+			if err != nil {
+				t.Fatalf("failed to get the block legs: %v", err)
+			}
+			for _, leg := range legs {
+				if leg.Status != tt.wantStatus {
+					t.Errorf("leg for period %d is %s, want %s", *leg.DeliveryPeriod, leg.Status, tt.wantStatus)
+				}
+			}
+
+			for _, order := range own {
+				wantOwn := models.OrderStatusOpen
+				if tt.stpMode == models.STPCancelOldest {
+					wantOwn = models.OrderStatusCanceled
+				}
+				if got := storedOrder(t, s, order.ID).Status; got != wantOwn {
+					t.Errorf("own resting order is %s, want %s", got, wantOwn)
+				}
+			}
+
+			// Block trades leave the last trade price of the products alone
+			for _, period := range []int{9, 10} {
+				_, ok, err := s.orderRepo.GetLastTradePrice(hourly[period])
+				if err != nil {
+					t.Fatalf("GetLastTradePrice() failed: %v", err)
+				}
+				if ok {
+					t.Errorf("block trades set the last trade price of period %d", period)
+				}
+			}
+		})
+	}
+
+	t.Run("a resting block trades once its periods fill", func(t *testing.T) {
+		s := testService(t)
+		daily, _, hourly := tomorrowProducts(t, s)
+		trader := testUser(t, s, "trader", "BG", 10000, 100)
+		maker := testUser(t, s, "maker", "BG", 10000, 100)
+
+		ask := limitOrder(sell, 48, 1)
+		ask.ProductID = hourly[9]
+		placeOrder(t, s, maker, ask)
+		block := placeOrder(t, s, trader, blockOrder(buy, 50, 1, daily, 9, 10))
+		if got := storedOrder(t, s, block.ID).Status; got != models.OrderStatusOpen {
+			t.Fatalf("block is %s before period 10 has volume, want open", got)
+		}
+
+		ask = limitOrder(sell, 52, 1)
+		ask.ProductID = hourly[10]
+		placeOrder(t, s, maker, ask)
+		err := s.MatchBlockOrders()
+		if err != nil {
+			t.Fatalf("MatchBlockOrders() failed: %v", err)
+		}
+
+		if got := storedOrder(t, s, block.ID).Status; got != models.OrderStatusCompleted {
+			t.Errorf("block is %s after MatchBlockOrders(), want completed", got)
+		}
+		if got := len(storedTrades(t, s)); got != 2 {
+			t.Errorf("%d trades, want 2", got)
+		}
+	})
+
+	t.Run("rejected blocks", func(t *testing.T) {
+		s := testService(t)
+		_, peak, hourly := tomorrowProducts(t, s)
+		trader := testUser(t, s, "trader", "BG", 10000, 100)
+
+		noProduct := blockOrder(buy, 50, 1, 0, 9, 10)
+		noProduct.ProductID = nil
+		rejected := map[string]models.CreateOrderRequest{
+			"no product":                    noProduct,
+			"an hourly product":             blockOrder(buy, 50, 1, *hourly[9], 9, 10),
+			"a period outside the peak day": blockOrder(buy, 50, 1, peak, 1, 9),
+		}
+
+		for name, req := range rejected {
+			if _, err := s.CreateOrder(trader, req); err == nil {
+				t.Errorf("CreateOrder() accepted a block with %s", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"my-go-project/models"
+)
+
+// couplingRounds bounds how often the flows between zones are balanced
+// against each other in one delivery period.
+const couplingRounds = 10
+
+// flowOrderID is the ID of the order that stands in for the flow into or out
+// of a zone while it clears. Real orders have positive IDs.
+const flowOrderID = -1
+
+// zoneLink is the capacity from one bidding zone into another in a delivery
+// period of an auction.
+type zoneLink struct {
+	fromZoneID  int
+	toZoneID    int
+	capacityMWh float64
+}
+
+// zonePair is two connected zones with the links between them, -1 where
+// there is no link in that direction.
+type zonePair struct {
+	a, b   int
+	ab, ba int
+}
+
+// zoneClearing is the outcome of one zone in a delivery period.
+type zoneClearing struct {
+	price     float64
+	volumeMWh float64
+	ok        bool
+	// covered is true when the volume takes every order that trades at any
+	// price: block legs and the flow into or out of the zone
+	covered bool
+}
+
+// periodCoupling clears the orders of one auction delivery period zone by
+// zone. Each zone clears at its own price, the net flow into it taking part
+// like a sell order at any price and the net flow out of it like a buy. The
+// flows are moved from the cheaper zone into the dearer one until the prices
+// meet or the capacity between them runs out.
+type periodCoupling struct {
+	zones  []int
+	buys   map[int][]*models.Order
+	sells  map[int][]*models.Order
+	legs   map[int]bool
+	links  []zoneLink
+	pairs  []zonePair
+	lotMWh float64
+	// flows is the energy sent over each link, in the order of links
+	flows []float64
+}
+
+// zoneKey is the zone an order clears in, 0 for orders without one.
+func zoneKey(order *models.Order) int {
+	if order.ZoneID == nil {
+		return 0
+	}
+	return *order.ZoneID
+}
+
+func newPeriodCoupling(orders []*models.Order, legs map[int]bool, links []zoneLink, lotMWh float64) *periodCoupling {
+	p := &periodCoupling{
+		buys:   make(map[int][]*models.Order),
+		sells:  make(map[int][]*models.Order),
+		legs:   map[int]bool{flowOrderID: true},
+		links:  links,
+		lotMWh: lotMWh,
+		flows:  make([]float64, len(links)),
+	}
+	for id, leg := range legs {
+		p.legs[id] = leg
+	}
+
+	seen := make(map[int]bool)
+	addZone := func(zone int) {
+		if !seen[zone] {
+			seen[zone] = true
+			p.zones = append(p.zones, zone)
+		}
+	}
+	for _, order := range orders {
+		zone := zoneKey(order)
+		addZone(zone)
+		if order.OrderType == models.OrderTypeBuy {
+			p.buys[zone] = append(p.buys[zone], order)
+		} else {
+			p.sells[zone] = append(p.sells[zone], order)
+		}
+	}
+
+	pairs := make(map[[2]int]*zonePair)
+	for i, link := range links {
+		addZone(link.fromZoneID)
+		addZone(link.toZoneID)
+
+		key := [2]int{link.fromZoneID, link.toZoneID}
+		if key[0] > key[1] {
+			key[0], key[1] = key[1], key[0]
+		}
+		pair, ok := pairs[key]
+		if !ok {
+			pair = &zonePair{a: key[0], b: key[1], ab: -1, ba: -1}
+			pairs[key] = pair
+		}
+		if link.fromZoneID == pair.a {
+			pair.ab = i
+		} else {
+			pair.ba = i
+		}
+	}
+	for _, pair := range pairs {
+		p.pairs = append(p.pairs, *pair)
+	}
+
+	sort.Ints(p.zones)
+	sort.Slice(p.pairs, func(i, j int) bool {
+		if p.pairs[i].a != p.pairs[j].a {
+			return p.pairs[i].a < p.pairs[j].a
+		}
+		return p.pairs[i].b < p.pairs[j].b
+	})
+	return p
+}
+
+// netImport is the energy flowing into a zone less what flows out of it.
+func (p *periodCoupling) netImport(zone int) float64 {
+	net := 0.0
+	for i, link := range p.links {
+		if link.toZoneID == zone {
+			net += p.flows[i]
+		}
+		if link.fromZoneID == zone {
+			net -= p.flows[i]
+		}
+	}
+	return roundAmount(net)
+}
+
+// clearZone clears a zone with the current flows.
+func (p *periodCoupling) clearZone(zone int) zoneClearing {
+	buys, sells := p.buys[zone], p.sells[zone]
+	if net := p.netImport(zone); net > 0 {
+		sells = append(append([]*models.Order(nil), sells...), &models.Order{ID: flowOrderID, OrderType: models.OrderTypeSell, AmountMWh: net})
+	} else if net < 0 {
+		buys = append(append([]*models.Order(nil), buys...), &models.Order{ID: flowOrderID, OrderType: models.OrderTypeBuy, AmountMWh: -net})
+	}
+
+	var clearing zoneClearing
+	clearing.price, clearing.volumeMWh, clearing.ok = clearingPrice(buys, sells, p.legs)
+
+	takerBuys, takerSells := 0.0, 0.0
+	for _, order := range buys {
+		if p.legs[order.ID] {
+			takerBuys = roundAmount(takerBuys + order.AmountMWh)
+		}
+	}
+	for _, order := range sells {
+		if p.legs[order.ID] {
+			takerSells = roundAmount(takerSells + order.AmountMWh)
+		}
+	}
+	clearing.covered = (takerBuys == 0 && takerSells == 0) ||
+		(clearing.ok && clearing.volumeMWh >= takerBuys && clearing.volumeMWh >= takerSells)
+	return clearing
+}
+
+// couple sets the flows between the zones. Each pair of zones is balanced in
+// turn with the other flows left as they are, until no flow changes.
+func (p *periodCoupling) couple() {
+	for round := 0; round < couplingRounds; round++ {
+		changed := false
+		for _, pair := range p.pairs {
+			if p.balance(pair) {
+				changed = true
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+// clear clears every zone with the flows set by couple.
+func (p *periodCoupling) clear() map[int]zoneClearing {
+	clearings := make(map[int]zoneClearing)
+	for _, zone := range p.zones {
+		clearings[zone] = p.clearZone(zone)
+	}
+	return clearings
+}
+
+func (p *periodCoupling) pairCapacity(link int) float64 {
+	if link < 0 {
+		return 0
+	}
+	return p.links[link].capacityMWh
+}
+
+// pairFlow is the flow from a to b of pair, negative when energy flows from
+// b to a.
+func (p *periodCoupling) pairFlow(pair zonePair) float64 {
+	flow := 0.0
+	if pair.ab >= 0 {
+		flow += p.flows[pair.ab]
+	}
+	if pair.ba >= 0 {
+		flow -= p.flows[pair.ba]
+	}
+	return flow
+}
+
+func (p *periodCoupling) setPairFlow(pair zonePair, flow float64) {
+	if pair.ab >= 0 {
+		p.flows[pair.ab] = math.Max(flow, 0)
+	}
+	if pair.ba >= 0 {
+		p.flows[pair.ba] = math.Max(-flow, 0)
+	}
+}
+
+// balance sets the flow between the zones of pair to the most the cheaper
+// zone can send into the dearer one, in whole lots. It reports whether the
+// flow changed.
+func (p *periodCoupling) balance(pair zonePair) bool {
+	before := p.pairFlow(pair)
+
+	flow := 0.0
+	for _, direction := range []float64{1, -1} {
+		link := pair.ab
+		if direction < 0 {
+			link = pair.ba
+		}
+		lots := p.maxFlowLots(pair, direction, floorLots(p.pairCapacity(link), p.lotMWh))
+		if lots > 0 {
+			flow = direction * roundAmount(float64(lots)*p.lotMWh)
+			break
+		}
+	}
+
+	p.setPairFlow(pair, flow)
+	return roundAmount(flow) != roundAmount(before)
+}
+
+// maxFlowLots finds the most lots, up to capacityLots, that can flow over
+// pair in direction while every lot goes from a cheaper zone into a dearer
+// one.
+func (p *periodCoupling) maxFlowLots(pair zonePair, direction float64, capacityLots int64) int64 {
+	if capacityLots == 0 {
+		return 0
+	}
+	if p.canFlow(pair, direction, capacityLots) {
+		return capacityLots
+	}
+
+	// canFlow(low) holds and canFlow(high) does not
+	low, high := int64(0), capacityLots
+	for high-low > 1 {
+		mid := low + (high-low)/2
+		if p.canFlow(pair, direction, mid) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return low
+}
+
+// canFlow reports whether lots can flow over pair in direction: both zones
+// clear, take the flow in full and the sending zone is no dearer than the
+// receiving one, while one lot less still left the sending zone cheaper.
+func (p *periodCoupling) canFlow(pair zonePair, direction float64, lots int64) bool {
+	from, to := pair.a, pair.b
+	if direction < 0 {
+		from, to = to, from
+	}
+
+	p.setPairFlow(pair, direction*roundAmount(float64(lots)*p.lotMWh))
+	sending, receiving := p.clearZone(from), p.clearZone(to)
+	if !sending.ok || !receiving.ok || !sending.covered || !receiving.covered ||
+		priceKey(sending.price) > priceKey(receiving.price) {
+		return false
+	}
+
+	p.setPairFlow(pair, direction*roundAmount(float64(lots-1)*p.lotMWh))
+	sending, receiving = p.clearZone(from), p.clearZone(to)
+	return !sending.ok || !receiving.ok || priceKey(sending.price) < priceKey(receiving.price)
+}
+
+// flowPath finds links with flow left on them that lead from zone from to a
+// zone for which wanted is true.
+func (p *periodCoupling) flowPath(from int, remaining []float64, wanted func(zone int) bool) (path []int, to int, ok bool) {
+	via := map[int][]int{from: nil}
+	queue := []int{from}
+	for len(queue) > 0 {
+		zone := queue[0]
+		queue = queue[1:]
+		if zone != from && wanted(zone) {
+			return via[zone], zone, true
+		}
+
+		for i, link := range p.links {
+			if link.fromZoneID != zone || remaining[i] <= 0 {
+				continue
+			}
+			if _, seen := via[link.toZoneID]; seen {
+				continue
+			}
+			via[link.toZoneID] = append(append([]int(nil), via[zone]...), i)
+			queue = append(queue, link.toZoneID)
+		}
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"my-go-project/models"
+)
+
+func zoneOrder(id, zone int, orderType models.OrderType, price, amount float64) *models.Order {
+	order := orderRef(id, orderType, price, amount)
+	order.ZoneID = &zone
+	return order
+}
+
+func TestPeriodCoupling(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+	link := func(from, to int, capacity float64) zoneLink {
+		return zoneLink{fromZoneID: from, toZoneID: to, capacityMWh: capacity}
+	}
+
+	tests := []struct {
+		name       string
+		orders     []*models.Order
+		links      []zoneLink
+		wantFlows  []float64
+		wantPrices map[int]float64
+	}{
+		{
+			name: "zones without a link clear apart",
+			orders: []*models.Order{
+				zoneOrder(1, 1, sell, 40, 10), zoneOrder(2, 1, buy, 60, 10),
+				zoneOrder(3, 2, sell, 70, 10), zoneOrder(4, 2, buy, 90, 10),
+			},
+			wantFlows:  []float64{},
+			wantPrices: map[int]float64{1: 40, 2: 70},
+		},
+		{
+			name: "congested link splits the prices",
+			orders: []*models.Order{
+				zoneOrder(1, 1, sell, 40, 20), zoneOrder(2, 1, buy, 50, 10),
+				zoneOrder(3, 2, sell, 90, 20), zoneOrder(4, 2, buy, 100, 20),
+			},
+			links:      []zoneLink{link(1, 2, 5), link(2, 1, 5)},
+			wantFlows:  []float64{5, 0},
+			wantPrices: map[int]float64{1: 40, 2: 90},
+		},
+		{
+			name: "flow stops before the sending zone gets dearer",
+			orders: []*models.Order{
+				zoneOrder(1, 1, sell, 40, 10), zoneOrder(2, 1, sell, 70, 10),
+				zoneOrder(3, 2, sell, 60, 10), zoneOrder(4, 2, buy, 80, 30),
+			},
+			links:      []zoneLink{link(1, 2, 100), link(2, 1, 100)},
+			wantFlows:  []float64{10, 0},
+			wantPrices: map[int]float64{1: 40, 2: 60},
+		},
+		{
+			name: "each direction has its own capacity",
+			orders: []*models.Order{
+				zoneOrder(1, 1, buy, 80, 10),
+				zoneOrder(2, 2, sell, 40, 10),
+			},
+			links:      []zoneLink{link(1, 2, 10), link(2, 1, 3)},
+			wantFlows:  []float64{0, 3},
+			wantPrices: map[int]float64{1: 80, 2: 40},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coupling := newPeriodCoupling(tt.orders, nil, tt.links, 1)
+			coupling.couple()
+
+			if !reflect.DeepEqual(coupling.flows, tt.wantFlows) {
+				t.Errorf("flows = %v, want %v", coupling.flows, tt.wantFlows)
+			}
+			clearings := coupling.clear()
+			for zone, want := range tt.wantPrices {
+				if got := clearings[zone]; !got.ok || got.price != want {
+					t.Errorf("zone %d cleared at %v (ok %v), want %v", zone, got.price, got.ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlowPath(t *testing.T) {
+	coupling := newPeriodCoupling(nil, nil, []zoneLink{
+		{fromZoneID: 1, toZoneID: 2, capacityMWh: 10},
+		{fromZoneID: 2, toZoneID: 3, capacityMWh: 10},
+		{fromZoneID: 2, toZoneID: 1, capacityMWh: 10},
+	}, 1)
+
+	path, to, ok := coupling.flowPath(1, []float64{5, 5, 0}, func(zone int) bool { return zone == 3 })
+	if !ok || to != 3 || !reflect.DeepEqual(path, []int{0, 1}) {
+		t.Errorf("flowPath() = %v, %d, %v, want [0 1], 3, true", path, to, ok)
+	}
+
+	_, _, ok = coupling.flowPath(1, []float64{5, 0, 0}, func(zone int) bool { return zone == 3 })
+	if ok {
+		t.Errorf("flowPath() found a path over a link without flow")
+	}
+}
+
+func TestAcceptBlocksAcrossZones(t *testing.T) {
+	tests := []struct {
+		name  string
+		links []zoneLink
+		want  map[int]bool
+	}{
+		{"the block exports into the zone with the buyer", []zoneLink{{fromZoneID: 1, toZoneID: 2, capacityMWh: 10}}, map[int]bool{1001: true}},
+		{"too little capacity", []zoneLink{{fromZoneID: 1, toZoneID: 2, capacityMWh: 5}}, map[int]bool{}},
+		{"zones without a link", nil, map[int]bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := 1
+			block, legs := blockRef(10, models.OrderTypeSell, 40, 10, 1, 1)
+			block.ZoneID = &zone
+			for _, leg := range legs {
+				leg.ZoneID = &zone
+			}
+			byPeriod := map[int][]*models.Order{1: {
+				zoneOrder(1, 1, models.OrderTypeSell, 45, 5),
+				zoneOrder(2, 2, models.OrderTypeBuy, 60, 10),
+			}}
+
+			got := acceptBlocks(byPeriod, []*models.Order{block}, map[int][]*models.Order{block.ID: legs}, tt.links, 1)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("acceptBlocks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"my-go-project/models"
+)
+
+// defaultDepth is the number of price levels per side GetMarketDepth returns
+// unless asked for another depth.
+const defaultDepth = 10
+
+// GetMarketDepth returns the aggregated order book of a product, or of the
+// undated market when filter.ProductID is zero.
+func (s *OrderService) GetMarketDepth(filter models.DepthFilter) *models.MarketDepth {
+	productID := productRef(filter.ProductID)
+	levels := filter.Depth
+	if levels == 0 {
+		levels = defaultDepth
+	}
+
+	now := time.Now()
+	depth := &models.MarketDepth{ProductID: productID, Timestamp: now}
+	depth.Bids, depth.Asks = s.books.Book(productID).Depth(levels, now)
+	if len(depth.Bids) > 0 {
+		depth.BestBid = &depth.Bids[0].PriceEurPerMWh
+	}
+	if len(depth.Asks) > 0 {
+		depth.BestAsk = &depth.Asks[0].PriceEurPerMWh
+	}
+	if depth.BestBid != nil && depth.BestAsk != nil {
+		spread := float64(priceKey(*depth.BestAsk)-priceKey(*depth.BestBid)) / 100
+		depth.Spread = &spread
+	}
+	return depth
+}
+
+// GetCandles returns the OHLCV candles of a product, or of the undated
+// market when filter.ProductID is zero.
+func (s *OrderService) GetCandles(filter models.CandleFilter) ([]models.Candle, error) {
+	return s.orderRepo.GetCandles(productRef(filter.ProductID), filter)
+}
+
+// GetTicker sums up the last 24 hours of a product, or of the undated market
+// when filter.ProductID is zero, from its 1m candles and the current book.
+func (s *OrderService) GetTicker(filter models.TickerFilter) (*models.Ticker, error) {
+	productID := productRef(filter.ProductID)
+	now := time.Now()
+	ticker := &models.Ticker{ProductID: productID, Timestamp: now}
+
+	lastPrice, ok, err := s.orderRepo.GetLastCandlePrice(productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last price: %w", err)
+	}
+	if ok {
+		ticker.LastPrice = &lastPrice
+	}
+
+	book := s.books.Book(productID)
+	if bid, ok := book.BestPrice(models.OrderTypeBuy, now); ok {
+		ticker.BestBid = &bid
+	}
+	if ask, ok := book.BestPrice(models.OrderTypeSell, now); ok {
+		ticker.BestAsk = &ask
+	}
+
+	stats, err := s.orderRepo.GetMarketStats(productID, models.CandleInterval1m.BucketStart(now.Add(-24*time.Hour)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market statistics: %w", err)
+	}
+	ticker.Volume24hMWh = stats.VolumeMWh
+	ticker.High24h = stats.High
+	ticker.Low24h = stats.Low
+	if stats.Open != nil && ticker.LastPrice != nil {
+		change := math.Round((lastPrice-*stats.Open)*100) / 100
+		changePct := math.Round(change / *stats.Open * 10000) / 100
+		ticker.Change24h = &change
+		ticker.ChangePct24h = &changePct
+	}
+	return ticker, nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"math"
+)
+
+// Matching algorithm names, as used in MATCHING_ALGORITHM.
+const (
+	MatchingFIFO       = "fifo"
+	MatchingProRata    = "pro_rata"
+	MatchingProRataTop = "pro_rata_top"
+)
+
+// MatchingAlgorithm decides how an incoming order is shared out among the
+// resting orders of a single price level.
+type MatchingAlgorithm interface {
+	// Allocate splits amountMWh among the resting orders of a level. offers
+	// holds what each order offers, best time priority first. The returned
+	// fills line up with offers, are whole multiples of lotMWh, never exceed
+	// an offer and add up to at most amountMWh.
+	Allocate(offers []float64, amountMWh, lotMWh float64) []float64
+}
+
+// NewMatchingAlgorithm returns the algorithm with the given name.
+func NewMatchingAlgorithm(name string) (MatchingAlgorithm, error) {
+	switch name {
+	case MatchingFIFO:
+		return FIFOMatching{}, nil
+	case MatchingProRata:
+		return ProRataMatching{}, nil
+	case MatchingProRataTop:
+		return ProRataMatching{TopOrder: true}, nil
+	}
+	return nil, fmt.Errorf("unknown matching algorithm %q", name)
+}
+
+// FIFOMatching fills orders strictly in time priority.
+type FIFOMatching struct{}
+
+func (FIFOMatching) Allocate(offers []float64, amountMWh, lotMWh float64) []float64 {
+	lots := toLots(offers, lotMWh)
+	fills := fifoLots(lots, floorLots(amountMWh, lotMWh))
+	return fromLots(fills, lotMWh)
+}
+
+// ProRataMatching shares the incoming amount out in proportion to the size
+// of each resting order. Shares are rounded down to the lot size and the
+// lots left over go one by one to the orders in time priority. With TopOrder
+// the first order in time priority is filled in full before the rest is
+// shared out.
+type ProRataMatching struct {
+	TopOrder bool
+}
+
+func (m ProRataMatching) Allocate(offers []float64, amountMWh, lotMWh float64) []float64 {
+	lots := toLots(offers, lotMWh)
+	remaining := floorLots(amountMWh, lotMWh)
+	fills := make([]int64, len(lots))
+
+	start := 0
+	if m.TopOrder && len(lots) > 0 {
+		fills[0] = min(lots[0], remaining)
+		remaining -= fills[0]
+		start = 1
+	}
+
+	copy(fills[start:], proRataLots(lots[start:], remaining))
+	return fromLots(fills, lotMWh)
+}
+
+// proRataLots shares amount lots out over offers in proportion to their size.
+func proRataLots(offers []int64, amount int64) []int64 {
+	total := int64(0)
+	for _, offer := range offers {
+		total += offer
+	}
+	if amount >= total {
+		return append([]int64(nil), offers...)
+	}
+
+	shares := make([]int64, len(offers))
+	allocated := int64(0)
+	for i, offer := range offers {
+		shares[i] = int64(math.Floor(float64(offer) * float64(amount) / float64(total)))
+		allocated += shares[i]
+	}
+
+	// Hand out what rounding left over in time priority
+	leftover := amount - allocated
+	for i := range shares {
+		if leftover == 0 {
+			break
+		}
+		extra := min(offers[i]-shares[i], leftover)
+		shares[i] += extra
+		leftover -= extra
+	}
+	return shares
+}
+
+func fifoLots(offers []int64, amount int64) []int64 {
+	fills := make([]int64, len(offers))
+	for i, offer := range offers {
+		fills[i] = min(offer, amount)
+		amount -= fills[i]
+	}
+	return fills
+}
+
+// floorLots is the number of whole lots in amountMWh. Amounts that are a
+// multiple of the lot up to floating point noise do not lose a lot.
+func floorLots(amountMWh, lotMWh float64) int64 {
+	lots := amountMWh / lotMWh
+	if isLotMultiple(amountMWh, lotMWh) {
+		return int64(math.Round(lots))
+	}
+	return int64(math.Floor(lots))
+}
+
+// floorToLot rounds an amount down to a whole number of lots.
+func floorToLot(amountMWh, lotMWh float64) float64 {
+	return roundAmount(float64(floorLots(amountMWh, lotMWh)) * lotMWh)
+}
+
+// isLotMultiple reports whether amountMWh is a whole number of lots.
+func isLotMultiple(amountMWh, lotMWh float64) bool {
+	lots := amountMWh / lotMWh
+	return math.Abs(lots-math.Round(lots)) < 1e-6
+}
+
+func toLots(amounts []float64, lotMWh float64) []int64 {
+	lots := make([]int64, len(amounts))
+	for i, amount := range amounts {
+		lots[i] = floorLots(amount, lotMWh)
+	}
+	return lots
+}
+
+func fromLots(lots []int64, lotMWh float64) []float64 {
+	amounts := make([]float64, len(lots))
+	for i, n := range lots {
+		amounts[i] = roundAmount(float64(n) * lotMWh)
+	}
+	return amounts
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProRataLots(t *testing.T) {
+	tests := []struct {
+		name   string
+		offers []int64
+		amount int64
+		want   []int64
+	}{
+		{"fills everything when the amount covers the level", []int64{10, 20, 30}, 60, []int64{10, 20, 30}},
+		{"never fills more than offered", []int64{5, 5}, 20, []int64{5, 5}},
+		{"exact proportions", []int64{10, 30}, 20, []int64{5, 15}},
+		{"leftover lots go out in time priority", []int64{1, 1, 1}, 2, []int64{1, 1, 0}},
+		{"leftover goes to the first order even if it is smaller", []int64{3, 3, 4}, 5, []int64{2, 1, 2}},
+		{"nothing to share", []int64{4, 6}, 0, []int64{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := proRataLots(tt.offers, tt.amount)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("proRataLots(%v, %d) = %v, want %v", tt.offers, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchingAlgorithmAllocate(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm MatchingAlgorithm
+		offers    []float64
+		amount    float64
+		want      []float64
+	}{
+		{"fifo fills in time priority", FIFOMatching{}, []float64{0.3, 0.5, 0.2}, 0.6, []float64{0.3, 0.3, 0}},
+		{"fifo rounds the amount down to the lot", FIFOMatching{}, []float64{0.3, 0.5, 0.2}, 0.65, []float64{0.3, 0.3, 0}},
+		{"pro rata rounds shares down to the lot", ProRataMatching{}, []float64{0.3, 0.3, 0.4}, 0.5, []float64{0.2, 0.1, 0.2}},
+		{"pro rata fills the whole level", ProRataMatching{}, []float64{0.3, 0.3, 0.4}, 1.5, []float64{0.3, 0.3, 0.4}},
+		{"pro rata top fills the first order before sharing", ProRataMatching{TopOrder: true}, []float64{0.2, 0.4, 0.4}, 0.6, []float64{0.2, 0.2, 0.2}},
+		{"pro rata top order takes everything", ProRataMatching{TopOrder: true}, []float64{0.5, 0.5}, 0.3, []float64{0.3, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.algorithm.Allocate(tt.offers, tt.amount, 0.1)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate(%v, %v) = %v, want %v", tt.offers, tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMatchingAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    MatchingAlgorithm
+		wantErr bool
+	}{
+		{MatchingFIFO, FIFOMatching{}, false},
+		{MatchingProRata, ProRataMatching{}, false},
+		{MatchingProRataTop, ProRataMatching{TopOrder: true}, false},
+		{"", nil, true},
+		{"lifo", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := NewMatchingAlgorithm(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewMatchingAlgorithm(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("NewMatchingAlgorithm(%q) = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFloorLots(t *testing.T) {
+	tests := []struct {
+		amount float64
+		lot    float64
+		want   int64
+	}{
+		{0.3, 0.1, 3},
+		{0.35, 0.1, 3},
+		{0.7, 0.1, 7}, // 0.7 / 0.1 is just below 7 in floating point
+		{1, 0.000001, 1000000},
+		{0, 0.1, 0},
+	}
+
+	for _, tt := range tests {
+		if got := floorLots(tt.amount, tt.lot); got != tt.want {
+			t.Errorf("floorLots(%v, %v) = %d, want %d", tt.amount, tt.lot, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package services
+
+import (
+	"container/list"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"my-go-project/models"
+)
+
+// OrderBook keeps the open orders of the market in memory. Each side is
+// split into price levels and every level is a FIFO queue, so walking a side
+// from the best level down yields orders in price-time priority.
+type OrderBook struct {
+	mu      sync.RWMutex
+	bids    *bookSide
+	asks    *bookSide
+	entries map[int]*bookEntry
+}
+
+type bookEntry struct {
+	side    *bookSide
+	level   *priceLevel
+	element *list.Element
+}
+
+type priceLevel struct {
+	key    int64
+	orders *list.List // of *models.Order
+}
+
+type bookSide struct {
+	// descending is true for bids, where the highest price is the best one
+	descending bool
+	levels     map[int64]*priceLevel
+	// keys holds the level keys sorted best price first
+	keys []int64
+}
+
+// ProductBooks keeps one OrderBook per product. Orders without a product
+// share the book of the undated market.
+type ProductBooks struct {
+	mu    sync.Mutex
+	books map[int]*OrderBook
+	// products maps the orders in the books to the product they rest under
+	products map[int]int
+}
+
+func NewProductBooks() *ProductBooks {
+	return &ProductBooks{books: make(map[int]*OrderBook), products: make(map[int]int)}
+}
+
+func bookKey(productID *int) int {
+	if productID == nil {
+		return 0
+	}
+	return *productID
+}
+
+// Book returns the order book of a product, nil for the undated market. A
+// product without resting orders gets an empty book.
+func (p *ProductBooks) Book(productID *int) *OrderBook {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	book, ok := p.books[bookKey(productID)]
+	if !ok {
+		return NewOrderBook()
+	}
+	return book
+}
+
+func (p *ProductBooks) book(key int) *OrderBook {
+	book, ok := p.books[key]
+	if !ok {
+		book = NewOrderBook()
+		p.books[key] = book
+	}
+	return book
+}
+
+// Load replaces the content of all books with the given open orders, oldest
+// first.
+func (p *ProductBooks) Load(orders []models.Order) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	byProduct := make(map[int][]models.Order)
+	p.products = make(map[int]int)
+	for _, order := range orders {
+		key := bookKey(order.ProductID)
+		byProduct[key] = append(byProduct[key], order)
+		p.products[order.ID] = key
+	}
+
+	p.books = make(map[int]*OrderBook)
+	for key, productOrders := range byProduct {
+		p.book(key).Load(productOrders)
+	}
+}
+
+// Update stores a resting order in the book of its product, see
+// OrderBook.Update.
+func (p *ProductBooks) Update(order models.Order) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := bookKey(order.ProductID)
+	p.products[order.ID] = key
+	p.book(key).Update(order)
+}
+
+// Remove takes the order out of the book of its product, a book left empty
+// is dropped. Unknown ids are ignored.
+func (p *ProductBooks) Remove(orderID int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.products[orderID]
+	if !ok {
+		return
+	}
+	delete(p.products, orderID)
+
+	book := p.books[key]
+	book.Remove(orderID)
+	if book.Len() == 0 {
+		delete(p.books, key)
+	}
+}
+
+func NewOrderBook() *OrderBook {
+	return &OrderBook{
+		bids:    newBookSide(true),
+		asks:    newBookSide(false),
+		entries: make(map[int]*bookEntry),
+	}
+}
+
+func newBookSide(descending bool) *bookSide {
+	return &bookSide{descending: descending, levels: make(map[int64]*priceLevel)}
+}
+
+// priceKey converts a price to whole cents so levels are not split by
+// floating point noise.
+func priceKey(price float64) int64 {
+	return int64(math.Round(price * 100))
+}
+
+func (s *bookSide) better(a, b int64) bool {
+	if s.descending {
+		return a > b
+	}
+	return a < b
+}
+
+func (s *bookSide) level(key int64) *priceLevel {
+	if lvl, ok := s.levels[key]; ok {
+		return lvl
+	}
+
+	lvl := &priceLevel{key: key, orders: list.New()}
+	s.levels[key] = lvl
+
+	i := sort.Search(len(s.keys), func(i int) bool { return !s.better(s.keys[i], key) })
+	s.keys = append(s.keys, 0)
+	copy(s.keys[i+1:], s.keys[i:])
+	s.keys[i] = key
+	return lvl
+}
+
+func (s *bookSide) dropLevel(lvl *priceLevel) {
+	delete(s.levels, lvl.key)
+	i := sort.Search(len(s.keys), func(i int) bool { return !s.better(s.keys[i], lvl.key) })
+	if i < len(s.keys) && s.keys[i] == lvl.key {
+		s.keys = append(s.keys[:i], s.keys[i+1:]...)
+	}
+}
+
+func (b *OrderBook) side(orderType models.OrderType) *bookSide {
+	if orderType == models.OrderTypeBuy {
+		return b.bids
+	}
+	return b.asks
+}
+
+// Load replaces the content of the book with the given open orders. Orders
+// must be supplied oldest first so that each level keeps time priority.
+func (b *OrderBook) Load(orders []models.Order) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bids = newBookSide(true)
+	b.asks = newBookSide(false)
+	b.entries = make(map[int]*bookEntry)
+
+	for i := range orders {
+		b.add(orders[i])
+	}
+}
+
+// Add places a copy of the order at the back of its price level.
+func (b *OrderBook) Add(order models.Order) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(order.ID)
+	b.add(order)
+}
+
+func (b *OrderBook) add(order models.Order) {
+	side := b.side(order.OrderType)
+	lvl := side.level(priceKey(order.PriceEurPerMWh))
+	element := lvl.orders.PushBack(&order)
+	b.entries[order.ID] = &bookEntry{side: side, level: lvl, element: element}
+}
+
+// Remove takes the order out of the book. Unknown ids are ignored.
+func (b *OrderBook) Remove(orderID int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(orderID)
+}
+
+func (b *OrderBook) remove(orderID int) {
+	entry, ok := b.entries[orderID]
+	if !ok {
+		return
+	}
+
+	entry.level.orders.Remove(entry.element)
+	if entry.level.orders.Len() == 0 {
+		entry.side.dropLevel(entry.level)
+	}
+	delete(b.entries, orderID)
+}
+
+// Update replaces the stored copy of a resting order. An order whose price
+// and priority time are unchanged keeps its position in the queue, otherwise
+// it moves to the back of its level. An unknown order is added.
+func (b *OrderBook) Update(order models.Order) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, ok := b.entries[order.ID]
+	if ok {
+		stored := entry.element.Value.(*models.Order)
+		if entry.level.key == priceKey(order.PriceEurPerMWh) && stored.PriorityAt.Equal(order.PriorityAt) {
+			*stored = order
+			return
+		}
+	}
+
+	b.remove(order.ID)
+	b.add(order)
+}
+
+// CrossingLevels returns copies of the resting orders on the opposite side
+// whose price the incoming order accepts, one slice per price level, best
+// level first and each level in time priority.
+func (b *OrderBook) CrossingLevels(incoming *models.Order) [][]models.Order {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	opposite := b.asks
+	if incoming.OrderType == models.OrderTypeSell {
+		opposite = b.bids
+	}
+
+	limit := priceKey(incoming.PriceEurPerMWh)
+	return opposite.copyLevels(func(key int64) bool { return !opposite.better(limit, key) })
+}
+
+// Levels returns copies of every resting order on one side of the book, one
+// slice per price level, best level first and each level in time priority.
+func (b *OrderBook) Levels(orderType models.OrderType) [][]models.Order {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.side(orderType).copyLevels(func(int64) bool { return true })
+}
+
+// copyLevels copies the levels of the side from the best one on, as long as
+// include accepts their key.
+func (s *bookSide) copyLevels(include func(key int64) bool) [][]models.Order {
+	var levels [][]models.Order
+	for _, key := range s.keys {
+		if !include(key) {
+			break
+		}
+		level := make([]models.Order, 0, s.levels[key].orders.Len())
+		for e := s.levels[key].orders.Front(); e != nil; e = e.Next() {
+			level = append(level, *e.Value.(*models.Order))
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// Len is the number of orders in the book.
+func (b *OrderBook) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.entries)
+}
+
+// BestPrice returns the best price on the given side of the book. Like in
+// Depth, levels that only hold orders expired at now are skipped.
+func (b *OrderBook) BestPrice(orderType models.OrderType, now time.Time) (float64, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	side := b.side(orderType)
+	for _, key := range side.keys {
+		for e := side.levels[key].orders.Front(); e != nil; e = e.Next() {
+			if !isExpired(e.Value.(*models.Order), now) {
+				return float64(key) / 100, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Depth sums up the best levels of both sides of the book, at most levels
+// per side. Icebergs count with their visible tranche and orders expired at
+// now are left out.
+func (b *OrderBook) Depth(levels int, now time.Time) (bids, asks []models.DepthLevel) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.bids.depth(levels, now), b.asks.depth(levels, now)
+}
+
+func (s *bookSide) depth(levels int, now time.Time) []models.DepthLevel {
+	depth := []models.DepthLevel{}
+	for _, key := range s.keys {
+		if len(depth) == levels {
+			break
+		}
+
+		level := models.DepthLevel{PriceEurPerMWh: float64(key) / 100}
+		for e := s.levels[key].orders.Front(); e != nil; e = e.Next() {
+			order := e.Value.(*models.Order)
+			if isExpired(order, now) {
+				continue
+			}
+			level.AmountMWh = roundAmount(level.AmountMWh + order.Public().AmountMWh)
+			level.OrderCount++
+		}
+		if level.OrderCount > 0 {
+			depth = append(depth, level)
+		}
+	}
+	return depth
+}
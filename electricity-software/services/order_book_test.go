@@ -0,0 +1,312 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"my-go-project/models"
+)
+
+func bookOrder(id int, orderType models.OrderType, price, amount float64) models.Order {
+	return models.Order{
+		ID:             id,
+		OrderType:      orderType,
+		PriceEurPerMWh: price,
+		AmountMWh:      amount,
+		PriorityAt:     time.Date(2026, 1, 1, 0, 0, id, 0, time.UTC),
+	}
+}
+
+func levelIDs(levels [][]models.Order) [][]int {
+	ids := [][]int{}
+	for _, level := range levels {
+		var levelIDs []int
+		for _, order := range level {
+			levelIDs = append(levelIDs, order.ID)
+		}
+		ids = append(ids, levelIDs)
+	}
+	return ids
+}
+
+func TestOrderBookCrossingLevels(t *testing.T) {
+	book := NewOrderBook()
+	book.Load([]models.Order{
+		bookOrder(1, models.OrderTypeSell, 51, 1),
+		bookOrder(2, models.OrderTypeSell, 50, 1),
+		bookOrder(3, models.OrderTypeSell, 51, 1),
+		bookOrder(4, models.OrderTypeSell, 50.004, 1), // same cent level as 2
+		bookOrder(5, models.OrderTypeSell, 53, 1),
+		bookOrder(6, models.OrderTypeBuy, 49, 1),
+		bookOrder(7, models.OrderTypeBuy, 48, 1),
+		bookOrder(8, models.OrderTypeBuy, 49, 1),
+	})
+
+	tests := []struct {
+		name     string
+		incoming models.Order
+		want     [][]int
+	}{
+		{"buy walks asks cheapest first", bookOrder(10, models.OrderTypeBuy, 52, 1), [][]int{{2, 4}, {1, 3}}},
+		{"buy at the best ask", bookOrder(10, models.OrderTypeBuy, 50, 1), [][]int{{2, 4}}},
+		{"buy below the asks", bookOrder(10, models.OrderTypeBuy, 49.99, 1), [][]int{}},
+		{"sell walks bids highest first", bookOrder(10, models.OrderTypeSell, 0, 1), [][]int{{6, 8}, {7}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := levelIDs(book.CrossingLevels(&tt.incoming))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CrossingLevels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderBookLevels(t *testing.T) {
+	book := NewOrderBook()
+	book.Load([]models.Order{
+		bookOrder(1, models.OrderTypeSell, 51, 1),
+		bookOrder(2, models.OrderTypeSell, 50, 1),
+		bookOrder(3, models.OrderTypeSell, 51, 1),
+		bookOrder(4, models.OrderTypeBuy, 49, 1),
+		bookOrder(5, models.OrderTypeBuy, 48, 1),
+	})
+
+	if got, want := levelIDs(book.Levels(models.OrderTypeSell)), [][]int{{2}, {1, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Levels(sell) = %v, want %v", got, want)
+	}
+	if got, want := levelIDs(book.Levels(models.OrderTypeBuy)), [][]int{{4}, {5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Levels(buy) = %v, want %v", got, want)
+	}
+	if got := NewOrderBook().Levels(models.OrderTypeSell); len(got) != 0 {
+		t.Errorf("Levels() of an empty book = %v, want none", levelIDs(got))
+	}
+}
+
+func TestOrderBookUpdate(t *testing.T) {
+	first := bookOrder(1, models.OrderTypeSell, 50, 1)
+	second := bookOrder(2, models.OrderTypeSell, 50, 1)
+	buy := bookOrder(10, models.OrderTypeBuy, 60, 1)
+
+	tests := []struct {
+		name   string
+		update func(models.Order) models.Order
+		want   [][]int
+	}{
+		{"smaller amount keeps priority", func(o models.Order) models.Order {
+			o.AmountMWh = 0.5
+			return o
+		}, [][]int{{1, 2}}},
+		{"new priority time moves to the back", func(o models.Order) models.Order {
+			o.PriorityAt = o.PriorityAt.Add(time.Hour)
+			return o
+		}, [][]int{{2, 1}}},
+		{"new price moves to another level", func(o models.Order) models.Order {
+			o.PriceEurPerMWh = 55
+			return o
+		}, [][]int{{2}, {1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook()
+			book.Load([]models.Order{first, second})
+			book.Update(tt.update(first))
+
+			got := levelIDs(book.CrossingLevels(&buy))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CrossingLevels() after Update = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderBookRemoveDropsEmptyLevels(t *testing.T) {
+	book := NewOrderBook()
+	book.Load([]models.Order{
+		bookOrder(1, models.OrderTypeSell, 50, 1),
+		bookOrder(2, models.OrderTypeSell, 51, 1),
+	})
+
+	book.Remove(1)
+	book.Remove(99)
+
+	if got := book.Len(); got != 1 {
+		t.Errorf("Len() = %d, want 1", got)
+	}
+	if price, ok := book.BestPrice(models.OrderTypeSell, time.Now()); !ok || price != 51 {
+		t.Errorf("BestPrice(sell) = %v, %v, want 51, true", price, ok)
+	}
+	if _, ok := book.BestPrice(models.OrderTypeBuy, time.Now()); ok {
+		t.Errorf("BestPrice(buy) on an empty side reported a price")
+	}
+}
+
+func TestOrderBookDepth(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	display := 0.2
+	visible := 0.2
+
+	iceberg := bookOrder(2, models.OrderTypeSell, 50, 5)
+	iceberg.DisplayAmountMWh = &display
+	iceberg.VisibleAmountMWh = &visible
+	gtd := bookOrder(3, models.OrderTypeSell, 51, 1)
+	gtd.TimeInForce = models.TimeInForceGTD
+	gtd.ExpiresAt = &expired
+
+	book := NewOrderBook()
+	book.Load([]models.Order{
+		bookOrder(1, models.OrderTypeSell, 50, 1),
+		iceberg,
+		gtd,
+		bookOrder(4, models.OrderTypeSell, 52, 1),
+		bookOrder(5, models.OrderTypeSell, 53, 1),
+	})
+
+	_, asks := book.Depth(2, now)
+	want := []models.DepthLevel{
+		{PriceEurPerMWh: 50, AmountMWh: 1.2, OrderCount: 2},
+		{PriceEurPerMWh: 52, AmountMWh: 1, OrderCount: 1},
+	}
+	if !reflect.DeepEqual(asks, want) {
+		t.Errorf("Depth() asks = %+v, want %+v", asks, want)
+	}
+}
+
+func TestOrderBookBestPriceSkipsExpiredOrders(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	later := now.Add(time.Minute)
+	gtd := func(id int, orderType models.OrderType, price float64, expiresAt *time.Time) models.Order {
+		order := bookOrder(id, orderType, price, 1)
+		order.TimeInForce = models.TimeInForceGTD
+		order.ExpiresAt = expiresAt
+		return order
+	}
+
+	tests := []struct {
+		name      string
+		orders    []models.Order
+		orderType models.OrderType
+		want      float64
+		wantOK    bool
+	}{
+		{"expired best ask", []models.Order{gtd(1, models.OrderTypeSell, 50, &expired), bookOrder(2, models.OrderTypeSell, 51, 1)}, models.OrderTypeSell, 51, true},
+		{"expired best bid", []models.Order{gtd(1, models.OrderTypeBuy, 52, &expired), bookOrder(2, models.OrderTypeBuy, 49, 1)}, models.OrderTypeBuy, 49, true},
+		{"live order behind an expired one", []models.Order{gtd(1, models.OrderTypeSell, 50, &expired), gtd(2, models.OrderTypeSell, 50, &later)}, models.OrderTypeSell, 50, true},
+		{"expiring right now", []models.Order{gtd(1, models.OrderTypeSell, 50, &now)}, models.OrderTypeSell, 0, false},
+		{"only expired orders", []models.Order{gtd(1, models.OrderTypeSell, 50, &expired)}, models.OrderTypeSell, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook()
+			book.Load(tt.orders)
+
+			price, ok := book.BestPrice(tt.orderType, now)
+			if price != tt.want || ok != tt.wantOK {
+				t.Errorf("BestPrice() = %v, %v, want %v, %v", price, ok, tt.want, tt.wantOK)
+			}
+
+			// The ticker and the depth view agree on the top of the book
+			bids, asks := book.Depth(1, now)
+			depth := asks
+			if tt.orderType == models.OrderTypeBuy {
+				depth = bids
+			}
+			if ok != (len(depth) > 0) || (ok && depth[0].PriceEurPerMWh != price) {
+				t.Errorf("Depth() top level %+v disagrees with BestPrice() %v", depth, price)
+			}
+		})
+	}
+}
+
+func TestOrderBookAddAndLoad(t *testing.T) {
+	buy := bookOrder(10, models.OrderTypeBuy, 60, 1)
+
+	book := NewOrderBook()
+	book.Load([]models.Order{
+		bookOrder(1, models.OrderTypeSell, 50, 1),
+		bookOrder(2, models.OrderTypeSell, 50, 1),
+	})
+
+	book.Add(bookOrder(1, models.OrderTypeSell, 50, 1))
+	if got, want := levelIDs(book.CrossingLevels(&buy)), [][]int{{2, 1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CrossingLevels() after Add = %v, want %v", got, want)
+	}
+
+	book.Load([]models.Order{bookOrder(3, models.OrderTypeSell, 55, 1)})
+	if got, want := levelIDs(book.CrossingLevels(&buy)), [][]int{{3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CrossingLevels() after Load = %v, want %v", got, want)
+	}
+	if got := book.Len(); got != 1 {
+		t.Errorf("Len() after Load = %d, want 1", got)
+	}
+}
+
+func TestOrderBookCrossingLevelsReturnsCopies(t *testing.T) {
+	book := NewOrderBook()
+	book.Load([]models.Order{bookOrder(1, models.OrderTypeSell, 50, 1)})
+	buy := bookOrder(10, models.OrderTypeBuy, 60, 1)
+
+	levels := book.CrossingLevels(&buy)
+	levels[0][0].AmountMWh = 0
+
+	if got := book.CrossingLevels(&buy)[0][0].AmountMWh; got != 1 {
+		t.Errorf("resting amount = %v after changing the copy, want 1", got)
+	}
+}
+
+func TestProductBooks(t *testing.T) {
+	productOrder := func(id int, productID *int, price float64) models.Order {
+		order := bookOrder(id, models.OrderTypeSell, price, 1)
+		order.ProductID = productID
+		return order
+	}
+	hour, day := 1, 2
+	buy := bookOrder(10, models.OrderTypeBuy, 60, 1)
+
+	books := NewProductBooks()
+	books.Load([]models.Order{
+		productOrder(1, nil, 50),
+		productOrder(2, &hour, 51),
+		productOrder(3, &hour, 52),
+	})
+	books.Update(productOrder(4, &day, 53))
+
+	tests := []struct {
+		name      string
+		productID *int
+		want      [][]int
+	}{
+		{"undated market", nil, [][]int{{1}}},
+		{"hourly product", &hour, [][]int{{2}, {3}}},
+		{"product added by Update", &day, [][]int{{4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := levelIDs(books.Book(tt.productID).CrossingLevels(&buy))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CrossingLevels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	books.Remove(2)
+	books.Remove(3)
+	books.Remove(99)
+	if _, ok := books.books[hour]; ok {
+		t.Errorf("the emptied book of product %d was kept", hour)
+	}
+	if got := books.Book(&hour).Len(); got != 0 {
+		t.Errorf("Book() of an emptied product has %d orders, want 0", got)
+	}
+
+	books.Load(nil)
+	if got := books.Book(nil).Len() + books.Book(&day).Len(); got != 0 {
+		t.Errorf("books hold %d orders after Load(nil), want 0", got)
+	}
+}
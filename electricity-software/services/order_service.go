@@ -1,198 +1,1369 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"math"
+	"my-go-project/config"
 	"my-go-project/models"
 	"my-go-project/repositories"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 type OrderService struct {
 	orderRepo *repositories.OrderRepository
+	db        *sqlx.DB
+	cfg       *config.Config
+	books     *ProductBooks
+	// mu serializes everything that changes the books so matching always
+	// sees a consistent view of the resting orders
+	mu sync.Mutex
+}
+
+func NewOrderService(orderRepo *repositories.OrderRepository, db *sqlx.DB, cfg *config.Config) *OrderService {
+	return &OrderService{orderRepo: orderRepo, db: db, cfg: cfg, books: NewProductBooks()}
+}
+
+// LoadOrderBook rebuilds the in-memory order books from the open orders in
+// the database. It must be called once on startup before serving requests.
+func (s *OrderService) LoadOrderBook() error {
+	buyOrders, err := s.orderRepo.GetBuyOrders(models.OrderFilter{})
+	if err != nil {
+		return fmt.Errorf("failed to load buy orders: %w", err)
+	}
+
+	sellOrders, err := s.orderRepo.GetSellOrders(models.OrderFilter{})
+	if err != nil {
+		return fmt.Errorf("failed to load sell orders: %w", err)
+	}
+
+	s.books.Load(append(buyOrders, sellOrders...))
+	return nil
+}
+
+// withTx runs fn inside a database transaction and commits only if fn
+// succeeds. The repository passed to fn is bound to the transaction.
+func (s *OrderService) withTx(fn func(repo *repositories.OrderRepository) error) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = fn(s.orderRepo.WithTx(tx))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// matchResult collects what matching did inside a transaction so the book
+// can be brought up to date once the transaction has committed.
+type matchResult struct {
+	// changed holds the latest state of every order matching touched
+	changed []models.Order
+	// trades holds every fill written, in execution order
+	trades []models.Trade
+}
+
+// syncBook applies orders changed by a committed transaction to the book.
+func (s *OrderService) syncBook(orders []models.Order) {
+	for _, order := range orders {
+		if order.OnBook() {
+			s.books.Update(order)
+		} else {
+			s.books.Remove(order.ID)
+		}
+	}
+}
+
+// orderHold is what an order keeps reserved while it rests: the cost of the
+// remaining amount at the limit price in whole cents for a buy, the remaining
+// energy for a sell. A block order holds nothing itself, its children hold
+// for their periods.
+func orderHold(order *models.Order) (eur float64, mwh float64) {
+	if order.IsBlock() {
+		return 0, 0
+	}
+	if order.OrderType == models.OrderTypeBuy {
+		return roundMoney(order.AmountMWh * order.PriceEurPerMWh), 0
+	}
+	return 0, order.AmountMWh
+}
+
+// reserveHold takes the hold for order on its owner's balance, less what the
+// order already holds (heldEur/heldMWh), failing if the available balance is
+// too small. A smaller hold than before releases the difference.
+func (s *OrderService) reserveHold(repo *repositories.OrderRepository, order *models.Order, heldEur, heldMWh float64) error {
+	err := repo.LockUserBalances(order.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to lock user balance: %w", err)
+	}
+
+	balance, err := repo.GetUserBalance(order.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user balance: %w", err)
+	}
+
+	holdEur, holdMWh := orderHold(order)
+	eurDelta, mwhDelta := roundMoney(holdEur-heldEur), roundAmount(holdMWh-heldMWh)
+	if eurDelta > 0 && balance.AvailableEur < eurDelta {
+		return errors.New("insufficient funds")
+	}
+	if mwhDelta > 0 && balance.AvailableMWh < mwhDelta {
+		return errors.New("insufficient energy")
+	}
+
+	err = repo.ReserveBalance(order.UserID, eurDelta, mwhDelta)
+	if err != nil {
+		return fmt.Errorf("failed to reserve balance: %w", err)
+	}
+	return nil
+}
+
+// releaseHold gives back everything the order still holds.
+func (s *OrderService) releaseHold(repo *repositories.OrderRepository, order *models.Order) error {
+	holdEur, holdMWh := orderHold(order)
+	err := repo.ReserveBalance(order.UserID, -holdEur, -holdMWh)
+	if err != nil {
+		return fmt.Errorf("failed to release reserved balance: %w", err)
+	}
+	return nil
+}
+
+func (s *OrderService) CreateOrder(userID int, req models.CreateOrderRequest) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createOrder(userID, req)
+}
+
+// createOrder places a single order in its own transaction. The caller must
+// hold s.mu.
+func (s *OrderService) createOrder(userID int, req models.CreateOrderRequest) (*models.Order, error) {
+	var order *models.Order
+	var result matchResult
+	err := s.withTx(func(repo *repositories.OrderRepository) error {
+		var err error
+		order, err = s.placeOrder(repo, userID, req, &result)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.syncBook(result.changed)
+	return order, nil
+}
+
+// CreateOrders places a batch of orders. An atomic batch is placed in a
+// single transaction and fails as a whole on the first invalid order,
+// otherwise every order is placed on its own and gets its own result.
+func (s *OrderService) CreateOrders(userID int, req models.BatchOrderRequest) ([]models.BatchOrderResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]models.BatchOrderResult, 0, len(req.Orders))
+	if !req.Atomic {
+		for i, orderReq := range req.Orders {
+			order, err := s.createOrder(userID, orderReq)
+			result := models.BatchOrderResult{Index: i, Order: order}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+		return results, nil
+	}
+
+	err := s.withTx(func(repo *repositories.OrderRepository) error {
+		for i, orderReq := range req.Orders {
+			var result matchResult
+			order, err := s.placeOrder(repo, userID, orderReq, &result)
+			if err != nil {
+				return fmt.Errorf("order %d: %w", i, err)
+			}
+
+			// Later orders of the batch must see this one in the book, it is
+			// reloaded from the database if the batch rolls back
+			s.syncBook(result.changed)
+			results = append(results, models.BatchOrderResult{Index: i, Order: order})
+		}
+		return nil
+	})
+	if err != nil {
+		if loadErr := s.LoadOrderBook(); loadErr != nil {
+			log.Printf("Failed to reload order book: %v", loadErr)
+		}
+		return nil, err
+	}
+
+	return results, nil
 }
 
-func NewOrderService(orderRepo *repositories.OrderRepository) *OrderService {
-	return &OrderService{orderRepo: orderRepo}
-}
+// placeOrder validates, stores and matches a new order through repo, which
+// must be bound to a transaction. The orders it changed are added to result.
+func (s *OrderService) placeOrder(repo *repositories.OrderRepository, userID int, req models.CreateOrderRequest, result *matchResult) (*models.Order, error) {
+	order, err := s.newOrder(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if order.ProductID != nil {
+		err = s.checkProduct(repo, order)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if order.AuctionID != nil {
+		err = s.checkAuctionOrder(repo, order)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The continuous market only takes orders in session and while trading
+	// is not halted, and only at prices within the band. Stop orders are
+	// held to the band once they trigger, the limit of a block order is an
+	// average and its legs trade at the prices of the book
+	if order.AuctionID == nil {
+		err = s.checkSession(repo, order)
+		if err != nil {
+			return nil, err
+		}
+		if !order.IsBlock() && order.Status != models.OrderStatusPending {
+			err = s.checkPriceBand(repo, order)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Reserve what the order needs out of the available balance
+	err = s.reserveHold(repo, order, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Orders without their own self-trade prevention mode take the account's
+	if order.STPMode == nil {
+		order.STPMode, err = s.accountSTPMode(repo, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Orders trade from the bidding zone of their owner
+	zoneID, err := repo.GetUserZoneID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bidding zone: %w", err)
+	}
+	order.ZoneID = &zoneID
+
+	// Create the order
+	err = repo.CreateOrder(order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	// Block orders trade through their children and do not move the last
+	// trade price, so they never trigger stops
+	if order.IsBlock() {
+		err = s.placeBlock(repo, order, result)
+		if err != nil {
+			return nil, err
+		}
+		return order, nil
+	}
+
+	// Match the new order against the opposite side of the market,
+	// stop orders wait for their trigger and auction orders for the clearing
+	if order.Status == models.OrderStatusOpen && order.AuctionID == nil {
+		err = s.executeOrder(repo, order, result)
+		if err != nil {
+			return nil, fmt.Errorf("order execution failed: %w", err)
+		}
+	}
+
+	// New trades may trigger stop orders, and a new stop order may
+	// already be triggered by the last trade
+	if len(result.trades) > 0 || order.Status == models.OrderStatusPending {
+		err = s.triggerStops(repo, result, order)
+		if err != nil {
+			return nil, fmt.Errorf("stop order execution failed: %w", err)
+		}
+	}
+	return order, nil
+}
+
+// newOrder builds an order from a request, filling in the protection price
+// of market orders from the current best opposite price and of stop orders
+// from their stop price.
+func (s *OrderService) newOrder(userID int, req models.CreateOrderRequest) (*models.Order, error) {
+	order := &models.Order{
+		UserID:             userID,
+		OrderType:          req.OrderType,
+		OrderKind:          req.OrderKind,
+		AmountMWh:          req.AmountMWh,
+		OriginalAmountMWh:  req.AmountMWh,
+		PriceEurPerMWh:     req.PriceEurPerMWh,
+		MaxNotionalEur:     req.MaxNotionalEur,
+		StopPriceEurPerMWh: req.StopPriceEurPerMWh,
+		ProductID:          req.ProductID,
+		Status:             models.OrderStatusOpen,
+	}
+	if req.STPMode != "" {
+		order.STPMode = &req.STPMode
+	}
+	if order.OrderKind == "" {
+		order.OrderKind = models.OrderKindLimit
+	}
+	if !isLotMultiple(order.AmountMWh, s.cfg.LotSizeMWh) {
+		return nil, fmt.Errorf("amount_mwh must be a multiple of the lot size of %v MWh", s.cfg.LotSizeMWh)
+	}
+
+	isStop := order.OrderKind == models.OrderKindStop || order.OrderKind == models.OrderKindStopLimit
+	if isStop {
+		if req.StopPriceEurPerMWh == nil {
+			return nil, errors.New("stop orders require stop_price_eur_per_mwh")
+		}
+		order.Status = models.OrderStatusPending
+	} else if req.StopPriceEurPerMWh != nil {
+		return nil, errors.New("stop_price_eur_per_mwh only applies to stop orders")
+	}
+
+	switch order.OrderKind {
+	case models.OrderKindLimit, models.OrderKindStopLimit:
+		if order.PriceEurPerMWh <= 0 {
+			return nil, errors.New("limit orders require price_eur_per_mwh")
+		}
+		if req.MaxSlippagePct != nil || req.MaxNotionalEur != nil {
+			return nil, errors.New("max_slippage_pct and max_notional_eur only apply to market orders")
+		}
+	default:
+		if order.PriceEurPerMWh != 0 {
+			return nil, errors.New("market orders must not set price_eur_per_mwh, use max_slippage_pct instead")
+		}
+
+		slippage := s.cfg.MarketMaxSlippagePct
+		if req.MaxSlippagePct != nil {
+			slippage = *req.MaxSlippagePct
+		}
+		order.MaxSlippagePct = &slippage
+
+		// A market order is protected relative to the book, a stop order
+		// relative to the price that triggers it
+		reference := 0.0
+		if isStop {
+			reference = *order.StopPriceEurPerMWh
+		} else {
+			best, ok := s.books.Book(order.ProductID).BestPrice(opposite(order.OrderType), time.Now())
+			if !ok {
+				return nil, fmt.Errorf("no %s orders available for a market order", opposite(order.OrderType))
+			}
+			reference = best
+		}
+		order.PriceEurPerMWh = protectionPrice(order.OrderType, reference, slippage)
+	}
+
+	err := applyTimeInForce(order, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only orders that can rest on the book may be icebergs
+	if req.DisplayAmountMWh != nil {
+		isLimit := order.OrderKind == models.OrderKindLimit || order.OrderKind == models.OrderKindStopLimit
+		if !isLimit || (order.TimeInForce != models.TimeInForceGTC && order.TimeInForce != models.TimeInForceGTD) {
+			return nil, errors.New("display_amount_mwh only applies to gtc and gtd limit orders")
+		}
+		if *req.DisplayAmountMWh >= order.AmountMWh {
+			return nil, errors.New("display_amount_mwh must be less than amount_mwh")
+		}
+		if !isLotMultiple(*req.DisplayAmountMWh, s.cfg.LotSizeMWh) {
+			return nil, fmt.Errorf("display_amount_mwh must be a multiple of the lot size of %v MWh", s.cfg.LotSizeMWh)
+		}
+		order.DisplayAmountMWh = req.DisplayAmountMWh
+		order.VisibleAmountMWh = req.DisplayAmountMWh
+	}
+
+	// Post-only orders must rest, so they have to be good-till limit orders
+	if req.PostOnly || req.PostOnlyReprice {
+		if order.OrderKind != models.OrderKindLimit || (order.TimeInForce != models.TimeInForceGTC && order.TimeInForce != models.TimeInForceGTD) {
+			return nil, errors.New("post_only only applies to gtc and gtd limit orders")
+		}
+		order.PostOnly = true
+		order.PostOnlyReprice = req.PostOnlyReprice
+
+		order.PriceEurPerMWh, err = s.postOnlyPrice(order)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Block orders trade the same amount in each of their periods
+	isBlock := req.BlockFirstPeriod != nil || req.BlockLastPeriod != nil
+	if isBlock {
+		if req.BlockFirstPeriod == nil || req.BlockLastPeriod == nil {
+			return nil, errors.New("block orders require both block_first_period and block_last_period")
+		}
+		if *req.BlockFirstPeriod > *req.BlockLastPeriod || *req.BlockLastPeriod > auctionPeriods {
+			return nil, fmt.Errorf("block periods must be between 1 and %d with block_first_period first", auctionPeriods)
+		}
+		if req.DeliveryPeriod != nil {
+			return nil, errors.New("block orders use block_first_period and block_last_period instead of delivery_period")
+		}
+		if req.AuctionID == nil && req.ProductID == nil {
+			return nil, errors.New("block orders in the continuous market require the product_id of their delivery day")
+		}
+		order.BlockFirstPeriod = req.BlockFirstPeriod
+		order.BlockLastPeriod = req.BlockLastPeriod
+	}
+
+	// Auction orders wait for the clearing instead of matching and block
+	// orders are all or none, so both are plain good-till-canceled limit orders
+	if req.AuctionID != nil || req.DeliveryPeriod != nil || isBlock {
+		if req.AuctionID != nil && req.DeliveryPeriod == nil && !isBlock {
+			return nil, errors.New("auction orders require a delivery_period or block periods")
+		}
+		if req.DeliveryPeriod != nil && req.AuctionID == nil {
+			return nil, errors.New("delivery_period only applies to auction orders")
+		}
+		if order.OrderKind != models.OrderKindLimit || order.TimeInForce != models.TimeInForceGTC {
+			return nil, errors.New("auction and block orders must be gtc limit orders")
+		}
+		if order.DisplayAmountMWh != nil || order.PostOnly {
+			return nil, errors.New("auction and block orders cannot be icebergs or post-only")
+		}
+		if order.ProductID != nil && req.AuctionID != nil {
+			return nil, errors.New("product_id does not apply to auction orders")
+		}
+		order.AuctionID = req.AuctionID
+		order.DeliveryPeriod = req.DeliveryPeriod
+	}
+	return order, nil
+}
+
+// tickSize is the smallest price step, prices are kept in whole cents.
+const tickSize = 0.01
+
+// postOnlyPrice checks that a post-only order does not cross the opposite
+// side of the book. A crossing order is rejected, or if it allows repricing,
+// moved one tick behind the best opposite price.
+func (s *OrderService) postOnlyPrice(order *models.Order) (float64, error) {
+	best, ok := s.books.Book(order.ProductID).BestPrice(opposite(order.OrderType), time.Now())
+	if !ok {
+		return order.PriceEurPerMWh, nil
+	}
+
+	price, bestKey := priceKey(order.PriceEurPerMWh), priceKey(best)
+	crosses := price <= bestKey
+	if order.OrderType == models.OrderTypeBuy {
+		crosses = price >= bestKey
+	}
+	if !crosses {
+		return order.PriceEurPerMWh, nil
+	}
+
+	if !order.PostOnlyReprice {
+		return 0, errors.New("post-only order would trade immediately")
+	}
+
+	repriced := float64(bestKey+1) / 100
+	if order.OrderType == models.OrderTypeBuy {
+		repriced = float64(bestKey-1) / 100
+	}
+	if repriced < tickSize {
+		return 0, errors.New("post-only order cannot be repriced below the minimum price")
+	}
+	return repriced, nil
+}
+
+// accountSTPMode is the self-trade prevention mode chosen by the user, or the
+// server default when there is none.
+func (s *OrderService) accountSTPMode(repo *repositories.OrderRepository, userID int) (*models.STPMode, error) {
+	mode, err := repo.GetUserSTPMode(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stp mode: %w", err)
+	}
+	if mode == nil {
+		defaultMode := models.STPMode(s.cfg.DefaultSTPMode)
+		mode = &defaultMode
+	}
+	return mode, nil
+}
+
+func opposite(orderType models.OrderType) models.OrderType {
+	if orderType == models.OrderTypeBuy {
+		return models.OrderTypeSell
+	}
+	return models.OrderTypeBuy
+}
+
+// applyTimeInForce sets and validates the time in force of a new order.
+func applyTimeInForce(order *models.Order, req models.CreateOrderRequest) error {
+	order.TimeInForce = req.TimeInForce
+	isMarket := order.OrderKind == models.OrderKindMarket || order.OrderKind == models.OrderKindStop
+	if order.TimeInForce == "" {
+		order.TimeInForce = models.TimeInForceGTC
+		if isMarket {
+			order.TimeInForce = models.TimeInForceIOC
+		}
+	}
+
+	if isMarket && order.TimeInForce != models.TimeInForceIOC && order.TimeInForce != models.TimeInForceFOK {
+		return errors.New("market and stop orders must be ioc or fok")
+	}
+
+	if order.TimeInForce != models.TimeInForceGTD {
+		if req.ExpiresAt != nil {
+			return errors.New("expires_at is only allowed for gtd orders")
+		}
+		return nil
+	}
+
+	if req.ExpiresAt == nil {
+		return errors.New("gtd orders require expires_at")
+	}
+	if !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	order.ExpiresAt = req.ExpiresAt
+	return nil
+}
+
+// protectionPrice is the worst price a market order accepts: the reference
+// price moved against the order by slippagePct, rounded to a cent inside the
+// allowed range.
+func protectionPrice(orderType models.OrderType, reference, slippagePct float64) float64 {
+	if orderType == models.OrderTypeBuy {
+		return math.Floor(reference*(1+slippagePct/100)*100) / 100
+	}
+	return math.Ceil(reference*(1-slippagePct/100)*100) / 100
+}
+
+// executeOrder matches the incoming order against the book. All fills are
+// written through repo, which must be bound to a transaction, and the book
+// itself is left untouched: the orders whose state changed are added to
+// result so the caller can apply them once the transaction has committed.
+func (s *OrderService) executeOrder(repo *repositories.OrderRepository, incoming *models.Order, result *matchResult) error {
+	now := time.Now()
+
+	// Nothing trades while the market is not open or trading is halted. An
+	// order that gets here anyway (a stop triggered just before the halt, a
+	// queued order) waits in the book if it can and is canceled otherwise
+	state, _, err := s.marketState(repo, incoming.ProductID, now)
+	if err != nil {
+		return err
+	}
+	if state != models.MarketStateOpen {
+		if canQueue(incoming) {
+			return s.queueOrder(repo, incoming, result)
+		}
+
+		reason := models.CancelReasonHalt
+		if state != models.MarketStateHalted {
+			reason = models.CancelReasonClosed
+		}
+		err = s.cancelRemainder(repo, incoming, reason)
+		if err != nil {
+			return err
+		}
+		result.changed = append(result.changed, *incoming)
+		return nil
+	}
+
+	breaker, err := s.newCircuitBreaker(repo, incoming.ProductID, now)
+	if err != nil {
+		return err
+	}
+
+	// A fill-or-kill order that cannot be filled completely is canceled
+	// before anything trades
+	if incoming.TimeInForce == models.TimeInForceFOK {
+		fillable, err := s.fillableAmount(repo, incoming, breaker)
+		if err != nil {
+			return err
+		}
+		if fillable < incoming.AmountMWh {
+			err = s.cancelRemainder(repo, incoming, models.CancelReasonFOK)
+			if err != nil {
+				return err
+			}
+			result.changed = append(result.changed, *incoming)
+			return nil
+		}
+	}
+
+	algorithm, err := s.matchingAlgorithm(repo, incoming)
+	if err != nil {
+		return err
+	}
+
+	m := &levelMatch{
+		incoming:  incoming,
+		algorithm: algorithm,
+		capacity:  newZoneCapacity(incoming, s.cfg.LotSizeMWh),
+		breaker:   breaker,
+		lotMWh:    s.cfg.LotSizeMWh,
+		now:       now,
+		result:    result,
+	}
+
+	// Try to match with the resting orders on the other side of the book,
+	// one price level at a time
+match:
+	for _, level := range s.books.Book(incoming.ProductID).CrossingLevels(incoming) {
+		// The orders ahead of an order of the same user are matched first,
+		// then self-trade prevention decides whether matching goes on
+		var queue []*models.Order
+		for _, candidate := range level {
+			// Expired orders are left for the expiry worker to take off the book
+			if isExpired(&candidate, m.now) {
+				continue
+			}
+
+			// Lock the resting order and work from its committed state
+			resting, err := repo.LockOrderByID(candidate.ID)
+			if err != nil {
+				return fmt.Errorf("failed to lock resting order: %w", err)
+			}
+			if !resting.Status.Resting() {
+				continue
+			}
+
+			if incoming.UserID != resting.UserID {
+				queue = append(queue, resting)
+				continue
+			}
+
+			more, err := s.fillLevel(repo, m, queue)
+			if err != nil {
+				return err
+			}
+			if !more || incoming.AmountMWh <= 0 {
+				break match
+			}
+			queue = nil
+
+			// Prevent self-trading
+			err = s.preventSelfTrade(repo, incoming, resting, result)
+			if err != nil {
+				return err
+			}
+			if !incoming.Status.Resting() {
+				break match
+			}
+		}
+
+		more, err := s.fillLevel(repo, m, queue)
+		if err != nil {
+			return err
+		}
+		if !more || incoming.AmountMWh <= 0 {
+			break
+		}
+	}
+
+	// The circuit breaker stopped a trade: the product is halted and what is
+	// left of the order waits for trading to resume if it can rest, otherwise
+	// it is canceled
+	halted := breaker != nil && breaker.tripped != nil
+	if halted {
+		err = s.haltTrading(repo, incoming.ProductID, breaker, now)
+		if err != nil {
+			return err
+		}
+		if !canQueue(incoming) {
+			err = s.cancelRemainder(repo, incoming, models.CancelReasonHalt)
+			if err != nil {
+				return err
+			}
+			result.changed = append(result.changed, *incoming)
+			return nil
+		}
+	}
+
+	// Self-trade prevention already canceled what was left
+	if incoming.Status == models.OrderStatusCanceled {
+		result.changed = append(result.changed, *incoming)
+		return nil
+	}
+
+	// An iceberg about to rest shows a fresh tranche of what is left
+	if incoming.DisplayAmountMWh != nil {
+		visible := math.Min(*incoming.DisplayAmountMWh, incoming.AmountMWh)
+		incoming.VisibleAmountMWh = &visible
+	}
+
+	// Update incoming order, an unfilled remainder rests on the book
+	err = s.updateRemaining(repo, incoming, incoming.AmountMWh)
+	if err != nil {
+		return fmt.Errorf("failed to update incoming order: %w", err)
+	}
+
+	if halted && incoming.Status.Resting() {
+		return s.queueOrder(repo, incoming, result)
+	}
+
+	// Only good-till orders rest, whatever is left of the others is canceled
+	if incoming.Status.Resting() {
+		switch incoming.TimeInForce {
+		case models.TimeInForceFOK:
+			// The book promised a complete fill, roll everything back
+			return errors.New("fill-or-kill order could not be filled completely")
+		case models.TimeInForceIOC:
+			err = s.cancelRemainder(repo, incoming, models.CancelReasonIOC)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	result.changed = append(result.changed, *incoming)
+
+	return nil
+}
+
+// levelMatch is the state of an incoming order while it is matched against
+// the book.
+type levelMatch struct {
+	incoming  *models.Order
+	algorithm MatchingAlgorithm
+	capacity  *zoneCapacity
+	breaker   *circuitBreaker
+	lotMWh    float64
+	now       time.Time
+	result    *matchResult
+	// tradedEur is the value traded so far, for the notional cap
+	tradedEur float64
+}
+
+// matchingAlgorithm is the algorithm that shares fills out within a price
+// level of the order's book, set by MATCHING_ALGORITHM unless the product
+// chooses its own.
+func (s *OrderService) matchingAlgorithm(repo *repositories.OrderRepository, order *models.Order) (MatchingAlgorithm, error) {
+	name := s.cfg.MatchingAlgorithm
+	if order.ProductID != nil {
+		product, err := repo.GetProductByID(*order.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get product: %w", err)
+		}
+		if product.MatchingAlgorithm != nil {
+			name = *product.MatchingAlgorithm
+		}
+	}
+	return NewMatchingAlgorithm(name)
+}
+
+// fillLevel matches the incoming order against queue, resting orders of a
+// single price level in time priority, sharing the fills out with the
+// matching algorithm. An iceberg offers its visible tranche, once that is
+// refilled it queues up again behind the rest of the level. Orders in other
+// bidding zones offer no more than the transmission capacity left, which is
+// checked again on every fill as several of them may share it. fillLevel reports
+// false when the notional cap of the incoming order or the circuit breaker
+// stops all further trading.
+func (s *OrderService) fillLevel(repo *repositories.OrderRepository, m *levelMatch, queue []*models.Order) (bool, error) {
+	incoming := m.incoming
+	for len(queue) > 0 && incoming.AmountMWh > 0 {
+		// Trades execute at the resting orders' price, stay within the
+		// notional cap of a market order
+		price := queue[0].PriceEurPerMWh
+		if !m.breaker.allows(price) {
+			m.breaker.trip(price)
+			return false, nil
+		}
+		amount := capToNotional(incoming, m.tradedEur, price, incoming.AmountMWh, m.lotMWh)
+		if amount <= 0 {
+			return false, nil
+		}
+
+		offers := make([]float64, len(queue))
+		for i, resting := range queue {
+			offer := resting.AmountMWh
+			if resting.VisibleAmountMWh != nil {
+				offer = *resting.VisibleAmountMWh
+			}
+
+			var err error
+			offers[i], err = m.capacity.limit(repo, resting, offer)
+			if err != nil {
+				return false, err
+			}
+		}
+		fills := m.algorithm.Allocate(offers, amount, m.lotMWh)
+
+		var next, refilled []*models.Order
+		traded := false
+		for i, resting := range queue {
+			if fills[i] > 0 {
+				var err error
+				fills[i], err = m.capacity.limit(repo, resting, fills[i])
+				if err != nil {
+					return false, err
+				}
+			}
+			if fills[i] <= 0 {
+				next = append(next, resting)
+				continue
+			}
+
+			err := s.fillResting(repo, m, resting, fills[i])
+			if err != nil {
+				return false, err
+			}
+			traded = true
 
-func (s *OrderService) CreateOrder(userID int, req models.CreateOrderRequest) (*models.Order, error) {
-	// Check user balance
-	money, energy, err := s.orderRepo.GetUserBalance(userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user balance: %w", err)
-	}
+			wasRefilled := consumeTranche(resting, fills[i], m.now)
+			err = s.updateRemaining(repo, resting, roundAmount(resting.AmountMWh-fills[i]))
+			if err != nil {
+				return false, fmt.Errorf("failed to update resting order: %w", err)
+			}
+			m.result.changed = append(m.result.changed, *resting)
 
-	// Validate order based on type
-	if req.OrderType == models.OrderTypeBuy {
-		totalCost := req.AmountMWh * req.PriceEurPerMWh
-		if money < totalCost {
-			return nil, errors.New("insufficient funds")
+			if wasRefilled {
+				refilled = append(refilled, resting)
+			} else if resting.Status.Resting() {
+				next = append(next, resting)
+			}
 		}
-	} else if req.OrderType == models.OrderTypeSell {
-		if energy < req.AmountMWh {
-			return nil, errors.New("insufficient energy")
+
+		// Nothing left that fits a lot
+		if !traded {
+			return true, nil
 		}
+		queue = append(next, refilled...)
 	}
+	return true, nil
+}
 
-	// Create the order
-	order := &models.Order{
-		UserID:         userID,
-		OrderType:      req.OrderType,
-		AmountMWh:      req.AmountMWh,
-		PriceEurPerMWh: req.PriceEurPerMWh,
-		Status:         models.OrderStatusOpen,
+// fillResting executes a fill of amountMWh between the incoming order and a
+// resting order at the resting order's price.
+func (s *OrderService) fillResting(repo *repositories.OrderRepository, m *levelMatch, resting *models.Order, amountMWh float64) error {
+	incoming := m.incoming
+	buyer, seller := incoming, resting
+	if incoming.OrderType == models.OrderTypeSell {
+		buyer, seller = resting, incoming
 	}
 
-	err = s.orderRepo.CreateOrder(order)
+	aggressor := incoming.OrderType
+	trade, err := s.executeFill(repo, buyer, seller, &aggressor, amountMWh, resting.PriceEurPerMWh)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
+		return err
 	}
-
-	// If it's a buy order, execute it immediately
-	if req.OrderType == models.OrderTypeBuy {
-		err = s.executeBuyOrder(order)
-		if err != nil {
-			// If execution fails, we should probably cancel the order
-			// For now, just return the error
-			return nil, fmt.Errorf("buy order created but execution failed: %w", err)
-		}
+	err = m.capacity.use(repo, resting, amountMWh)
+	if err != nil {
+		return err
 	}
+	m.result.trades = append(m.result.trades, *trade)
+	recordFill(incoming, amountMWh, resting.PriceEurPerMWh)
+	recordFill(resting, amountMWh, resting.PriceEurPerMWh)
 
-	return order, nil
+	incoming.AmountMWh = roundAmount(incoming.AmountMWh - amountMWh)
+	m.tradedEur += amountMWh * resting.PriceEurPerMWh
+	return nil
 }
 
-func (s *OrderService) executeBuyOrder(buyOrder *models.Order) error {
-	// Get available sell orders
-	sellOrders, err := s.orderRepo.GetSellOrders(models.OrderFilter{})
-	if err != nil {
-		return fmt.Errorf("failed to get sell orders: %w", err)
+// stpMode is the self-trade prevention mode of an order, orders placed before
+// modes existed cancel the incoming side.
+func stpMode(order *models.Order) models.STPMode {
+	if order.STPMode == nil {
+		return models.STPCancelNewest
 	}
+	return *order.STPMode
+}
 
-	remainingAmount := buyOrder.AmountMWh
-	totalCost := 0.0
+// preventSelfTrade resolves an incoming order crossing a resting order of the
+// same user according to the incoming order's mode. Orders it cancels or
+// reduces record the mode in STPAction. The incoming order is left with
+// Status canceled when it may not match any further.
+func (s *OrderService) preventSelfTrade(repo *repositories.OrderRepository, incoming, resting *models.Order, result *matchResult) error {
+	mode := stpMode(incoming)
+	cancelIncoming := mode == models.STPCancelNewest || mode == models.STPCancelBoth
+	cancelResting := mode == models.STPCancelOldest || mode == models.STPCancelBoth
 
-	// Try to match with existing sell orders
-	for _, sellOrder := range sellOrders {
-		if remainingAmount <= 0 {
-			break
+	if mode == models.STPDecrementAndCancel {
+		overlap := math.Min(incoming.AmountMWh, resting.AmountMWh)
+		for _, order := range []*models.Order{incoming, resting} {
+			err := s.reduceOrder(repo, order, overlap)
+			if err != nil {
+				return err
+			}
+			order.STPAction = &mode
 		}
+		cancelIncoming = incoming.AmountMWh <= 0
+		cancelResting = resting.AmountMWh <= 0
 
-		// Check if sell price is acceptable
-		if sellOrder.PriceEurPerMWh > buyOrder.PriceEurPerMWh {
-			continue // Skip if sell price is higher than buy price
+		if !cancelResting {
+			err := repo.UpdateOrder(resting.ID, map[string]interface{}{
+				"amount_mwh":         resting.AmountMWh,
+				"visible_amount_mwh": resting.VisibleAmountMWh,
+				"stp_action":         mode,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to decrement resting order: %w", err)
+			}
+			result.changed = append(result.changed, *resting)
 		}
+	}
 
-		// Calculate how much we can buy from this sell order
-		amountToBuy := remainingAmount
-		if sellOrder.AmountMWh < amountToBuy {
-			amountToBuy = sellOrder.AmountMWh
+	if cancelResting {
+		resting.STPAction = &mode
+		err := s.cancelRemainder(repo, resting, models.CancelReasonSelfTrade)
+		if err != nil {
+			return err
 		}
+		result.changed = append(result.changed, *resting)
+	}
+
+	if cancelIncoming {
+		incoming.STPAction = &mode
+		return s.cancelRemainder(repo, incoming, models.CancelReasonSelfTrade)
+	}
+	return nil
+}
+
+// reduceOrder takes amountMWh off an order without trading it, releasing the
+// matching part of its hold. Only the in-memory order is changed.
+func (s *OrderService) reduceOrder(repo *repositories.OrderRepository, order *models.Order, amountMWh float64) error {
+	heldEur, heldMWh := orderHold(order)
+	order.AmountMWh = roundAmount(order.AmountMWh - amountMWh)
+	if order.VisibleAmountMWh != nil && *order.VisibleAmountMWh > order.AmountMWh {
+		visible := order.AmountMWh
+		order.VisibleAmountMWh = &visible
+	}
+
+	holdEur, holdMWh := orderHold(order)
+	err := repo.ReserveBalance(order.UserID, roundMoney(holdEur-heldEur), roundAmount(holdMWh-heldMWh))
+	if err != nil {
+		return fmt.Errorf("failed to release reserved balance: %w", err)
+	}
+	return nil
+}
 
-		// Prevent self-trading
-		if buyOrder.UserID == sellOrder.UserID {
-			continue // Skip if buyer and seller are the same user
+// triggerStops activates the pending stop orders that the last trade price
+// has reached and matches them like newly placed orders. Their fills move the
+// price again, so this repeats until no further stop triggers. placed is the
+// order that started the run, updated in place if it gets triggered. Only
+// stops in the product of placed are affected.
+func (s *OrderService) triggerStops(repo *repositories.OrderRepository, result *matchResult, placed *models.Order) error {
+	for {
+		lastPrice, ok, err := repo.GetLastTradePrice(placed.ProductID)
+		if err != nil {
+			return fmt.Errorf("failed to get last trade price: %w", err)
+		}
+		if !ok {
+			return nil
 		}
 
-		// Execute the transaction
-		err = s.executeTransaction(buyOrder.UserID, sellOrder.UserID, amountToBuy, sellOrder.PriceEurPerMWh, &buyOrder.ID, &sellOrder.ID)
+		stops, err := repo.GetTriggeredStopOrders(placed.ProductID, lastPrice)
 		if err != nil {
-			return fmt.Errorf("failed to execute transaction: %w", err)
+			return fmt.Errorf("failed to get triggered stop orders: %w", err)
+		}
+		if len(stops) == 0 {
+			return nil
 		}
 
-		// Update sell order
-		remainingSellAmount := sellOrder.AmountMWh - amountToBuy
-		if remainingSellAmount <= 0 {
-			// Sell order is completely fulfilled, mark as completed
-			updates := map[string]interface{}{
-				"status": models.OrderStatusCompleted,
+		for i := range stops {
+			stop := &stops[i]
+			if stop.ID == placed.ID {
+				stop = placed
 			}
-			err = s.orderRepo.UpdateOrder(sellOrder.ID, updates)
+
+			err = s.activateStop(repo, stop)
 			if err != nil {
-				return fmt.Errorf("failed to update sell order: %w", err)
+				return err
 			}
-		} else {
-			// Sell order is partially fulfilled, update remaining amount
-			updates := map[string]interface{}{
-				"amount_mwh": remainingSellAmount,
+			inBand, err := s.checkTriggeredStop(repo, stop, result)
+			if err != nil {
+				return err
+			}
+			if !inBand {
+				continue
+			}
+
+			err = s.executeOrder(repo, stop, result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// activateStop converts a triggered stop order into the market or limit
+// order it stands for and opens it.
+func (s *OrderService) activateStop(repo *repositories.OrderRepository, order *models.Order) error {
+	now := time.Now()
+	order.Status = models.OrderStatusOpen
+	order.TriggeredAt = &now
+	if order.OrderKind == models.OrderKindStop {
+		order.OrderKind = models.OrderKindMarket
+	} else {
+		order.OrderKind = models.OrderKindLimit
+	}
+
+	err := repo.UpdateOrder(order.ID, map[string]interface{}{
+		"status":       order.Status,
+		"order_kind":   order.OrderKind,
+		"triggered_at": now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to activate stop order: %w", err)
+	}
+	return nil
+}
+
+// fillableAmount is how much of the incoming order the book could fill right
+// now, following the same rules as executeOrder, up to the first price the
+// circuit breaker stops. The transmission capacity it needs is locked through
+// repo.
+func (s *OrderService) fillableAmount(repo *repositories.OrderRepository, incoming *models.Order, breaker *circuitBreaker) (float64, error) {
+	fillable := 0.0
+	tradedEur := 0.0
+	now := time.Now()
+	capacity := newZoneCapacity(incoming, s.cfg.LotSizeMWh)
+
+	// Hidden iceberg reserves refill within the same level, so their whole
+	// remaining amount counts
+	for _, level := range s.books.Book(incoming.ProductID).CrossingLevels(incoming) {
+		for _, resting := range level {
+			if fillable >= incoming.AmountMWh {
+				return fillable, nil
+			}
+			if isExpired(&resting, now) {
+				continue
+			}
+			if !breaker.allows(resting.PriceEurPerMWh) {
+				return fillable, nil
 			}
-			err = s.orderRepo.UpdateOrder(sellOrder.ID, updates)
+			if incoming.UserID == resting.UserID {
+				// Only canceling the resting order lets the incoming one go on
+				if stpMode(incoming) == models.STPCancelOldest {
+					continue
+				}
+				return fillable, nil
+			}
+
+			amount := math.Min(resting.AmountMWh, incoming.AmountMWh-fillable)
+			amount, err := capacity.limit(repo, &resting, amount)
 			if err != nil {
-				return fmt.Errorf("failed to update sell order: %w", err)
+				return 0, err
+			}
+			// A congested interconnector only rules out this order
+			if amount <= 0 {
+				continue
+			}
+			amount = capToNotional(incoming, tradedEur, resting.PriceEurPerMWh, amount, s.cfg.LotSizeMWh)
+			if amount <= 0 {
+				return fillable, nil
 			}
+
+			capacity.take(&resting, amount)
+			fillable = roundAmount(fillable + amount)
+			tradedEur += amount * resting.PriceEurPerMWh
 		}
+	}
+
+	return fillable, nil
+}
+
+// capToNotional limits a fill so the order stays within its notional cap,
+// given what it has already traded, in whole lots.
+func capToNotional(order *models.Order, tradedEur, priceEurPerMWh, amountMWh, lotMWh float64) float64 {
+	if order.MaxNotionalEur == nil {
+		return amountMWh
+	}
+	affordable := floorToLot((*order.MaxNotionalEur-tradedEur)/priceEurPerMWh, lotMWh)
+	return math.Min(amountMWh, affordable)
+}
+
+// roundMoney rounds a euro amount to the cent, the precision balances are
+// stored with.
+func roundMoney(eur float64) float64 {
+	return math.Round(eur*100) / 100
+}
+
+// roundAmount rounds an energy amount to the precision it is stored with so
+// repeated partial fills do not leave floating point dust behind.
+func roundAmount(amountMWh float64) float64 {
+	return math.Round(amountMWh*1e6) / 1e6
+}
+
+func isExpired(order *models.Order, now time.Time) bool {
+	return order.TimeInForce == models.TimeInForceGTD && order.ExpiresAt != nil && !order.ExpiresAt.After(now)
+}
+
+// consumeTranche takes a fill of amountMWh off the visible tranche of an
+// iceberg order. Once the tranche is used up and a hidden reserve is left, the
+// next tranche is shown and the order loses its time priority. It reports
+// whether that happened; orders without a display amount are left alone.
+func consumeTranche(order *models.Order, amountMWh float64, now time.Time) bool {
+	if order.VisibleAmountMWh == nil {
+		return false
+	}
+
+	remaining := roundAmount(order.AmountMWh - amountMWh)
+	visible := roundAmount(*order.VisibleAmountMWh - amountMWh)
+	refilled := visible <= 0 && remaining > 0
+	if refilled {
+		visible = math.Min(*order.DisplayAmountMWh, remaining)
+		order.PriorityAt = now
+	}
+	order.VisibleAmountMWh = &visible
+	return refilled
+}
 
-		remainingAmount -= amountToBuy
-		totalCost += amountToBuy * sellOrder.PriceEurPerMWh
+// recordFill adds a fill of amountMWh at priceEurPerMWh to the filled amount
+// and average fill price of an order. Only the in-memory order is changed.
+func recordFill(order *models.Order, amountMWh, priceEurPerMWh float64) {
+	filled := roundAmount(order.FilledAmountMWh + amountMWh)
+	avg := priceEurPerMWh
+	if order.AvgFillPrice != nil {
+		avg = (*order.AvgFillPrice*order.FilledAmountMWh + priceEurPerMWh*amountMWh) / filled
 	}
+	order.FilledAmountMWh = filled
+	order.AvgFillPrice = &avg
+}
 
-	// Update buy order
+// updateRemaining marks an order completed once nothing is left to trade,
+// otherwise stores the remaining amount so it keeps resting on the book.
+// Either way the fills recorded on the order and the self-trade prevention
+// that reduced it are written with it.
+func (s *OrderService) updateRemaining(repo *repositories.OrderRepository, order *models.Order, remainingAmount float64) error {
 	if remainingAmount <= 0 {
 		// Order is completely fulfilled, mark as completed
+		order.Status = models.OrderStatusCompleted
+		order.AmountMWh = 0
 		updates := map[string]interface{}{
-			"status": models.OrderStatusCompleted,
-		}
-		err = s.orderRepo.UpdateOrder(buyOrder.ID, updates)
-		if err != nil {
-			return fmt.Errorf("failed to update buy order: %w", err)
-		}
-	} else {
-		// Order is partially fulfilled, update remaining amount
-		updates := map[string]interface{}{
-			"amount_mwh": remainingAmount,
+			"status":            models.OrderStatusCompleted,
+			"amount_mwh":        0,
+			"filled_amount_mwh": order.FilledAmountMWh,
+			"avg_fill_price":    order.AvgFillPrice,
 		}
-		err = s.orderRepo.UpdateOrder(buyOrder.ID, updates)
-		if err != nil {
-			return fmt.Errorf("failed to update buy order: %w", err)
+		if order.STPAction != nil {
+			updates["stp_action"] = *order.STPAction
 		}
+		return repo.UpdateOrder(order.ID, updates)
+	}
+
+	// Order is partially fulfilled, update remaining amount
+	if order.FilledAmountMWh > 0 {
+		order.Status = models.OrderStatusPartial
+	}
+	order.AmountMWh = remainingAmount
+	updates := map[string]interface{}{
+		"status":            order.Status,
+		"amount_mwh":        remainingAmount,
+		"filled_amount_mwh": order.FilledAmountMWh,
+		"avg_fill_price":    order.AvgFillPrice,
+		"priority_at":       order.PriorityAt,
+	}
+	if order.VisibleAmountMWh != nil {
+		updates["visible_amount_mwh"] = *order.VisibleAmountMWh
+	}
+	if order.STPAction != nil {
+		updates["stp_action"] = *order.STPAction
+	}
+	return repo.UpdateOrder(order.ID, updates)
+}
+
+// cancelRemainder cancels the unfilled part of an order that may not rest on
+// the book any longer (market, ioc and fok orders, self-trade prevention, user
+// cancels) and releases what it still holds. The order row is kept.
+func (s *OrderService) cancelRemainder(repo *repositories.OrderRepository, order *models.Order, reason models.CancelReason) error {
+	err := s.releaseHold(repo, order)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	order.Status = models.OrderStatusCanceled
+	order.CanceledAt = &now
+	order.CancelReason = &reason
+	updates := map[string]interface{}{
+		"status":            models.OrderStatusCanceled,
+		"canceled_at":       now,
+		"cancel_reason":     reason,
+		"amount_mwh":        order.AmountMWh,
+		"filled_amount_mwh": order.FilledAmountMWh,
+		"avg_fill_price":    order.AvgFillPrice,
+	}
+	if order.STPAction != nil {
+		updates["stp_action"] = *order.STPAction
 	}
 
+	err = repo.UpdateOrder(order.ID, updates)
+	if err != nil {
+		return fmt.Errorf("failed to cancel order remainder: %w", err)
+	}
 	return nil
 }
 
-func (s *OrderService) executeTransaction(buyerID, sellerID int, amountMWh, priceEurPerMWh float64, buyOrderID *int, sellOrderID *int) error {
+// executeFill records a trade between two orders: the trade itself, a
+// transaction row for each side and the matching balance changes, all through
+// the caller's transaction. aggressor is the side of the incoming order, nil
+// for auction fills.
+func (s *OrderService) executeFill(repo *repositories.OrderRepository, buyOrder, sellOrder *models.Order, aggressor *models.OrderType, amountMWh, priceEurPerMWh float64) (*models.Trade, error) {
 	totalEur := amountMWh * priceEurPerMWh
 
+	err := repo.LockUserBalances(buyOrder.UserID, sellOrder.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock balances: %w", err)
+	}
+
+	trade := &models.Trade{
+		BuyOrderID:     &buyOrder.ID,
+		SellOrderID:    &sellOrder.ID,
+		BuyerID:        &buyOrder.UserID,
+		SellerID:       &sellOrder.UserID,
+		ProductID:      buyOrder.ProductID,
+		AuctionID:      buyOrder.AuctionID,
+		BuyerZoneID:    buyOrder.ZoneID,
+		SellerZoneID:   sellOrder.ZoneID,
+		AggressorSide:  aggressor,
+		AmountMWh:      amountMWh,
+		PriceEurPerMWh: priceEurPerMWh,
+		TotalEur:       totalEur,
+	}
+
+	err = repo.CreateTrade(trade)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trade: %w", err)
+	}
+
+	// Market data covers the continuous market only and leaves block trades
+	// out, like the last trade price
+	if trade.AuctionID == nil && buyOrder.ParentOrderID == nil && sellOrder.ParentOrderID == nil {
+		err = repo.RecordCandles(trade)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record candles: %w", err)
+		}
+	}
+
 	// Create transaction for buyer
 	buyerTransaction := &models.Transaction{
-		UserID:          buyerID,
-		OrderID:         buyOrderID,
+		UserID:          buyOrder.UserID,
+		OrderID:         &buyOrder.ID,
+		TradeID:         &trade.ID,
 		TransactionType: models.OrderTypeBuy,
 		AmountMWh:       amountMWh,
 		PriceEurPerMWh:  priceEurPerMWh,
 		TotalEur:        totalEur,
 	}
 
-	err := s.orderRepo.CreateTransaction(buyerTransaction)
+	err = repo.CreateTransaction(buyerTransaction)
 	if err != nil {
-		return fmt.Errorf("failed to create buyer transaction: %w", err)
+		return nil, fmt.Errorf("failed to create buyer transaction: %w", err)
 	}
 
 	// Create transaction for seller
 	sellerTransaction := &models.Transaction{
-		UserID:          sellerID,
-		OrderID:         sellOrderID,
+		UserID:          sellOrder.UserID,
+		OrderID:         &sellOrder.ID,
+		TradeID:         &trade.ID,
 		TransactionType: models.OrderTypeSell,
 		AmountMWh:       amountMWh,
 		PriceEurPerMWh:  priceEurPerMWh,
 		TotalEur:        totalEur,
 	}
 
-	err = s.orderRepo.CreateTransaction(sellerTransaction)
+	err = repo.CreateTransaction(sellerTransaction)
 	if err != nil {
-		return fmt.Errorf("failed to create seller transaction: %w", err)
+		return nil, fmt.Errorf("failed to create seller transaction: %w", err)
 	}
 
 	// Update balances
 	// Buyer: loses money, gains energy
-	err = s.orderRepo.UpdateUserBalance(buyerID, -totalEur, amountMWh)
+	err = repo.UpdateUserBalance(buyOrder.UserID, -totalEur, amountMWh)
 	if err != nil {
-		return fmt.Errorf("failed to update buyer balance: %w", err)
+		return nil, fmt.Errorf("failed to update buyer balance: %w", err)
 	}
 
 	// Seller: gains money, loses energy
-	err = s.orderRepo.UpdateUserBalance(sellerID, totalEur, -amountMWh)
+	err = repo.UpdateUserBalance(sellOrder.UserID, totalEur, -amountMWh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update seller balance: %w", err)
+	}
+
+	// Consume the holds, the buyer's is taken at the limit price so any
+	// price improvement goes back to the available balance. The release is
+	// the difference between the order's holds before and after the fill, so
+	// the cents rounded off the hold add up when the order is done
+	heldEur, _ := orderHold(buyOrder)
+	remaining := *buyOrder
+	remaining.AmountMWh = roundAmount(buyOrder.AmountMWh - amountMWh)
+	holdEur, _ := orderHold(&remaining)
+	err = repo.ReserveBalance(buyOrder.UserID, roundMoney(holdEur-heldEur), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release buyer hold: %w", err)
+	}
+
+	err = repo.ReserveBalance(sellOrder.UserID, 0, -amountMWh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release seller hold: %w", err)
+	}
+
+	return trade, nil
+}
+
+// RunExpiryWorker expires good-till-date orders every interval until ctx is
+// canceled. It is meant to run in its own goroutine.
+func (s *OrderService) RunExpiryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := s.ExpireOrders(now); err != nil {
+				log.Printf("Failed to expire orders: %v", err)
+			}
+		}
+	}
+}
+
+// ExpireOrders moves resting and pending good-till-date orders past their expiry
+// to the expired status, releasing what they hold and taking them off the book.
+func (s *OrderService) ExpireOrders(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders, err := s.orderRepo.GetExpiredOrders(now)
 	if err != nil {
-		return fmt.Errorf("failed to update seller balance: %w", err)
+		return fmt.Errorf("failed to get expired orders: %w", err)
+	}
+
+	for _, expired := range orders {
+		err = s.withTx(func(repo *repositories.OrderRepository) error {
+			order, err := repo.LockOrderByID(expired.ID)
+			if err != nil {
+				return err
+			}
+			if !order.Status.Resting() && order.Status != models.OrderStatusPending {
+				return nil
+			}
+
+			err = s.releaseHold(repo, order)
+			if err != nil {
+				return err
+			}
+
+			return repo.UpdateOrder(order.ID, map[string]interface{}{
+				"status": models.OrderStatusExpired,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to expire order %d: %w", expired.ID, err)
+		}
+
+		s.books.Remove(expired.ID)
 	}
 
 	return nil
@@ -202,63 +1373,306 @@ func (s *OrderService) GetOrdersByUser(userID int, filter models.OrderFilter) ([
 	return s.orderRepo.GetOrdersByUser(userID, filter)
 }
 
+// GetSellOrders lists the open sell orders as the public sees them, icebergs
+// only show their visible tranche.
 func (s *OrderService) GetSellOrders(filter models.OrderFilter) ([]models.Order, error) {
-	return s.orderRepo.GetSellOrders(filter)
-}
+	orders, err := s.orderRepo.GetSellOrders(filter)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *OrderService) GetOrderByID(id int) (*models.Order, error) {
-	return s.orderRepo.GetOrderByID(id)
+	for i := range orders {
+		orders[i] = orders[i].Public()
+	}
+	return orders, nil
 }
 
-func (s *OrderService) UpdateOrder(id int, userID int, req models.UpdateOrderRequest) error {
-	// Check if order exists and belongs to user
+// GetOrderByID returns an order, a block order together with its children.
+func (s *OrderService) GetOrderByID(id int) (*models.Order, error) {
 	order, err := s.orderRepo.GetOrderByID(id)
 	if err != nil {
-		return fmt.Errorf("order not found: %w", err)
+		return nil, err
 	}
 
-	if order.UserID != userID {
-		return errors.New("unauthorized: order does not belong to user")
+	if order.IsBlock() {
+		order.Children, err = s.orderRepo.GetChildOrders(order.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block orders: %w", err)
+		}
 	}
+	return order, nil
+}
 
-	if order.Status != models.OrderStatusOpen {
-		return errors.New("cannot update order: order is not open")
-	}
+// UpdateOrder amends a resting order. A new price or a larger size sends the
+// order to the back of the queue, is checked against the available balance
+// and matched again if the new price crosses the book, or queued again before
+// the open. A smaller size keeps the order's time priority.
+func (s *OrderService) UpdateOrder(id int, userID int, req models.UpdateOrderRequest) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Build updates map
-	updates := make(map[string]interface{})
-	if req.AmountMWh != nil {
-		updates["amount_mwh"] = *req.AmountMWh
-	}
-	if req.PriceEurPerMWh != nil {
-		updates["price_eur_per_mwh"] = *req.PriceEurPerMWh
+	var order *models.Order
+	var result matchResult
+	err := s.withTx(func(repo *repositories.OrderRepository) error {
+		// Check if order exists and belongs to user
+		var err error
+		order, err = repo.LockOrderByID(id)
+		if err != nil {
+			return fmt.Errorf("order not found: %w", err)
+		}
+
+		if order.UserID != userID {
+			return errors.New("unauthorized: order does not belong to user")
+		}
+
+		if !order.Status.Resting() {
+			return errors.New("cannot update order: order is not open")
+		}
+		if order.IsBlock() || order.ParentOrderID != nil {
+			return errors.New("cannot update order: block orders must be canceled and placed again")
+		}
+		if order.ProductID != nil {
+			err = s.checkProduct(repo, order)
+			if err != nil {
+				return err
+			}
+		}
+		if order.AuctionID != nil {
+			err = s.checkAuctionOrder(repo, order)
+			if err != nil {
+				return err
+			}
+		} else {
+			err = s.checkSession(repo, order)
+			if err != nil {
+				return err
+			}
+		}
+
+		heldEur, heldMWh := orderHold(order)
+		losesPriority := false
+
+		// Build updates map
+		updates := make(map[string]interface{})
+		if req.AmountMWh != nil {
+			if *req.AmountMWh <= order.FilledAmountMWh {
+				return fmt.Errorf("amount_mwh must be greater than the filled amount of %v MWh", order.FilledAmountMWh)
+			}
+			if !isLotMultiple(*req.AmountMWh, s.cfg.LotSizeMWh) {
+				return fmt.Errorf("amount_mwh must be a multiple of the lot size of %v MWh", s.cfg.LotSizeMWh)
+			}
+
+			remaining := roundAmount(*req.AmountMWh - order.FilledAmountMWh)
+			losesPriority = remaining > order.AmountMWh
+			order.AmountMWh = remaining
+			order.OriginalAmountMWh = *req.AmountMWh
+			updates["amount_mwh"] = order.AmountMWh
+			updates["original_amount_mwh"] = order.OriginalAmountMWh
+
+			// An iceberg never shows more than it has left
+			if order.VisibleAmountMWh != nil && *order.VisibleAmountMWh > order.AmountMWh {
+				visible := order.AmountMWh
+				order.VisibleAmountMWh = &visible
+				updates["visible_amount_mwh"] = visible
+			}
+		}
+		repriced := req.PriceEurPerMWh != nil && priceKey(*req.PriceEurPerMWh) != priceKey(order.PriceEurPerMWh)
+		if repriced {
+			order.PriceEurPerMWh = *req.PriceEurPerMWh
+			losesPriority = true
+
+			// A post-only order may not be amended into the book either
+			if order.PostOnly {
+				order.PriceEurPerMWh, err = s.postOnlyPrice(order)
+				if err != nil {
+					return err
+				}
+			}
+			if order.AuctionID == nil {
+				err = s.checkPriceBand(repo, order)
+				if err != nil {
+					return err
+				}
+			}
+			updates["price_eur_per_mwh"] = order.PriceEurPerMWh
+		}
+
+		if losesPriority {
+			order.PriorityAt = time.Now()
+			updates["priority_at"] = order.PriorityAt
+		}
+
+		// Resize the hold to the amended order
+		err = s.reserveHold(repo, order, heldEur, heldMWh)
+		if err != nil {
+			return err
+		}
+
+		err = repo.UpdateOrder(id, updates)
+		if err != nil {
+			return fmt.Errorf("failed to update order: %w", err)
+		}
+
+		// Only a new price can make the order cross the book, auction
+		// orders are not matched until the clearing
+		if !repriced || order.AuctionID != nil {
+			result.changed = append(result.changed, *order)
+			return nil
+		}
+
+		err = s.executeOrder(repo, order, &result)
+		if err != nil {
+			return fmt.Errorf("order execution failed: %w", err)
+		}
+
+		if len(result.trades) > 0 {
+			err = s.triggerStops(repo, &result, order)
+			if err != nil {
+				return fmt.Errorf("stop order execution failed: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.orderRepo.UpdateOrder(id, updates)
+	// Keep the book in sync, a lost priority moves the order to the back
+	s.syncBook(result.changed)
+	return order, nil
 }
 
-func (s *OrderService) DeleteOrder(id int, userID int) error {
-	// Check if order exists and belongs to user
-	order, err := s.orderRepo.GetOrderByID(id)
+// CancelOrder cancels a resting or pending order on behalf of its owner. The
+// order stays queryable with status canceled.
+func (s *OrderService) CancelOrder(id int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.withTx(func(repo *repositories.OrderRepository) error {
+		// Check if order exists and belongs to user
+		order, err := repo.LockOrderByID(id)
+		if err != nil {
+			return fmt.Errorf("order not found: %w", err)
+		}
+
+		if order.UserID != userID {
+			return errors.New("unauthorized: order does not belong to user")
+		}
+
+		if !order.Status.Resting() && order.Status != models.OrderStatusPending {
+			return errors.New("cannot cancel order: order is not open")
+		}
+		if order.ParentOrderID != nil {
+			return errors.New("cannot cancel order: cancel its block order instead")
+		}
+		if order.AuctionID != nil {
+			err = s.checkAuctionOrder(repo, order)
+			if err != nil {
+				return err
+			}
+		}
+
+		if order.IsBlock() {
+			legs, err := repo.LockChildOrders(order.ID)
+			if err != nil {
+				return fmt.Errorf("failed to get block orders: %w", err)
+			}
+			return s.closeBlock(repo, order, orderRefs(legs), models.CancelReasonUser)
+		}
+		return s.cancelRemainder(repo, order, models.CancelReasonUser)
+	})
 	if err != nil {
-		return fmt.Errorf("order not found: %w", err)
+		return err
 	}
 
-	if order.UserID != userID {
-		return errors.New("unauthorized: order does not belong to user")
-	}
+	s.books.Remove(id)
+	return nil
+}
+
+// CancelAllOrders cancels every resting and pending order of the user that
+// matches the filter in a single transaction and returns the canceled orders.
+func (s *OrderService) CancelAllOrders(userID int, filter models.CancelAllRequest) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if order.Status != models.OrderStatusOpen {
-		return errors.New("cannot delete order: order is not open")
+	var canceled []models.Order
+	err := s.withTx(func(repo *repositories.OrderRepository) error {
+		orders, err := repo.LockActiveOrdersByUser(userID, filter)
+		if err != nil {
+			return fmt.Errorf("failed to get orders: %w", err)
+		}
+
+		// Children are canceled with their block order, never on their own
+		canceled = make([]models.Order, 0, len(orders))
+		for i := range orders {
+			order := &orders[i]
+			if order.ParentOrderID != nil {
+				continue
+			}
+
+			if order.IsBlock() {
+				legs, err := repo.LockChildOrders(order.ID)
+				if err != nil {
+					return fmt.Errorf("failed to get block orders: %w", err)
+				}
+				err = s.closeBlock(repo, order, orderRefs(legs), models.CancelReasonUser)
+			} else {
+				err = s.cancelRemainder(repo, order, models.CancelReasonUser)
+			}
+			if err != nil {
+				return err
+			}
+			canceled = append(canceled, *order)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.orderRepo.DeleteOrder(id)
+	s.syncBook(canceled)
+	return canceled, nil
 }
 
 func (s *OrderService) GetTransactionsByUser(userID int) ([]models.Transaction, error) {
 	return s.orderRepo.GetTransactionsByUser(userID)
 }
 
-func (s *OrderService) GetUserBalance(userID int) (money float64, energy float64, err error) {
+// GetTrades returns the public tape. Order ids are left out so counterparties
+// cannot be traced back through GET /orders/:id.
+func (s *OrderService) GetTrades(filter models.TradeFilter) ([]models.Trade, error) {
+	trades, err := s.orderRepo.GetTrades(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range trades {
+		trades[i].BuyOrderID = nil
+		trades[i].SellOrderID = nil
+	}
+	return trades, nil
+}
+
+// GetTradesByUser returns the user's own fills with the side they traded on.
+// Only the user's order id is kept, the counterparty stays anonymous.
+func (s *OrderService) GetTradesByUser(userID int, filter models.TradeFilter) ([]models.Trade, error) {
+	trades, err := s.orderRepo.GetTradesByUser(userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range trades {
+		if trades[i].BuyerID != nil && *trades[i].BuyerID == userID {
+			trades[i].Side = models.OrderTypeBuy
+			trades[i].SellOrderID = nil
+		} else {
+			trades[i].Side = models.OrderTypeSell
+			trades[i].BuyOrderID = nil
+		}
+	}
+	return trades, nil
+}
+
+func (s *OrderService) GetUserBalance(userID int) (*models.Balance, error) {
 	return s.orderRepo.GetUserBalance(userID)
 } 
\ No newline at end of file
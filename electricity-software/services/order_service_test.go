@@ -0,0 +1,1327 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// fill is a trade with the resting order at index resting of a test case.
+type fill struct {
+	resting int
+	amount  float64
+	price   float64
+}
+
+// checkFills compares the stored trades of the incoming order with want.
+func checkFills(t *testing.T, s *OrderService, incoming *models.Order, resting []*models.Order, want []fill) {
+	t.Helper()
+
+	trades := storedTrades(t, s)
+	if len(trades) != len(want) {
+		t.Fatalf("got %d trades, want %d", len(trades), len(want))
+	}
+	for i, w := range want {
+		restingID := *trades[i].BuyOrderID
+		if incoming.OrderType == models.OrderTypeBuy {
+			restingID = *trades[i].SellOrderID
+		}
+		if restingID != resting[w.resting].ID || trades[i].AmountMWh != w.amount || trades[i].PriceEurPerMWh != w.price {
+			t.Errorf("trade %d = order %d, %v MWh at %v, want order %d, %v MWh at %v",
+				i, restingID, trades[i].AmountMWh, trades[i].PriceEurPerMWh, resting[w.resting].ID, w.amount, w.price)
+		}
+	}
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
+
+func TestMatchingPriceTimePriority(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+
+	tests := []struct {
+		name       string
+		resting    []models.CreateOrderRequest
+		incoming   models.CreateOrderRequest
+		want       []fill
+		wantStatus models.OrderStatus
+		wantAmount float64
+	}{
+		{
+			name:       "a sell takes the highest bids first",
+			resting:    []models.CreateOrderRequest{limitOrder(buy, 50, 1), limitOrder(buy, 52, 1), limitOrder(buy, 51, 1)},
+			incoming:   limitOrder(sell, 49, 2),
+			want:       []fill{{1, 1, 52}, {2, 1, 51}},
+			wantStatus: models.OrderStatusCompleted,
+		},
+		{
+			name:       "equal bids fill oldest first",
+			resting:    []models.CreateOrderRequest{limitOrder(buy, 50, 1), limitOrder(buy, 50, 1)},
+			incoming:   limitOrder(sell, 50, 1),
+			want:       []fill{{0, 1, 50}},
+			wantStatus: models.OrderStatusCompleted,
+		},
+		{
+			name:       "trades at the resting price",
+			resting:    []models.CreateOrderRequest{limitOrder(buy, 55, 1)},
+			incoming:   limitOrder(sell, 50, 1),
+			want:       []fill{{0, 1, 55}},
+			wantStatus: models.OrderStatusCompleted,
+		},
+		{
+			name:       "a sell above every bid rests",
+			resting:    []models.CreateOrderRequest{limitOrder(buy, 50, 1)},
+			incoming:   limitOrder(sell, 51, 1),
+			wantStatus: models.OrderStatusOpen,
+			wantAmount: 1,
+		},
+		{
+			name:       "the unfilled remainder rests",
+			resting:    []models.CreateOrderRequest{limitOrder(buy, 50, 1)},
+			incoming:   limitOrder(sell, 50, 3),
+			want:       []fill{{0, 1, 50}},
+			wantStatus: models.OrderStatusPartial,
+			wantAmount: 2,
+		},
+		{
+			name:       "a buy takes the lowest asks first",
+			resting:    []models.CreateOrderRequest{limitOrder(sell, 51, 1), limitOrder(sell, 50, 1), limitOrder(sell, 50, 1)},
+			incoming:   limitOrder(buy, 51, 2.5),
+			want:       []fill{{1, 1, 50}, {2, 1, 50}, {0, 0.5, 51}},
+			wantStatus: models.OrderStatusCompleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+			var resting []*models.Order
+			for _, req := range tt.resting {
+				resting = append(resting, placeOrder(t, s, maker, req))
+			}
+			incoming := placeOrder(t, s, taker, tt.incoming)
+
+			checkFills(t, s, incoming, resting, tt.want)
+
+			got := storedOrder(t, s, incoming.ID)
+			if got.Status != tt.wantStatus || got.AmountMWh != tt.wantAmount {
+				t.Errorf("incoming order is %s with %v MWh left, want %s with %v MWh", got.Status, got.AmountMWh, tt.wantStatus, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestTradeExecutionIsAtomic(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail makes the transaction of the buy fail after it has matched
+		fail       bool
+		wantTrades int
+		wantBuyer  models.Balance
+		wantSeller models.Balance
+	}{
+		{
+			name:       "a fill settles both sides",
+			wantTrades: 1,
+			wantBuyer:  models.Balance{MoneyEur: 900, EnergyMWh: 2},
+			wantSeller: models.Balance{MoneyEur: 100, EnergyMWh: 8},
+		},
+		{
+			name:       "a failed transaction leaves nothing behind",
+			fail:       true,
+			wantBuyer:  models.Balance{MoneyEur: 1000},
+			wantSeller: models.Balance{EnergyMWh: 10, ReservedMWh: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			buyer := testUser(t, s, "buyer", "BG", 1000, 0)
+			seller := testUser(t, s, "seller", "BG", 0, 10)
+			resting := placeOrder(t, s, seller, limitOrder(models.OrderTypeSell, 50, 2))
+
+			failure := errors.New("failure after matching")
+			err := s.withTx(func(repo *repositories.OrderRepository) error {
+				var result matchResult
+				_, err := s.placeOrder(repo, buyer, limitOrder(models.OrderTypeBuy, 50, 2), &result)
+				if err != nil {
+					return err
+				}
+				if len(result.trades) != 1 {
+					t.Errorf("matched %d trades inside the transaction, want 1", len(result.trades))
+				}
+				if tt.fail {
+					return failure
+				}
+				return nil
+			})
+			if tt.fail != (err == failure) {
+				t.Fatalf("withTx() error = %v", err)
+			}
+
+			var transactions int
+			if err := s.db.Get(&transactions, "SELECT COUNT(*) FROM transactions"); err != nil {
+				t.Fatalf("failed to count transactions: %v", err)
+			}
+			if trades := len(storedTrades(t, s)); trades != tt.wantTrades || transactions != 2*tt.wantTrades {
+				t.Errorf("got %d trades and %d transactions, want %d and %d", trades, transactions, tt.wantTrades, 2*tt.wantTrades)
+			}
+
+			checkBalance(t, s, buyer, tt.wantBuyer)
+			checkBalance(t, s, seller, tt.wantSeller)
+
+			wantStatus := models.OrderStatusCompleted
+			if tt.fail {
+				wantStatus = models.OrderStatusOpen
+			}
+			if got := storedOrder(t, s, resting.ID); got.Status != wantStatus {
+				t.Errorf("resting order is %s, want %s", got.Status, wantStatus)
+			}
+		})
+	}
+}
+
+func TestOrderHold(t *testing.T) {
+	first, last := 1, 2
+
+	tests := []struct {
+		name    string
+		order   models.Order
+		wantEur float64
+		wantMWh float64
+	}{
+		{"a buy holds its cost", models.Order{OrderType: models.OrderTypeBuy, AmountMWh: 2, PriceEurPerMWh: 50.25}, 100.5, 0},
+		{"the cost is held in whole cents", models.Order{OrderType: models.OrderTypeBuy, AmountMWh: 0.333, PriceEurPerMWh: 10}, 3.33, 0},
+		{"a sell holds its energy", models.Order{OrderType: models.OrderTypeSell, AmountMWh: 3, PriceEurPerMWh: 50}, 0, 3},
+		{"a block holds nothing itself", models.Order{OrderType: models.OrderTypeBuy, AmountMWh: 2, PriceEurPerMWh: 50, BlockFirstPeriod: &first, BlockLastPeriod: &last}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eur, mwh := orderHold(&tt.order)
+			if eur != tt.wantEur || mwh != tt.wantMWh {
+				t.Errorf("orderHold() = %v, %v, want %v, %v", eur, mwh, tt.wantEur, tt.wantMWh)
+			}
+		})
+	}
+}
+
+func TestHoldReserveAndRelease(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+
+	tests := []struct {
+		name string
+		// run places orders for the buyer and the seller
+		run        func(t *testing.T, s *OrderService, buyer, seller int)
+		wantBuyer  models.Balance
+		wantSeller models.Balance
+	}{
+		{
+			name: "resting orders hold their cost and energy",
+			run: func(t *testing.T, s *OrderService, buyer, seller int) {
+				placeOrder(t, s, buyer, limitOrder(buy, 50.25, 2))
+				placeOrder(t, s, seller, limitOrder(sell, 60, 3))
+			},
+			wantBuyer:  models.Balance{MoneyEur: 1000, ReservedEur: 100.5},
+			wantSeller: models.Balance{EnergyMWh: 10, ReservedMWh: 3},
+		},
+		{
+			name: "a fill at a better price releases the difference",
+			run: func(t *testing.T, s *OrderService, buyer, seller int) {
+				placeOrder(t, s, seller, limitOrder(sell, 40, 2))
+				placeOrder(t, s, buyer, limitOrder(buy, 50, 3))
+			},
+			wantBuyer:  models.Balance{MoneyEur: 920, ReservedEur: 50, EnergyMWh: 2},
+			wantSeller: models.Balance{MoneyEur: 80, EnergyMWh: 8},
+		},
+		{
+			name: "canceling releases the hold",
+			run: func(t *testing.T, s *OrderService, buyer, seller int) {
+				order := placeOrder(t, s, buyer, limitOrder(buy, 50, 2))
+				if err := s.CancelOrder(order.ID, buyer); err != nil {
+					t.Fatalf("CancelOrder() failed: %v", err)
+				}
+			},
+			wantBuyer:  models.Balance{MoneyEur: 1000},
+			wantSeller: models.Balance{EnergyMWh: 10},
+		},
+		{
+			name: "an order beyond the available balance is rejected",
+			run: func(t *testing.T, s *OrderService, buyer, seller int) {
+				placeOrder(t, s, buyer, limitOrder(buy, 100, 6))
+				if _, err := s.CreateOrder(buyer, limitOrder(buy, 100, 5)); err == nil {
+					t.Errorf("CreateOrder() took a buy the available funds do not cover")
+				}
+				if _, err := s.CreateOrder(seller, limitOrder(sell, 100, 11)); err == nil {
+					t.Errorf("CreateOrder() took a sell the available energy does not cover")
+				}
+			},
+			wantBuyer:  models.Balance{MoneyEur: 1000, ReservedEur: 600},
+			wantSeller: models.Balance{EnergyMWh: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			buyer := testUser(t, s, "buyer", "BG", 1000, 0)
+			seller := testUser(t, s, "seller", "BG", 0, 10)
+
+			tt.run(t, s, buyer, seller)
+
+			checkBalance(t, s, buyer, tt.wantBuyer)
+			checkBalance(t, s, seller, tt.wantSeller)
+		})
+	}
+}
+
+func TestProtectionPrice(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderType models.OrderType
+		reference float64
+		slippage  float64
+		want      float64
+	}{
+		{"a buy accepts prices above the reference", models.OrderTypeBuy, 50, 5, 52.5},
+		{"a sell accepts prices below the reference", models.OrderTypeSell, 50, 5, 47.5},
+		{"a buy rounds down to the cent", models.OrderTypeBuy, 33.33, 10, 36.66},
+		{"a sell rounds up to the cent", models.OrderTypeSell, 33.33, 10, 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := protectionPrice(tt.orderType, tt.reference, tt.slippage); got != tt.want {
+				t.Errorf("protectionPrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapToNotional(t *testing.T) {
+	notional := 100.0
+
+	tests := []struct {
+		name      string
+		cap       *float64
+		tradedEur float64
+		price     float64
+		amount    float64
+		want      float64
+	}{
+		{"no cap", nil, 0, 50, 5, 5},
+		{"within the cap", &notional, 0, 10, 5, 5},
+		{"what is left of the cap", &notional, 40, 20, 5, 3},
+		{"whole lots only", &notional, 0, 30, 5, 3.3},
+		{"less than a lot left", &notional, 99, 20, 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{MaxNotionalEur: tt.cap}
+			if got := capToNotional(order, tt.tradedEur, tt.price, tt.amount, 0.1); got != tt.want {
+				t.Errorf("capToNotional() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarketOrders(t *testing.T) {
+	buy, sell := models.OrderTypeBuy, models.OrderTypeSell
+	market := func(orderType models.OrderType, amount, slippage float64, notional *float64) models.CreateOrderRequest {
+		return models.CreateOrderRequest{
+			OrderType:      orderType,
+			OrderKind:      models.OrderKindMarket,
+			AmountMWh:      amount,
+			MaxSlippagePct: &slippage,
+			MaxNotionalEur: notional,
+		}
+	}
+	notional := 150.0
+
+	tests := []struct {
+		name       string
+		resting    []models.CreateOrderRequest
+		incoming   models.CreateOrderRequest
+		wantPrice  float64
+		wantPrices []float64
+		wantFilled float64
+	}{
+		{
+			name:       "a buy sweeps the asks up to its protection price",
+			resting:    []models.CreateOrderRequest{limitOrder(sell, 50, 1), limitOrder(sell, 52, 1), limitOrder(sell, 53, 1)},
+			incoming:   market(buy, 3, 5, nil),
+			wantPrice:  52.5,
+			wantPrices: []float64{50, 52},
+			wantFilled: 2,
+		},
+		{
+			name:       "a sell sweeps the bids down to its protection price",
+			resting:    []models.CreateOrderRequest{limitOrder(buy, 50, 1), limitOrder(buy, 47, 1), limitOrder(buy, 48, 1)},
+			incoming:   market(sell, 3, 4, nil),
+			wantPrice:  48,
+			wantPrices: []float64{50, 48},
+			wantFilled: 2,
+		},
+		{
+			name:       "the notional cap stops the sweep",
+			resting:    []models.CreateOrderRequest{limitOrder(sell, 50, 2), limitOrder(sell, 50, 2)},
+			incoming:   market(buy, 4, 5, &notional),
+			wantPrice:  52.5,
+			wantPrices: []float64{50, 50},
+			wantFilled: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+			for _, req := range tt.resting {
+				placeOrder(t, s, maker, req)
+			}
+			incoming := placeOrder(t, s, taker, tt.incoming)
+
+			var prices []float64
+			for _, trade := range storedTrades(t, s) {
+				prices = append(prices, trade.PriceEurPerMWh)
+			}
+			if !reflect.DeepEqual(prices, tt.wantPrices) {
+				t.Errorf("traded at %v, want %v", prices, tt.wantPrices)
+			}
+
+			// What the market order could not fill is canceled, never rested
+			got := storedOrder(t, s, incoming.ID)
+			if got.PriceEurPerMWh != tt.wantPrice || got.FilledAmountMWh != tt.wantFilled {
+				t.Errorf("order has protection price %v and filled %v MWh, want %v and %v", got.PriceEurPerMWh, got.FilledAmountMWh, tt.wantPrice, tt.wantFilled)
+			}
+			if got.Status != models.OrderStatusCanceled || got.CancelReason == nil || *got.CancelReason != models.CancelReasonIOC {
+				t.Errorf("order is %s (%v), want canceled as immediate or cancel", got.Status, got.CancelReason)
+			}
+		})
+	}
+
+	t.Run("an empty book rejects the order", func(t *testing.T) {
+		s := testService(t)
+		taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+		if _, err := s.CreateOrder(taker, market(buy, 1, 5, nil)); err == nil {
+			t.Errorf("CreateOrder() took a market order without any asks")
+		}
+	})
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Second), now.Add(time.Second)
+
+	tests := []struct {
+		name  string
+		order models.Order
+		want  bool
+	}{
+		{"gtd past its expiry", models.Order{TimeInForce: models.TimeInForceGTD, ExpiresAt: &before}, true},
+		{"gtd expiring now", models.Order{TimeInForce: models.TimeInForceGTD, ExpiresAt: &now}, true},
+		{"gtd before its expiry", models.Order{TimeInForce: models.TimeInForceGTD, ExpiresAt: &after}, false},
+		{"gtc never expires", models.Order{TimeInForce: models.TimeInForceGTC, ExpiresAt: &before}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isExpired(&tt.order, now); got != tt.want {
+				t.Errorf("isExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTimeInForce(t *testing.T) {
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name    string
+		kind    models.OrderKind
+		req     models.CreateOrderRequest
+		want    models.TimeInForce
+		wantErr bool
+	}{
+		{"limit orders default to gtc", models.OrderKindLimit, models.CreateOrderRequest{}, models.TimeInForceGTC, false},
+		{"market orders default to ioc", models.OrderKindMarket, models.CreateOrderRequest{}, models.TimeInForceIOC, false},
+		{"market fok", models.OrderKindMarket, models.CreateOrderRequest{TimeInForce: models.TimeInForceFOK}, models.TimeInForceFOK, false},
+		{"market gtc", models.OrderKindMarket, models.CreateOrderRequest{TimeInForce: models.TimeInForceGTC}, "", true},
+		{"stop gtd", models.OrderKindStop, models.CreateOrderRequest{TimeInForce: models.TimeInForceGTD, ExpiresAt: &future}, "", true},
+		{"gtd", models.OrderKindLimit, models.CreateOrderRequest{TimeInForce: models.TimeInForceGTD, ExpiresAt: &future}, models.TimeInForceGTD, false},
+		{"gtd without expires_at", models.OrderKindLimit, models.CreateOrderRequest{TimeInForce: models.TimeInForceGTD}, "", true},
+		{"gtd in the past", models.OrderKindLimit, models.CreateOrderRequest{TimeInForce: models.TimeInForceGTD, ExpiresAt: &past}, "", true},
+		{"expires_at without gtd", models.OrderKindLimit, models.CreateOrderRequest{ExpiresAt: &future}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{OrderKind: tt.kind}
+			err := applyTimeInForce(order, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyTimeInForce() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && order.TimeInForce != tt.want {
+				t.Errorf("time in force = %s, want %s", order.TimeInForce, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeInForce(t *testing.T) {
+	withTIF := func(req models.CreateOrderRequest, tif models.TimeInForce) models.CreateOrderRequest {
+		req.TimeInForce = tif
+		return req
+	}
+	ask := limitOrder(models.OrderTypeSell, 50, 2)
+
+	tests := []struct {
+		name       string
+		incoming   models.CreateOrderRequest
+		wantTraded float64
+		wantStatus models.OrderStatus
+		wantReason *models.CancelReason
+	}{
+		{
+			name:       "gtc rests what is left",
+			incoming:   limitOrder(models.OrderTypeBuy, 50, 3),
+			wantTraded: 2,
+			wantStatus: models.OrderStatusPartial,
+		},
+		{
+			name:       "ioc cancels what is left",
+			incoming:   withTIF(limitOrder(models.OrderTypeBuy, 50, 3), models.TimeInForceIOC),
+			wantTraded: 2,
+			wantStatus: models.OrderStatusCanceled,
+			wantReason: reason(models.CancelReasonIOC),
+		},
+		{
+			name:       "fok that cannot fill completely trades nothing",
+			incoming:   withTIF(limitOrder(models.OrderTypeBuy, 50, 3), models.TimeInForceFOK),
+			wantTraded: 0,
+			wantStatus: models.OrderStatusCanceled,
+			wantReason: reason(models.CancelReasonFOK),
+		},
+		{
+			name:       "fok that fills completely",
+			incoming:   withTIF(limitOrder(models.OrderTypeBuy, 50, 2), models.TimeInForceFOK),
+			wantTraded: 2,
+			wantStatus: models.OrderStatusCompleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+			resting := placeOrder(t, s, maker, ask)
+			incoming := placeOrder(t, s, taker, tt.incoming)
+
+			traded := 0.0
+			for _, trade := range storedTrades(t, s) {
+				traded += trade.AmountMWh
+			}
+			if traded != tt.wantTraded {
+				t.Errorf("traded %v MWh, want %v", traded, tt.wantTraded)
+			}
+
+			got := storedOrder(t, s, incoming.ID)
+			if got.Status != tt.wantStatus {
+				t.Errorf("incoming order is %s, want %s", got.Status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(got.CancelReason, tt.wantReason) {
+				t.Errorf("cancel reason = %v, want %v", got.CancelReason, tt.wantReason)
+			}
+
+			// A killed order leaves the resting one untouched
+			if tt.wantTraded == 0 && storedOrder(t, s, resting.ID).AmountMWh != ask.AmountMWh {
+				t.Errorf("the resting order was changed by a killed order")
+			}
+		})
+	}
+}
+
+func TestExpireOrders(t *testing.T) {
+	s := testService(t)
+	seller := testUser(t, s, "seller", "BG", 0, 10)
+
+	expiresAt := time.Now().Add(time.Hour)
+	req := limitOrder(models.OrderTypeSell, 50, 2)
+	req.TimeInForce = models.TimeInForceGTD
+	req.ExpiresAt = &expiresAt
+	gtd := placeOrder(t, s, seller, req)
+	gtc := placeOrder(t, s, seller, limitOrder(models.OrderTypeSell, 51, 3))
+
+	tests := []struct {
+		name         string
+		now          time.Time
+		wantStatus   models.OrderStatus
+		wantReserved float64
+		wantBook     int
+	}{
+		{"before the expiry", expiresAt.Add(-time.Minute), models.OrderStatusOpen, 5, 2},
+		{"at the expiry", expiresAt, models.OrderStatusExpired, 3, 1},
+	}
+
+	// The cases run in order against the same orders
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.ExpireOrders(tt.now)
+			if err != nil {
+				t.Fatalf("ExpireOrders() failed: %v", err)
+			}
+
+			if got := storedOrder(t, s, gtd.ID).Status; got != tt.wantStatus {
+				t.Errorf("gtd order is %s, want %s", got, tt.wantStatus)
+			}
+			if got := storedOrder(t, s, gtc.ID).Status; got != models.OrderStatusOpen {
+				t.Errorf("gtc order is %s, want open", got)
+			}
+			checkBalance(t, s, seller, models.Balance{EnergyMWh: 10, ReservedMWh: tt.wantReserved})
+			if got := s.books.Book(nil).Len(); got != tt.wantBook {
+				t.Errorf("book holds %d orders, want %d", got, tt.wantBook)
+			}
+		})
+	}
+}
+
+func TestStopOrders(t *testing.T) {
+	stop := func(orderType models.OrderType, kind models.OrderKind, stopPrice, price float64) models.CreateOrderRequest {
+		return models.CreateOrderRequest{
+			OrderType:          orderType,
+			OrderKind:          kind,
+			PriceEurPerMWh:     price,
+			AmountMWh:          1,
+			StopPriceEurPerMWh: &stopPrice,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		stop    models.CreateOrderRequest
+		resting models.CreateOrderRequest
+		// trigger is the price of a trade between two other users after
+		// the stop order was placed
+		trigger    float64
+		wantPrices []float64
+		wantStatus models.OrderStatus
+		wantKind   models.OrderKind
+	}{
+		{
+			name:       "a sell stop triggers at its stop price and trades as a market order",
+			stop:       stop(models.OrderTypeSell, models.OrderKindStop, 45, 0),
+			resting:    limitOrder(models.OrderTypeBuy, 44, 1),
+			trigger:    45,
+			wantPrices: []float64{45, 44},
+			wantStatus: models.OrderStatusCompleted,
+			wantKind:   models.OrderKindMarket,
+		},
+		{
+			name:       "a sell stop stays pending above its stop price",
+			stop:       stop(models.OrderTypeSell, models.OrderKindStop, 45, 0),
+			resting:    limitOrder(models.OrderTypeBuy, 44, 1),
+			trigger:    46,
+			wantPrices: []float64{46},
+			wantStatus: models.OrderStatusPending,
+			wantKind:   models.OrderKindStop,
+		},
+		{
+			name:       "a buy stop triggers above its stop price",
+			stop:       stop(models.OrderTypeBuy, models.OrderKindStop, 55, 0),
+			resting:    limitOrder(models.OrderTypeSell, 56, 1),
+			trigger:    55.5,
+			wantPrices: []float64{55.5, 56},
+			wantStatus: models.OrderStatusCompleted,
+			wantKind:   models.OrderKindMarket,
+		},
+		{
+			name:       "a buy stop stays pending below its stop price",
+			stop:       stop(models.OrderTypeBuy, models.OrderKindStop, 55, 0),
+			resting:    limitOrder(models.OrderTypeSell, 56, 1),
+			trigger:    54,
+			wantPrices: []float64{54},
+			wantStatus: models.OrderStatusPending,
+			wantKind:   models.OrderKindStop,
+		},
+		{
+			name:       "a triggered stop-limit rests at its limit price",
+			stop:       stop(models.OrderTypeSell, models.OrderKindStopLimit, 45, 46),
+			resting:    limitOrder(models.OrderTypeBuy, 44, 1),
+			trigger:    45,
+			wantPrices: []float64{45},
+			wantStatus: models.OrderStatusOpen,
+			wantKind:   models.OrderKindLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			stopper := testUser(t, s, "stopper", "BG", 10000, 100)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+			placed := placeOrder(t, s, stopper, tt.stop)
+			if placed.Status != models.OrderStatusPending {
+				t.Fatalf("stop order is %s before any trade, want pending", placed.Status)
+			}
+			placeOrder(t, s, maker, tt.resting)
+
+			// The resting order is not good enough for the trigger trade
+			placeOrder(t, s, maker, limitOrder(opposite(tt.stop.OrderType), tt.trigger, 1))
+			placeOrder(t, s, taker, limitOrder(tt.stop.OrderType, tt.trigger, 1))
+
+			var prices []float64
+			for _, trade := range storedTrades(t, s) {
+				prices = append(prices, trade.PriceEurPerMWh)
+			}
+			if !reflect.DeepEqual(prices, tt.wantPrices) {
+				t.Errorf("traded at %v, want %v", prices, tt.wantPrices)
+			}
+
+			got := storedOrder(t, s, placed.ID)
+			if got.Status != tt.wantStatus || got.OrderKind != tt.wantKind {
+				t.Errorf("stop order is a %s %s order, want a %s %s order", got.Status, got.OrderKind, tt.wantStatus, tt.wantKind)
+			}
+			if triggered := tt.wantStatus != models.OrderStatusPending; (got.TriggeredAt != nil) != triggered {
+				t.Errorf("triggered_at = %v, want it set: %v", got.TriggeredAt, triggered)
+			}
+		})
+	}
+}
+
+func TestConsumeTranche(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	placed := now.Add(-time.Hour)
+	iceberg := func(amount, display, visible float64) models.Order {
+		return models.Order{AmountMWh: amount, DisplayAmountMWh: &display, VisibleAmountMWh: &visible, PriorityAt: placed}
+	}
+
+	tests := []struct {
+		name         string
+		order        models.Order
+		fill         float64
+		wantVisible  *float64
+		wantRefilled bool
+	}{
+		{"an order without a display amount", models.Order{AmountMWh: 5, PriorityAt: placed}, 1, nil, false},
+		{"part of the tranche", iceberg(5, 1, 1), 0.4, ptr(0.6), false},
+		{"the whole tranche shows the next one", iceberg(5, 1, 1), 1, ptr(1.0), true},
+		{"the last tranche is what is left", iceberg(1.5, 1, 1), 1, ptr(0.5), true},
+		{"the whole order", iceberg(1, 1, 1), 1, ptr(0.0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := tt.order
+			refilled := consumeTranche(&order, tt.fill, now)
+			if refilled != tt.wantRefilled {
+				t.Errorf("consumeTranche() = %v, want %v", refilled, tt.wantRefilled)
+			}
+			if !reflect.DeepEqual(order.VisibleAmountMWh, tt.wantVisible) {
+				t.Errorf("visible amount = %v, want %v", order.VisibleAmountMWh, tt.wantVisible)
+			}
+
+			// Only a refill costs the order its time priority
+			wantPriority := placed
+			if tt.wantRefilled {
+				wantPriority = now
+			}
+			if !order.PriorityAt.Equal(wantPriority) {
+				t.Errorf("priority time = %v, want %v", order.PriorityAt, wantPriority)
+			}
+		})
+	}
+}
+
+func TestIcebergRefillLosesPriority(t *testing.T) {
+	display := 1.0
+	iceberg := limitOrder(models.OrderTypeSell, 50, 3)
+	iceberg.DisplayAmountMWh = &display
+
+	tests := []struct {
+		name        string
+		incoming    float64
+		want        []fill
+		wantAmount  float64
+		wantVisible float64
+		wantMoved   bool
+	}{
+		{
+			name:        "part of the tranche keeps the place in the queue",
+			incoming:    0.5,
+			want:        []fill{{0, 0.5, 50}},
+			wantAmount:  2.5,
+			wantVisible: 0.5,
+		},
+		{
+			name:        "the next tranche queues up behind the level",
+			incoming:    1.5,
+			want:        []fill{{0, 1, 50}, {1, 0.5, 50}},
+			wantAmount:  2,
+			wantVisible: 1,
+			wantMoved:   true,
+		},
+		{
+			name:        "the next tranche trades once the level is used up",
+			incoming:    3,
+			want:        []fill{{0, 1, 50}, {1, 1, 50}, {0, 1, 50}},
+			wantAmount:  1,
+			wantVisible: 1,
+			wantMoved:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+			resting := []*models.Order{
+				placeOrder(t, s, maker, iceberg),
+				placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 1)),
+			}
+			incoming := placeOrder(t, s, taker, limitOrder(models.OrderTypeBuy, 50, tt.incoming))
+
+			checkFills(t, s, incoming, resting, tt.want)
+
+			got := storedOrder(t, s, resting[0].ID)
+			if got.AmountMWh != tt.wantAmount || got.VisibleAmountMWh == nil || *got.VisibleAmountMWh != tt.wantVisible {
+				t.Errorf("iceberg has %v MWh left showing %v, want %v showing %v", got.AmountMWh, got.VisibleAmountMWh, tt.wantAmount, tt.wantVisible)
+			}
+			if moved := got.PriorityAt.After(resting[1].PriorityAt); moved != tt.wantMoved {
+				t.Errorf("iceberg queues behind the later order: %v, want %v", moved, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestSTPModeDefaultsToCancelNewest(t *testing.T) {
+	oldest := models.STPCancelOldest
+
+	if got := stpMode(&models.Order{}); got != models.STPCancelNewest {
+		t.Errorf("stpMode() without a mode = %s, want %s", got, models.STPCancelNewest)
+	}
+	if got := stpMode(&models.Order{STPMode: &oldest}); got != oldest {
+		t.Errorf("stpMode() = %s, want %s", got, oldest)
+	}
+}
+
+func TestSelfTradePrevention(t *testing.T) {
+	type orderState struct {
+		status models.OrderStatus
+		amount float64
+		action models.STPMode
+	}
+
+	tests := []struct {
+		name        string
+		mode        models.STPMode
+		accountMode models.STPMode
+		amount      float64
+		want        []fill
+		// incoming and own are the orders of the user trading with itself
+		wantIncoming orderState
+		wantOwn      orderState
+	}{
+		{
+			name:         "cancel_newest cancels the incoming order",
+			mode:         models.STPCancelNewest,
+			amount:       3,
+			want:         []fill{{0, 1, 50}},
+			wantIncoming: orderState{models.OrderStatusCanceled, 2, models.STPCancelNewest},
+			wantOwn:      orderState{models.OrderStatusOpen, 2, ""},
+		},
+		{
+			name:         "cancel_oldest cancels the resting order and matches on",
+			mode:         models.STPCancelOldest,
+			amount:       3,
+			want:         []fill{{0, 1, 50}, {2, 1, 50}},
+			wantIncoming: orderState{models.OrderStatusPartial, 1, ""},
+			wantOwn:      orderState{models.OrderStatusCanceled, 2, models.STPCancelOldest},
+		},
+		{
+			name:         "cancel_both cancels both orders",
+			mode:         models.STPCancelBoth,
+			amount:       3,
+			want:         []fill{{0, 1, 50}},
+			wantIncoming: orderState{models.OrderStatusCanceled, 2, models.STPCancelBoth},
+			wantOwn:      orderState{models.OrderStatusCanceled, 2, models.STPCancelBoth},
+		},
+		{
+			name:         "decrement_and_cancel cancels the smaller resting order",
+			mode:         models.STPDecrementAndCancel,
+			amount:       4,
+			want:         []fill{{0, 1, 50}, {2, 1, 50}},
+			wantIncoming: orderState{models.OrderStatusCompleted, 0, models.STPDecrementAndCancel},
+			wantOwn:      orderState{models.OrderStatusCanceled, 0, models.STPDecrementAndCancel},
+		},
+		{
+			name:         "decrement_and_cancel cancels the smaller incoming order",
+			mode:         models.STPDecrementAndCancel,
+			amount:       2,
+			want:         []fill{{0, 1, 50}},
+			wantIncoming: orderState{models.OrderStatusCanceled, 0, models.STPDecrementAndCancel},
+			wantOwn:      orderState{models.OrderStatusOpen, 1, models.STPDecrementAndCancel},
+		},
+		{
+			name:         "the account mode applies to orders without one",
+			accountMode:  models.STPCancelOldest,
+			amount:       3,
+			want:         []fill{{0, 1, 50}, {2, 1, 50}},
+			wantIncoming: orderState{models.OrderStatusPartial, 1, ""},
+			wantOwn:      orderState{models.OrderStatusCanceled, 2, models.STPCancelOldest},
+		},
+		{
+			name:         "the server default applies without an account mode",
+			amount:       3,
+			want:         []fill{{0, 1, 50}},
+			wantIncoming: orderState{models.OrderStatusCanceled, 2, models.STPCancelNewest},
+			wantOwn:      orderState{models.OrderStatusOpen, 2, ""},
+		},
+	}
+
+	check := func(t *testing.T, s *OrderService, which string, id int, want orderState) {
+		t.Helper()
+
+		got := storedOrder(t, s, id)
+		var action models.STPMode
+		if got.STPAction != nil {
+			action = *got.STPAction
+		}
+		if got.Status != want.status || got.AmountMWh != want.amount || action != want.action {
+			t.Errorf("%s order is %s with %v MWh and stp action %q, want %s with %v MWh and %q",
+				which, got.Status, got.AmountMWh, action, want.status, want.amount, want.action)
+		}
+		wantReason := want.status == models.OrderStatusCanceled
+		if gotReason := got.CancelReason != nil && *got.CancelReason == models.CancelReasonSelfTrade; gotReason != wantReason {
+			t.Errorf("%s order cancel reason = %v, want self trade prevention: %v", which, got.CancelReason, wantReason)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			trader := testUser(t, s, "trader", "BG", 10000, 100)
+			if tt.accountMode != "" {
+				_, err := s.db.Exec("UPDATE users SET stp_mode = $1 WHERE id = $2", tt.accountMode, trader)
+				if err != nil {
+					t.Fatalf("failed to set the account stp mode: %v", err)
+				}
+			}
+
+			// The own order sits between two orders of another user
+			resting := []*models.Order{
+				placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 1)),
+				placeOrder(t, s, trader, limitOrder(models.OrderTypeSell, 50, 2)),
+				placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 1)),
+			}
+			req := limitOrder(models.OrderTypeBuy, 50, tt.amount)
+			req.STPMode = tt.mode
+			incoming := placeOrder(t, s, trader, req)
+
+			checkFills(t, s, incoming, resting, tt.want)
+			check(t, s, "incoming", incoming.ID, tt.wantIncoming)
+			check(t, s, "own resting", resting[1].ID, tt.wantOwn)
+
+			// Whatever was canceled or reduced gave its hold back
+			var reservedEur, reservedMWh float64
+			if tt.wantIncoming.status.Resting() {
+				reservedEur = tt.wantIncoming.amount * 50
+			}
+			if tt.wantOwn.status.Resting() {
+				reservedMWh = tt.wantOwn.amount
+			}
+			balance, err := s.orderRepo.GetUserBalance(trader)
+			if err != nil {
+				t.Fatalf("failed to get the balance: %v", err)
+			}
+			if balance.ReservedEur != reservedEur || balance.ReservedMWh != reservedMWh {
+				t.Errorf("trader reserves %v EUR and %v MWh, want %v and %v", balance.ReservedEur, balance.ReservedMWh, reservedEur, reservedMWh)
+			}
+		})
+	}
+}
+
+func TestRecordFill(t *testing.T) {
+	tests := []struct {
+		name       string
+		filled     float64
+		avg        *float64
+		amount     float64
+		price      float64
+		wantFilled float64
+		wantAvg    float64
+	}{
+		{"the first fill sets the average", 0, nil, 2, 50, 2, 50},
+		{"later fills weigh by amount", 1, ptr(50), 2, 53, 3, 52},
+		{"amounts do not collect floating point dust", 0.1, ptr(40), 0.2, 40, 0.3, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{FilledAmountMWh: tt.filled, AvgFillPrice: tt.avg}
+			recordFill(order, tt.amount, tt.price)
+			if order.FilledAmountMWh != tt.wantFilled || order.AvgFillPrice == nil || *order.AvgFillPrice != tt.wantAvg {
+				t.Errorf("recordFill() = %v MWh at %v, want %v MWh at %v", order.FilledAmountMWh, order.AvgFillPrice, tt.wantFilled, tt.wantAvg)
+			}
+		})
+	}
+}
+
+func TestFillTracking(t *testing.T) {
+	sell := models.OrderTypeSell
+
+	tests := []struct {
+		name       string
+		resting    []models.CreateOrderRequest
+		incoming   models.CreateOrderRequest
+		wantFilled float64
+		wantAvg    *float64
+		wantAmount float64
+		// wantResting is the fill of the first resting order
+		wantResting float64
+	}{
+		{
+			name:        "a fill over several price levels",
+			resting:     []models.CreateOrderRequest{limitOrder(sell, 50, 1), limitOrder(sell, 52, 2)},
+			incoming:    limitOrder(models.OrderTypeBuy, 52, 3),
+			wantFilled:  3,
+			wantAvg:     ptr(51.3333), // stored with four decimals
+			wantResting: 1,
+		},
+		{
+			name:        "a partial fill",
+			resting:     []models.CreateOrderRequest{limitOrder(sell, 50, 1)},
+			incoming:    limitOrder(models.OrderTypeBuy, 50, 3),
+			wantFilled:  1,
+			wantAvg:     ptr(50),
+			wantAmount:  2,
+			wantResting: 1,
+		},
+		{
+			name:        "a resting order filled in part",
+			resting:     []models.CreateOrderRequest{limitOrder(sell, 50, 3)},
+			incoming:    limitOrder(models.OrderTypeBuy, 50, 1),
+			wantFilled:  1,
+			wantAvg:     ptr(50),
+			wantResting: 1,
+		},
+		{
+			name:       "no fill",
+			incoming:   limitOrder(models.OrderTypeBuy, 50, 1),
+			wantAmount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+			var resting []*models.Order
+			for _, req := range tt.resting {
+				resting = append(resting, placeOrder(t, s, maker, req))
+			}
+			incoming := placeOrder(t, s, taker, tt.incoming)
+
+			got := storedOrder(t, s, incoming.ID)
+			if got.FilledAmountMWh != tt.wantFilled || !reflect.DeepEqual(got.AvgFillPrice, tt.wantAvg) {
+				t.Errorf("incoming order filled %v MWh at %v, want %v MWh at %v", got.FilledAmountMWh, got.AvgFillPrice, tt.wantFilled, tt.wantAvg)
+			}
+			if got.AmountMWh != tt.wantAmount || got.OriginalAmountMWh != tt.incoming.AmountMWh {
+				t.Errorf("incoming order has %v of %v MWh left, want %v of %v", got.AmountMWh, got.OriginalAmountMWh, tt.wantAmount, tt.incoming.AmountMWh)
+			}
+
+			if len(resting) > 0 {
+				first := storedOrder(t, s, resting[0].ID)
+				if first.FilledAmountMWh != tt.wantResting || roundAmount(first.FilledAmountMWh+first.AmountMWh) != first.OriginalAmountMWh {
+					t.Errorf("resting order filled %v MWh with %v of %v MWh left, want %v filled", first.FilledAmountMWh, first.AmountMWh, first.OriginalAmountMWh, tt.wantResting)
+				}
+			}
+		})
+	}
+}
+
+func TestAmendPriority(t *testing.T) {
+	amount := func(v float64) models.UpdateOrderRequest { return models.UpdateOrderRequest{AmountMWh: &v} }
+	price := func(v float64) models.UpdateOrderRequest { return models.UpdateOrderRequest{PriceEurPerMWh: &v} }
+
+	tests := []struct {
+		name   string
+		amends []models.UpdateOrderRequest
+		// want is the fill of a buy of 1 MWh after the amends
+		want         []fill
+		wantReserved float64
+	}{
+		{"a smaller amount keeps the priority", []models.UpdateOrderRequest{amount(1)}, []fill{{0, 1, 50}}, 3},
+		{"the same price keeps the priority", []models.UpdateOrderRequest{price(50)}, []fill{{0, 1, 50}}, 4},
+		{"a larger amount loses the priority", []models.UpdateOrderRequest{amount(3)}, []fill{{1, 1, 50}}, 5},
+		{"a new price loses the priority", []models.UpdateOrderRequest{price(51), price(50)}, []fill{{1, 1, 50}}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+			resting := []*models.Order{
+				placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 2)),
+				placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 2)),
+			}
+			for _, req := range tt.amends {
+				_, err := s.UpdateOrder(resting[0].ID, maker, req)
+				if err != nil {
+					t.Fatalf("UpdateOrder() failed: %v", err)
+				}
+			}
+
+			// The hold follows the amended amount
+			balance, err := s.orderRepo.GetUserBalance(maker)
+			if err != nil {
+				t.Fatalf("failed to get the balance: %v", err)
+			}
+			if balance.ReservedMWh != tt.wantReserved {
+				t.Errorf("maker reserves %v MWh, want %v", balance.ReservedMWh, tt.wantReserved)
+			}
+
+			incoming := placeOrder(t, s, taker, limitOrder(models.OrderTypeBuy, 50, 1))
+			checkFills(t, s, incoming, resting, tt.want)
+		})
+	}
+
+	t.Run("a new price that crosses the book trades", func(t *testing.T) {
+		s := testService(t)
+		maker := testUser(t, s, "maker", "BG", 10000, 100)
+		taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+		bid := placeOrder(t, s, taker, limitOrder(models.OrderTypeBuy, 49, 1))
+		ask := placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 2))
+		_, err := s.UpdateOrder(ask.ID, maker, price(48))
+		if err != nil {
+			t.Fatalf("UpdateOrder() failed: %v", err)
+		}
+
+		checkFills(t, s, ask, []*models.Order{bid}, []fill{{0, 1, 49}})
+		if got := storedOrder(t, s, ask.ID); got.Status != models.OrderStatusPartial || got.AmountMWh != 1 {
+			t.Errorf("amended order is %s with %v MWh left, want partially filled with 1", got.Status, got.AmountMWh)
+		}
+	})
+
+	t.Run("an amount within the filled part is rejected", func(t *testing.T) {
+		s := testService(t)
+		maker := testUser(t, s, "maker", "BG", 10000, 100)
+		taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+		ask := placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 2))
+		placeOrder(t, s, taker, limitOrder(models.OrderTypeBuy, 50, 1))
+		if _, err := s.UpdateOrder(ask.ID, maker, amount(1)); err == nil {
+			t.Errorf("UpdateOrder() accepted an amount no larger than the filled one")
+		}
+	})
+
+	t.Run("another user's order is rejected", func(t *testing.T) {
+		s := testService(t)
+		maker := testUser(t, s, "maker", "BG", 10000, 100)
+		taker := testUser(t, s, "taker", "BG", 10000, 100)
+
+		ask := placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 2))
+		if _, err := s.UpdateOrder(ask.ID, taker, price(51)); err == nil {
+			t.Errorf("UpdateOrder() let another user amend the order")
+		}
+	})
+}
+
+func TestCancelOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		// fill is how much of the order trades before it is canceled
+		fill         float64
+		wantAmount   float64
+		wantFilled   float64
+		wantReserved float64
+	}{
+		{"an open order", 0, 2, 0, 0},
+		{"a partially filled order keeps its fills", 1, 1, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			seller := testUser(t, s, "seller", "BG", 0, 10)
+			buyer := testUser(t, s, "buyer", "BG", 10000, 0)
+
+			order := placeOrder(t, s, seller, limitOrder(models.OrderTypeSell, 50, 2))
+			if tt.fill > 0 {
+				placeOrder(t, s, buyer, limitOrder(models.OrderTypeBuy, 50, tt.fill))
+			}
+
+			err := s.CancelOrder(order.ID, seller)
+			if err != nil {
+				t.Fatalf("CancelOrder() failed: %v", err)
+			}
+
+			got := storedOrder(t, s, order.ID)
+			if got.Status != models.OrderStatusCanceled || got.CanceledAt == nil || !reflect.DeepEqual(got.CancelReason, reason(models.CancelReasonUser)) {
+				t.Errorf("order is %s, canceled at %v for %v, want canceled by the user", got.Status, got.CanceledAt, got.CancelReason)
+			}
+			if got.AmountMWh != tt.wantAmount || got.FilledAmountMWh != tt.wantFilled {
+				t.Errorf("order has %v MWh left and %v filled, want %v and %v", got.AmountMWh, got.FilledAmountMWh, tt.wantAmount, tt.wantFilled)
+			}
+			checkBalance(t, s, seller, models.Balance{MoneyEur: tt.fill * 50, EnergyMWh: 10 - tt.fill, ReservedMWh: tt.wantReserved})
+			if got := s.books.Book(nil).Len(); got != 0 {
+				t.Errorf("book holds %d orders after the cancel, want 0", got)
+			}
+
+			// The fills keep pointing at the order
+			var linked int
+			err = s.db.Get(&linked, "SELECT COUNT(*) FROM transactions WHERE order_id = $1", order.ID)
+			if err != nil {
+				t.Fatalf("failed to count transactions: %v", err)
+			}
+			if want := len(storedTrades(t, s)); linked != want {
+				t.Errorf("%d transactions point at the order, want %d", linked, want)
+			}
+
+			canceled, err := s.GetOrdersByUser(seller, models.OrderFilter{Status: models.OrderStatusCanceled})
+			if err != nil {
+				t.Fatalf("GetOrdersByUser() failed: %v", err)
+			}
+			if len(canceled) != 1 || canceled[0].ID != order.ID {
+				t.Errorf("canceled orders of the user = %v, want order %d", canceled, order.ID)
+			}
+
+			// A canceled order cannot be canceled again
+			if err := s.CancelOrder(order.ID, seller); err == nil {
+				t.Errorf("CancelOrder() canceled the order twice")
+			}
+		})
+	}
+
+	t.Run("another user's order is rejected", func(t *testing.T) {
+		s := testService(t)
+		seller := testUser(t, s, "seller", "BG", 0, 10)
+		other := testUser(t, s, "other", "BG", 0, 10)
+
+		order := placeOrder(t, s, seller, limitOrder(models.OrderTypeSell, 50, 2))
+		if err := s.CancelOrder(order.ID, other); err == nil {
+			t.Errorf("CancelOrder() let another user cancel the order")
+		}
+		if got := storedOrder(t, s, order.ID).Status; got != models.OrderStatusOpen {
+			t.Errorf("order is %s, want open", got)
+		}
+	})
+}
+
+func TestPostOnlyPrice(t *testing.T) {
+	cheap := 1
+	s := &OrderService{books: NewProductBooks()}
+	s.books.Load([]models.Order{
+		bookOrder(1, models.OrderTypeBuy, 49, 1),
+		bookOrder(2, models.OrderTypeSell, 50, 1),
+		{ID: 3, OrderType: models.OrderTypeSell, PriceEurPerMWh: 0.01, AmountMWh: 1, ProductID: &cheap},
+	})
+
+	tests := []struct {
+		name      string
+		orderType models.OrderType
+		price     float64
+		reprice   bool
+		productID *int
+		want      float64
+		wantErr   bool
+	}{
+		{"a buy below the best ask", models.OrderTypeBuy, 49.5, false, nil, 49.5, false},
+		{"a buy at the best ask", models.OrderTypeBuy, 50, false, nil, 0, true},
+		{"a sell at the best bid", models.OrderTypeSell, 49, false, nil, 0, true},
+		{"a sell above the best bid", models.OrderTypeSell, 50.5, false, nil, 50.5, false},
+		{"a crossing buy repriced below the best ask", models.OrderTypeBuy, 51, true, nil, 49.99, false},
+		{"a crossing sell repriced above the best bid", models.OrderTypeSell, 48, true, nil, 49.01, false},
+		{"an empty opposite side", models.OrderTypeSell, 10, false, &cheap, 10, false},
+		{"a buy repriced below the minimum price", models.OrderTypeBuy, 1, true, &cheap, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{
+				OrderType:       tt.orderType,
+				PriceEurPerMWh:  tt.price,
+				PostOnly:        true,
+				PostOnlyReprice: tt.reprice,
+				ProductID:       tt.productID,
+			}
+			got, err := s.postOnlyPrice(order)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("postOnlyPrice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("postOnlyPrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostOnlyOrdersNeverTrade(t *testing.T) {
+	postOnly := func(reprice bool) models.CreateOrderRequest {
+		req := limitOrder(models.OrderTypeBuy, 50, 1)
+		req.PostOnly = true
+		req.PostOnlyReprice = reprice
+		return req
+	}
+
+	tests := []struct {
+		name      string
+		incoming  models.CreateOrderRequest
+		wantErr   bool
+		wantPrice float64
+	}{
+		{"a crossing order is rejected", postOnly(false), true, 0},
+		{"a crossing order is repriced to rest", postOnly(true), false, 49.99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			maker := testUser(t, s, "maker", "BG", 10000, 100)
+			taker := testUser(t, s, "taker", "BG", 1000, 0)
+			placeOrder(t, s, maker, limitOrder(models.OrderTypeSell, 50, 1))
+
+			order, err := s.CreateOrder(taker, tt.incoming)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateOrder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if trades := storedTrades(t, s); len(trades) != 0 {
+				t.Errorf("post-only order traded %d times", len(trades))
+			}
+
+			wantBalance := models.Balance{MoneyEur: 1000}
+			if !tt.wantErr {
+				got := storedOrder(t, s, order.ID)
+				if got.Status != models.OrderStatusOpen || got.PriceEurPerMWh != tt.wantPrice {
+					t.Errorf("order is %s at %v, want open at %v", got.Status, got.PriceEurPerMWh, tt.wantPrice)
+				}
+				wantBalance.ReservedEur = tt.wantPrice
+			}
+			checkBalance(t, s, taker, wantBalance)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"my-go-project/models"
+)
+
+// RunPriceIndexWorker publishes the reference price every interval until ctx
+// is canceled. It is meant to run in its own goroutine.
+func (s *OrderService) RunPriceIndexWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := s.PublishPriceIndex(now); err != nil {
+				log.Printf("Failed to publish price index: %v", err)
+			}
+		}
+	}
+}
+
+// PublishPriceIndex appends the reference price in effect from now to
+// price_per_mwh: the volume-weighted average price of the undated market's
+// trades in the PRICE_INDEX_WINDOW before now. Without trades the previous price is carried
+// forward, or PRICE_INDEX_FALLBACK when there is none.
+func (s *OrderService) PublishPriceIndex(now time.Time) (*models.PriceIndex, error) {
+	vwap, volume, count, err := s.orderRepo.GetTradeVWAP(now.Add(-s.cfg.PriceIndexWindow), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade prices: %w", err)
+	}
+
+	price := &models.PriceIndex{
+		PriceEur:      math.Round(vwap*100) / 100,
+		Source:        models.PriceSourceVWAP,
+		VolumeMWh:     volume,
+		TradeCount:    count,
+		EffectiveFrom: now,
+	}
+	if count == 0 || volume <= 0 {
+		price.Source = models.PriceSourceFallback
+		price.PriceEur = s.cfg.PriceIndexFallback
+
+		previous, err := s.orderRepo.GetCurrentPriceIndex(now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get current price: %w", err)
+		}
+		if previous != nil {
+			price.PriceEur = previous.PriceEur
+		}
+	}
+
+	err = s.orderRepo.CreatePriceIndex(price)
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish price index: %w", err)
+	}
+	return price, nil
+}
+
+// GetCurrentPrice returns the reference price in effect now.
+func (s *OrderService) GetCurrentPrice() (*models.PriceIndex, error) {
+	price, err := s.orderRepo.GetCurrentPriceIndex(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if price == nil {
+		return nil, errors.New("no reference price has been published yet")
+	}
+	return price, nil
+}
+
+func (s *OrderService) GetPriceHistory(filter models.PriceHistoryFilter) ([]models.PriceIndex, error) {
+	return s.orderRepo.GetPriceHistory(filter)
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// bandReference is the price the price band of a product is centered on: the
+// last trade price, or for the undated market the published reference price
+// while it has not traded. ok is false when there is neither.
+func (s *OrderService) bandReference(repo *repositories.OrderRepository, productID *int) (price float64, ok bool, err error) {
+	price, ok, err = repo.GetLastTradePrice(productID)
+	if err != nil || ok || productID != nil {
+		return price, ok, err
+	}
+
+	index, err := repo.GetCurrentPriceIndex(time.Now())
+	if err != nil || index == nil {
+		return 0, false, err
+	}
+	return index.PriceEur, true, nil
+}
+
+// priceBand is the lowest and highest price accepted around reference, in
+// whole cents.
+func (s *OrderService) priceBand(reference float64) (low, high float64) {
+	width := reference * s.cfg.PriceBandPct / 100
+	return float64(priceKey(reference-width)) / 100, float64(priceKey(reference+width)) / 100
+}
+
+// currentBand returns the price band of a product, nil for the undated
+// market. ok is false while bands are off or there is no reference price.
+func (s *OrderService) currentBand(repo *repositories.OrderRepository, productID *int) (low, high float64, ok bool, err error) {
+	if s.cfg.PriceBandPct <= 0 {
+		return 0, 0, false, nil
+	}
+
+	reference, ok, err := s.bandReference(repo, productID)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("failed to get reference price: %w", err)
+	}
+	if !ok {
+		return 0, 0, false, nil
+	}
+
+	low, high = s.priceBand(reference)
+	return low, high, true, nil
+}
+
+// clampToBand pulls the protection price of a market order back to the edge
+// of the band when the slippage allowance pushes it past, so the order is
+// judged by the prices it can actually trade at.
+func clampToBand(order *models.Order, low, high float64) {
+	if order.OrderKind != models.OrderKindMarket {
+		return
+	}
+	if order.OrderType == models.OrderTypeBuy && priceKey(order.PriceEurPerMWh) > priceKey(high) {
+		order.PriceEurPerMWh = high
+	}
+	if order.OrderType == models.OrderTypeSell && priceKey(order.PriceEurPerMWh) < priceKey(low) {
+		order.PriceEurPerMWh = low
+	}
+}
+
+func outsideBand(price, low, high float64) bool {
+	return priceKey(price) < priceKey(low) || priceKey(price) > priceKey(high)
+}
+
+// checkPriceBand rejects an order whose price is further than PRICE_BAND_PCT
+// from the band reference of its product. Market orders are clamped into
+// the band first.
+func (s *OrderService) checkPriceBand(repo *repositories.OrderRepository, order *models.Order) error {
+	low, high, ok, err := s.currentBand(repo, order.ProductID)
+	if err != nil || !ok {
+		return err
+	}
+
+	clampToBand(order, low, high)
+	if outsideBand(order.PriceEurPerMWh, low, high) {
+		return fmt.Errorf("price must be within the price band of %.2f to %.2f €/MWh", low, high)
+	}
+	return nil
+}
+
+// checkTriggeredStop applies the price band to a stop order that has just
+// been activated, as the band was not checked while it was pending. A market
+// stop is clamped into the band and its hold shrunk to match, a stop limit
+// priced outside it is canceled. ok is false when the order was canceled.
+func (s *OrderService) checkTriggeredStop(repo *repositories.OrderRepository, order *models.Order, result *matchResult) (bool, error) {
+	low, high, ok, err := s.currentBand(repo, order.ProductID)
+	if err != nil || !ok {
+		return err == nil, err
+	}
+
+	heldEur, heldMWh := orderHold(order)
+	price := order.PriceEurPerMWh
+	clampToBand(order, low, high)
+	if priceKey(price) != priceKey(order.PriceEurPerMWh) {
+		err = repo.UpdateOrder(order.ID, map[string]interface{}{
+			"price_eur_per_mwh": order.PriceEurPerMWh,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to update stop order: %w", err)
+		}
+		err = s.reserveHold(repo, order, heldEur, heldMWh)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if outsideBand(order.PriceEurPerMWh, low, high) {
+		err = s.cancelRemainder(repo, order, models.CancelReasonPriceBand)
+		if err != nil {
+			return false, err
+		}
+		result.changed = append(result.changed, *order)
+		return false, nil
+	}
+	return true, nil
+}
+
+// haltError explains to the sender of an order that trading is halted.
+func haltError(halt *models.TradingHalt) error {
+	if halt.ResumeAt != nil {
+		return fmt.Errorf("trading is halted until %s", halt.ResumeAt.UTC().Format(time.RFC3339))
+	}
+	return errors.New("trading is halted")
+}
+
+// circuitBreaker watches the prices an incoming order trades at. A trade
+// further than CIRCUIT_BREAKER_PCT from the price at the start of the
+// CIRCUIT_BREAKER_WINDOW trips it.
+type circuitBreaker struct {
+	reference float64
+	pct       float64
+	// tripped is the price of the trade that was stopped
+	tripped *float64
+}
+
+// newCircuitBreaker returns the breaker for an order in productID, nil when
+// circuit breakers are off or the product has not traded yet.
+func (s *OrderService) newCircuitBreaker(repo *repositories.OrderRepository, productID *int, now time.Time) (*circuitBreaker, error) {
+	if s.cfg.CircuitBreakerPct <= 0 {
+		return nil, nil
+	}
+
+	reference, ok, err := repo.GetReferenceTradePrice(productID, now.Add(-s.cfg.CircuitBreakerWindow))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get circuit breaker reference price: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &circuitBreaker{reference: reference, pct: s.cfg.CircuitBreakerPct}, nil
+}
+
+// allows reports whether a trade at price keeps within the breaker's limit.
+func (b *circuitBreaker) allows(price float64) bool {
+	if b == nil {
+		return true
+	}
+	width := b.reference * b.pct / 100
+	return priceKey(price) >= priceKey(b.reference-width) && priceKey(price) <= priceKey(b.reference+width)
+}
+
+// trip records that a trade at price was stopped.
+func (b *circuitBreaker) trip(price float64) {
+	b.tripped = &price
+}
+
+// haltTrading halts a product for CIRCUIT_BREAKER_COOLDOWN after its circuit
+// breaker tripped.
+func (s *OrderService) haltTrading(repo *repositories.OrderRepository, productID *int, breaker *circuitBreaker, now time.Time) error {
+	resumeAt := now.Add(s.cfg.CircuitBreakerCooldown)
+	halt := &models.TradingHalt{
+		ProductID:      productID,
+		Reason:         models.HaltReasonCircuitBreaker,
+		ReferencePrice: &breaker.reference,
+		TriggerPrice:   breaker.tripped,
+		HaltedAt:       now,
+		ResumeAt:       &resumeAt,
+	}
+
+	err := repo.CreateTradingHalt(halt)
+	if err != nil {
+		return fmt.Errorf("failed to halt trading: %w", err)
+	}
+	return nil
+}
+
+// GetPriceLimits returns the price band and the halt in force of a product,
+// or of the undated market when filter.ProductID is zero.
+func (s *OrderService) GetPriceLimits(filter models.PriceLimitsFilter) (*models.PriceLimits, error) {
+	productID := productRef(filter.ProductID)
+	limits := &models.PriceLimits{ProductID: productID}
+
+	reference, ok, err := s.bandReference(s.orderRepo, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reference price: %w", err)
+	}
+	if ok {
+		limits.ReferencePrice = &reference
+		if s.cfg.PriceBandPct > 0 {
+			low, high := s.priceBand(reference)
+			limits.BandLow, limits.BandHigh = &low, &high
+		}
+	}
+
+	limits.Halt, err = s.orderRepo.GetActiveHalt(productID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trading halt: %w", err)
+	}
+	return limits, nil
+}
+
+// GetActiveHalts returns the halts in force right now.
+func (s *OrderService) GetActiveHalts() ([]models.TradingHalt, error) {
+	return s.orderRepo.GetActiveHalts(time.Now())
+}
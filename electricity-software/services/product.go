@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// productDaysAhead is how many delivery days, today included, products are
+// listed for.
+const productDaysAhead = 2
+
+// Peakload products deliver from peakStart to peakEnd hours of the day.
+const (
+	peakStart = 8
+	peakEnd   = 20
+)
+
+// RunProductWorker lists upcoming products and closes those whose gate has
+// passed, every interval until ctx is canceled. It is meant to run in its
+// own goroutine.
+func (s *OrderService) RunProductWorker(ctx context.Context, interval time.Duration) {
+	s.runProducts(time.Now())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runProducts(now)
+		}
+	}
+}
+
+func (s *OrderService) runProducts(now time.Time) {
+	if err := s.ScheduleProducts(now); err != nil {
+		log.Printf("Failed to schedule products: %v", err)
+	}
+	if err := s.CloseProducts(now); err != nil {
+		log.Printf("Failed to close products: %v", err)
+	}
+}
+
+// ScheduleProducts makes sure the hourly, 15-minute, daily and weekly
+// products of the coming delivery days exist. Products whose gate has
+// already closed are skipped. Gate closure is PRODUCT_GATE_CLOSURE before
+// the start of delivery, all times are UTC.
+func (s *OrderService) ScheduleProducts(now time.Time) error {
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	var products []models.Product
+	for days := 0; days < productDaysAhead; days++ {
+		day := today.AddDate(0, 0, days)
+		for hour := 0; hour < 24; hour++ {
+			start := day.Add(time.Duration(hour) * time.Hour)
+			products = append(products, s.newProduct(models.ProductTypeHourly, "H-"+start.Format("2006-01-02-15"), start, start.Add(time.Hour)))
+		}
+		for quarter := 0; quarter < 96; quarter++ {
+			start := day.Add(time.Duration(quarter) * 15 * time.Minute)
+			products = append(products, s.newProduct(models.ProductTypeQuarterHourly, "Q-"+start.Format("2006-01-02-15:04"), start, start.Add(15*time.Minute)))
+		}
+		products = append(products,
+			s.newProduct(models.ProductTypeDailyBase, "DB-"+day.Format("2006-01-02"), day, day.AddDate(0, 0, 1)),
+			s.newProduct(models.ProductTypeDailyPeak, "DP-"+day.Format("2006-01-02"), day.Add(peakStart*time.Hour), day.Add(peakEnd*time.Hour)),
+		)
+	}
+
+	// Next week's products, Monday to Sunday
+	monday := today.AddDate(0, 0, (8-int(today.Weekday()))%7)
+	if monday.Equal(today) {
+		monday = monday.AddDate(0, 0, 7)
+	}
+	year, week := monday.ISOWeek()
+	products = append(products,
+		s.newProduct(models.ProductTypeWeeklyBase, fmt.Sprintf("WB-%d-W%02d", year, week), monday, monday.AddDate(0, 0, 7)),
+		s.newProduct(models.ProductTypeWeeklyPeak, fmt.Sprintf("WP-%d-W%02d", year, week), monday.Add(peakStart*time.Hour), monday.AddDate(0, 0, 4).Add(peakEnd*time.Hour)),
+	)
+
+	for i := range products {
+		if !products[i].Trading(now) {
+			continue
+		}
+
+		err := s.orderRepo.EnsureProduct(&products[i])
+		if err != nil {
+			return fmt.Errorf("failed to create product %s: %w", products[i].Code, err)
+		}
+	}
+	return nil
+}
+
+func (s *OrderService) newProduct(productType models.ProductType, code string, start, end time.Time) models.Product {
+	return models.Product{
+		Code:          code,
+		ProductType:   productType,
+		DeliveryStart: start,
+		DeliveryEnd:   end,
+		GateClosureAt: start.Add(-s.cfg.ProductGateClosure),
+	}
+}
+
+// CloseProducts cancels the open and pending orders of every product whose
+// gate has closed. A block order is closed together with its children, which
+// trade in hourly products that close no earlier than its daily one.
+func (s *OrderService) CloseProducts(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var closed []models.Order
+	err := s.withTx(func(repo *repositories.OrderRepository) error {
+		orders, err := repo.LockGateClosedOrders(now)
+		if err != nil {
+			return fmt.Errorf("failed to get orders past gate closure: %w", err)
+		}
+
+		for i := range orders {
+			order := &orders[i]
+			if order.ParentOrderID != nil {
+				continue
+			}
+
+			if order.IsBlock() {
+				legs, err := repo.LockChildOrders(order.ID)
+				if err != nil {
+					return fmt.Errorf("failed to get block orders: %w", err)
+				}
+				err = s.closeBlock(repo, order, orderRefs(legs), models.CancelReasonGate)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			err = s.cancelRemainder(repo, order, models.CancelReasonGate)
+			if err != nil {
+				return err
+			}
+			closed = append(closed, *order)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.syncBook(closed)
+	return nil
+}
+
+// checkProduct makes sure the order's product exists and is still trading.
+func (s *OrderService) checkProduct(repo *repositories.OrderRepository, order *models.Order) error {
+	product, err := repo.GetProductByID(*order.ProductID)
+	if err != nil {
+		return fmt.Errorf("product not found: %w", err)
+	}
+	if !product.Trading(time.Now()) {
+		return errors.New("product gate has closed")
+	}
+	return nil
+}
+
+func (s *OrderService) GetProducts(filter models.ProductFilter) ([]models.Product, error) {
+	return s.orderRepo.GetProducts(filter, time.Now())
+}
+
+func (s *OrderService) GetProductByID(id int) (*models.Product, error) {
+	return s.orderRepo.GetProductByID(id)
+}
+
+// SetProductMatchingAlgorithm changes how fills are shared out in the book of
+// a product from the next match on.
+func (s *OrderService) SetProductMatchingAlgorithm(id int, req models.MatchingAlgorithmRequest) (*models.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var name *string
+	if req.MatchingAlgorithm != "" {
+		if _, err := NewMatchingAlgorithm(req.MatchingAlgorithm); err != nil {
+			return nil, err
+		}
+		name = &req.MatchingAlgorithm
+	}
+
+	err := s.orderRepo.SetProductMatchingAlgorithm(id, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set matching algorithm: %w", err)
+	}
+	return s.orderRepo.GetProductByID(id)
+}
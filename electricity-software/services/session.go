@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// calendarDaysAhead is how many days, today included, the market status
+// looks ahead for state changes.
+const calendarDaysAhead = 8
+
+// maxTransitions is how many upcoming state changes the market status lists.
+const maxTransitions = 6
+
+// marketCalendar is the weekly session schedule, all times UTC, with the
+// holidays of the days it was loaded for.
+type marketCalendar struct {
+	days     map[time.Weekday]models.CalendarDay
+	holidays map[string]bool
+}
+
+// loadCalendar reads the schedule and the holidays from the day of from up to
+// the day of to.
+func (s *OrderService) loadCalendar(repo *repositories.OrderRepository, from, to time.Time) (*marketCalendar, error) {
+	days, err := repo.GetMarketCalendar()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market calendar: %w", err)
+	}
+	holidays, err := repo.GetMarketHolidays(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market holidays: %w", err)
+	}
+
+	calendar := &marketCalendar{days: make(map[time.Weekday]models.CalendarDay), holidays: make(map[string]bool)}
+	for _, day := range days {
+		calendar.days[time.Weekday(day.Weekday)] = day
+	}
+	for _, holiday := range holidays {
+		calendar.holidays[holiday.Date] = true
+	}
+	return calendar, nil
+}
+
+// session returns the session of the day t falls on, nil on a holiday or a
+// weekday without one.
+func (c *marketCalendar) session(t time.Time) *models.MarketSession {
+	day := t.UTC().Truncate(24 * time.Hour)
+	if c.holidays[day.Format("2006-01-02")] {
+		return nil
+	}
+	schedule, ok := c.days[day.Weekday()]
+	if !ok {
+		return nil
+	}
+
+	session := &models.MarketSession{
+		OpenAt:  day.Add(clockOffset(schedule.OpenTime)),
+		CloseAt: day.Add(clockOffset(schedule.CloseTime)),
+	}
+	if schedule.PreOpenTime != nil {
+		preOpenAt := day.Add(clockOffset(*schedule.PreOpenTime))
+		session.PreOpenAt = &preOpenAt
+	}
+	return session
+}
+
+// state is the state the calendar puts the market in at t.
+func (c *marketCalendar) state(t time.Time) models.MarketState {
+	session := c.session(t)
+	switch {
+	case session == nil:
+		return models.MarketStateClosed
+	case !t.Before(session.OpenAt) && t.Before(session.CloseAt):
+		return models.MarketStateOpen
+	case session.PreOpenAt != nil && !t.Before(*session.PreOpenAt) && t.Before(session.OpenAt):
+		return models.MarketStatePreOpen
+	}
+	return models.MarketStateClosed
+}
+
+// clockOffset turns an HH:MM time of day, as the calendar stores it, into the
+// time since midnight.
+func clockOffset(clock string) time.Duration {
+	var hours, minutes int
+	fmt.Sscanf(clock, "%d:%d", &hours, &minutes)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+}
+
+// marketState is the state of the continuous market of a product, nil for
+// the undated market, at now: halted while a halt is in force and otherwise
+// what the calendar says. The halt in force is returned with it.
+func (s *OrderService) marketState(repo *repositories.OrderRepository, productID *int, now time.Time) (models.MarketState, *models.TradingHalt, error) {
+	halt, err := repo.GetActiveHalt(productID, now)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get trading halt: %w", err)
+	}
+	if halt != nil {
+		return models.MarketStateHalted, halt, nil
+	}
+
+	calendar, err := s.loadCalendar(repo, now, now)
+	if err != nil {
+		return "", nil, err
+	}
+	return calendar.state(now), nil, nil
+}
+
+// checkSession rejects orders and amendments the continuous market does not
+// take in its current state: none while it is closed or halted, and during
+// pre-open only those that can wait in the book for the open.
+func (s *OrderService) checkSession(repo *repositories.OrderRepository, order *models.Order) error {
+	state, halt, err := s.marketState(repo, order.ProductID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case models.MarketStateHalted:
+		return haltError(halt)
+	case models.MarketStateClosed:
+		return errors.New("market is closed")
+	case models.MarketStatePreOpen:
+		if !canQueue(order) {
+			return errors.New("only gtc and gtd limit orders and stop orders are taken during pre-open")
+		}
+	}
+	return nil
+}
+
+// canQueue reports whether an order can wait in the book for the market to
+// open: good-till limit orders, and stop orders, which wait for their trigger
+// anyway.
+func canQueue(order *models.Order) bool {
+	if order.Status == models.OrderStatusPending {
+		return true
+	}
+	return order.OrderKind == models.OrderKindLimit &&
+		(order.TimeInForce == models.TimeInForceGTC || order.TimeInForce == models.TimeInForceGTD)
+}
+
+// queueOrder leaves the incoming order in the book unmatched until the
+// market opens.
+func (s *OrderService) queueOrder(repo *repositories.OrderRepository, incoming *models.Order, result *matchResult) error {
+	err := repo.UpdateOrder(incoming.ID, map[string]interface{}{
+		"queued": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to queue order: %w", err)
+	}
+	incoming.Queued = true
+	result.changed = append(result.changed, *incoming)
+	return nil
+}
+
+// RunSessionWorker matches the queued orders of the markets that have opened
+// and tries the resting block orders again every interval until ctx is
+// canceled. It is meant to run in its own goroutine.
+func (s *OrderService) RunSessionWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.MatchQueuedOrders(); err != nil {
+				log.Printf("Failed to match queued orders: %v", err)
+			}
+			if err := s.MatchBlockOrders(); err != nil {
+				log.Printf("Failed to match block orders: %v", err)
+			}
+		}
+	}
+}
+
+// MatchQueuedOrders matches the orders queued while the market was not
+// open, in time priority, like newly placed orders. Orders of markets that
+// are not open stay queued. The state is read again for every order, as one
+// of them may trip the circuit breaker.
+func (s *OrderService) MatchQueuedOrders() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders, err := s.orderRepo.GetQueuedOrders()
+	if err != nil {
+		return fmt.Errorf("failed to get queued orders: %w", err)
+	}
+
+	for _, queued := range orders {
+		state, _, err := s.marketState(s.orderRepo, queued.ProductID, time.Now())
+		if err != nil {
+			return err
+		}
+		if state != models.MarketStateOpen {
+			continue
+		}
+
+		var result matchResult
+		err = s.withTx(func(repo *repositories.OrderRepository) error {
+			order, err := repo.LockOrderByID(queued.ID)
+			if err != nil {
+				return err
+			}
+			if !order.Queued || !order.Status.Resting() {
+				return nil
+			}
+
+			order.Queued = false
+			err = repo.UpdateOrder(order.ID, map[string]interface{}{
+				"queued": false,
+			})
+			if err != nil {
+				return err
+			}
+
+			// Post-only orders never take liquidity, not even at the open
+			if order.PostOnly {
+				return s.restPostOnly(repo, order, &result)
+			}
+
+			err = s.executeOrder(repo, order, &result)
+			if err != nil {
+				return err
+			}
+			if len(result.trades) > 0 {
+				return s.triggerStops(repo, &result, order)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to match queued order %d: %w", queued.ID, err)
+		}
+
+		s.syncBook(result.changed)
+	}
+
+	return nil
+}
+
+// restPostOnly puts a queued post-only order back in the book without
+// matching it. One that crosses the book by now is moved behind it if it
+// allows repricing and canceled otherwise.
+func (s *OrderService) restPostOnly(repo *repositories.OrderRepository, order *models.Order, result *matchResult) error {
+	price, err := s.postOnlyPrice(order)
+	if err != nil {
+		err = s.cancelRemainder(repo, order, models.CancelReasonPostOnly)
+		if err != nil {
+			return err
+		}
+		result.changed = append(result.changed, *order)
+		return nil
+	}
+
+	if priceKey(price) != priceKey(order.PriceEurPerMWh) {
+		heldEur, heldMWh := orderHold(order)
+		order.PriceEurPerMWh = price
+		order.PriorityAt = time.Now()
+		err = repo.UpdateOrder(order.ID, map[string]interface{}{
+			"price_eur_per_mwh": order.PriceEurPerMWh,
+			"priority_at":       order.PriorityAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to reprice post-only order: %w", err)
+		}
+		err = s.reserveHold(repo, order, heldEur, heldMWh)
+		if err != nil {
+			return err
+		}
+	}
+	result.changed = append(result.changed, *order)
+	return nil
+}
+
+// GetMarketStatus returns the state of a product, or of the undated market
+// when filter.ProductID is zero, with the upcoming state changes from the
+// calendar, the product's gate closure and the end of a halt.
+func (s *OrderService) GetMarketStatus(filter models.MarketStatusFilter) (*models.MarketStatus, error) {
+	now := time.Now()
+	productID := productRef(filter.ProductID)
+
+	var product *models.Product
+	if productID != nil {
+		var err error
+		product, err = s.orderRepo.GetProductByID(*productID)
+		if err != nil {
+			return nil, fmt.Errorf("product not found: %w", err)
+		}
+	}
+
+	calendar, err := s.loadCalendar(s.orderRepo, now, now.AddDate(0, 0, calendarDaysAhead))
+	if err != nil {
+		return nil, err
+	}
+	halt, err := s.orderRepo.GetActiveHalt(productID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trading halt: %w", err)
+	}
+
+	stateAt := func(t time.Time) models.MarketState {
+		if halt != nil && (halt.ResumeAt == nil || t.Before(*halt.ResumeAt)) {
+			return models.MarketStateHalted
+		}
+		if product != nil && !product.Trading(t) {
+			return models.MarketStateClosed
+		}
+		return calendar.state(t)
+	}
+
+	status := &models.MarketStatus{
+		ProductID:   productID,
+		State:       stateAt(now),
+		Halt:        halt,
+		Transitions: []models.MarketTransition{},
+	}
+
+	// Every point the state may change at, the session in progress or the
+	// next one is the first that has not closed yet
+	var changes []time.Time
+	for days := 0; days < calendarDaysAhead; days++ {
+		session := calendar.session(now.AddDate(0, 0, days))
+		if session == nil {
+			continue
+		}
+		if status.Session == nil && session.CloseAt.After(now) {
+			status.Session = session
+		}
+		if session.PreOpenAt != nil {
+			changes = append(changes, *session.PreOpenAt)
+		}
+		changes = append(changes, session.OpenAt, session.CloseAt)
+	}
+	if halt != nil && halt.ResumeAt != nil {
+		changes = append(changes, *halt.ResumeAt)
+	}
+	if product != nil {
+		changes = append(changes, product.GateClosureAt)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Before(changes[j]) })
+
+	state := status.State
+	for _, at := range changes {
+		if len(status.Transitions) == maxTransitions {
+			break
+		}
+		if !at.After(now) {
+			continue
+		}
+		if next := stateAt(at); next != state {
+			status.Transitions = append(status.Transitions, models.MarketTransition{State: next, At: at})
+			state = next
+		}
+	}
+	return status, nil
+}
+
+// GetMarketCalendar returns the weekly schedule and the holidays of the
+// coming year.
+func (s *OrderService) GetMarketCalendar() (*models.MarketCalendar, error) {
+	now := time.Now()
+
+	days, err := s.orderRepo.GetMarketCalendar()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market calendar: %w", err)
+	}
+	holidays, err := s.orderRepo.GetMarketHolidays(now, now.AddDate(1, 0, 0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market holidays: %w", err)
+	}
+	return &models.MarketCalendar{Days: days, Holidays: holidays}, nil
+}
+
+// HaltTrading halts a product, or the undated market, on behalf of an
+// operator. Orders are rejected until ResumeAt or until the halt is resumed.
+func (s *OrderService) HaltTrading(userID int, req models.HaltRequest) (*models.TradingHalt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if req.ProductID != nil {
+		if _, err := s.orderRepo.GetProductByID(*req.ProductID); err != nil {
+			return nil, fmt.Errorf("product not found: %w", err)
+		}
+	}
+	if req.ResumeAt != nil && !req.ResumeAt.After(now) {
+		return nil, errors.New("resume_at must be in the future")
+	}
+
+	halt := &models.TradingHalt{
+		ProductID: req.ProductID,
+		Reason:    models.HaltReasonOperator,
+		HaltedAt:  now,
+		ResumeAt:  req.ResumeAt,
+		HaltedBy:  &userID,
+	}
+	if req.Note != "" {
+		halt.Note = &req.Note
+	}
+
+	err := s.orderRepo.CreateTradingHalt(halt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to halt trading: %w", err)
+	}
+	return halt, nil
+}
+
+// ResumeTrading ends a halt early on behalf of an operator, whatever halted
+// the product.
+func (s *OrderService) ResumeTrading(userID, haltID int) (*models.TradingHalt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var halt *models.TradingHalt
+	err := s.withTx(func(repo *repositories.OrderRepository) error {
+		var err error
+		halt, err = repo.LockTradingHalt(haltID)
+		if err != nil {
+			return fmt.Errorf("halt not found: %w", err)
+		}
+
+		now := time.Now()
+		if halt.ResumedAt != nil || (halt.ResumeAt != nil && !halt.ResumeAt.After(now)) {
+			return errors.New("halt has already ended")
+		}
+
+		err = repo.ResumeTradingHalt(halt.ID, userID, now)
+		if err != nil {
+			return fmt.Errorf("failed to resume trading: %w", err)
+		}
+		halt.ResumedAt = &now
+		halt.ResumedBy = &userID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return halt, nil
+}
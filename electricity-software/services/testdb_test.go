@@ -0,0 +1,189 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"my-go-project/config"
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// The behaviour tests of the order service run against the PostgreSQL
+// database in TEST_DATABASE_URL and are skipped without one. The migrations
+// are applied once and every test starts from empty tables.
+
+var (
+	migrateOnce sync.Once
+	migrateErr  error
+)
+
+// resetQuery empties every table the tests write to. The bidding zones, the
+// capacity between them and the market calendar seeded by the migrations
+// are kept.
+const resetQuery = `
+	TRUNCATE users, trades, transactions, auctions, candles, trading_halts, market_holidays RESTART IDENTITY CASCADE;
+	DELETE FROM transmission_capacities WHERE product_id IS NOT NULL;
+	UPDATE transmission_capacities SET remaining_mwh = capacity_mwh;
+	DELETE FROM products;`
+
+func testConfig() *config.Config {
+	return &config.Config{
+		MarketMaxSlippagePct: 5,
+		DefaultSTPMode:       string(models.STPCancelNewest),
+		MatchingAlgorithm:    "fifo",
+		LotSizeMWh:           0.1,
+		ProductGateClosure:   time.Hour,
+		DefaultZone:          "BG",
+		PriceIndexFallback:   100,
+	}
+}
+
+// migrate applies the migrations in the order of their numbers. The psql
+// commands of the first one that create and open the database are left out,
+// the test database already exists.
+func migrate(db *sqlx.DB) error {
+	files, err := filepath.Glob(filepath.Join("..", "migrations", "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var lines []string
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(line, `\`) || strings.HasPrefix(line, "CREATE DATABASE") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+
+		_, err = db.Exec(strings.Join(lines, "\n"))
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+// testService returns an order service on the emptied test database.
+func testService(t *testing.T) *OrderService {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrateOnce.Do(func() { migrateErr = migrate(db) })
+	if migrateErr != nil {
+		t.Fatalf("failed to migrate the test database: %v", migrateErr)
+	}
+
+	_, err = db.Exec(resetQuery)
+	if err != nil {
+		t.Fatalf("failed to empty the test database: %v", err)
+	}
+	return NewOrderService(repositories.NewOrderRepository(db), db, testConfig())
+}
+
+// testUser creates a user in the bidding zone with the given code holding
+// moneyEur and energyMWh.
+func testUser(t *testing.T, s *OrderService, name, zone string, moneyEur, energyMWh float64) int {
+	t.Helper()
+
+	var id int
+	err := s.db.Get(&id, `
+		INSERT INTO users (name, email, password_hash, zone_id)
+		SELECT $1, $1 || '@example.com', '-', id FROM bidding_zones WHERE code = $2
+		RETURNING id`, name, zone)
+	if err != nil {
+		t.Fatalf("failed to create user %s: %v", name, err)
+	}
+
+	_, err = s.db.Exec("INSERT INTO user_money (user_id, money_eur) VALUES ($1, $2)", id, moneyEur)
+	if err == nil {
+		_, err = s.db.Exec("INSERT INTO user_energy (user_id, energy_mwh) VALUES ($1, $2)", id, energyMWh)
+	}
+	if err != nil {
+		t.Fatalf("failed to create the balance of user %s: %v", name, err)
+	}
+	return id
+}
+
+func limitOrder(orderType models.OrderType, price, amount float64) models.CreateOrderRequest {
+	return models.CreateOrderRequest{OrderType: orderType, PriceEurPerMWh: price, AmountMWh: amount}
+}
+
+// placeOrder places an order and fails the test if it is rejected.
+func placeOrder(t *testing.T, s *OrderService, userID int, req models.CreateOrderRequest) *models.Order {
+	t.Helper()
+
+	order, err := s.CreateOrder(userID, req)
+	if err != nil {
+		t.Fatalf("CreateOrder(%+v) failed: %v", req, err)
+	}
+	return order
+}
+
+// storedOrder reads an order back from the database.
+func storedOrder(t *testing.T, s *OrderService, id int) *models.Order {
+	t.Helper()
+
+	order, err := s.orderRepo.GetOrderByID(id)
+	if err != nil {
+		t.Fatalf("failed to get order %d: %v", id, err)
+	}
+	return order
+}
+
+// storedTrades returns every trade in the order it was made.
+func storedTrades(t *testing.T, s *OrderService) []models.Trade {
+	t.Helper()
+
+	var trades []models.Trade
+	err := s.db.Select(&trades, "SELECT * FROM trades ORDER BY id ASC")
+	if err != nil {
+		t.Fatalf("failed to get trades: %v", err)
+	}
+	return trades
+}
+
+// checkBalance compares the stored balance of a user with want, leaving out
+// the available amounts.
+func checkBalance(t *testing.T, s *OrderService, userID int, want models.Balance) {
+	t.Helper()
+
+	got, err := s.orderRepo.GetUserBalance(userID)
+	if err != nil {
+		t.Fatalf("failed to get the balance of user %d: %v", userID, err)
+	}
+	if got.MoneyEur != want.MoneyEur || got.ReservedEur != want.ReservedEur ||
+		got.EnergyMWh != want.EnergyMWh || got.ReservedMWh != want.ReservedMWh {
+		t.Errorf("balance of user %d = %+v, want %+v", userID, *got, want)
+	}
+}
+
+func reason(r models.CancelReason) *models.CancelReason {
+	return &r
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"my-go-project/models"
+	"my-go-project/repositories"
+)
+
+// sameZone reports whether two orders are in the same bidding zone. Orders
+// without a zone trade with everyone.
+func sameZone(a, b *models.Order) bool {
+	return a.ZoneID == nil || b.ZoneID == nil || *a.ZoneID == *b.ZoneID
+}
+
+// zoneCapacity keeps track of the transmission capacity an incoming order may
+// still use to trade with resting orders in other zones. Energy always flows
+// from the seller's zone into the buyer's.
+type zoneCapacity struct {
+	incoming *models.Order
+	lotMWh   float64
+	// remaining capacity by the zone of the resting order
+	remaining map[int]float64
+}
+
+func newZoneCapacity(incoming *models.Order, lotMWh float64) *zoneCapacity {
+	return &zoneCapacity{incoming: incoming, lotMWh: lotMWh, remaining: make(map[int]float64)}
+}
+
+func (c *zoneCapacity) path(resting *models.Order) (fromZoneID, toZoneID int) {
+	if c.incoming.OrderType == models.OrderTypeBuy {
+		return *resting.ZoneID, *c.incoming.ZoneID
+	}
+	return *c.incoming.ZoneID, *resting.ZoneID
+}
+
+// limit caps a trade of amountMWh with resting to the capacity left between
+// their zones, in whole lots. The capacity is locked through repo the first
+// time a zone comes up. Zones that are not connected cannot trade at all.
+func (c *zoneCapacity) limit(repo *repositories.OrderRepository, resting *models.Order, amountMWh float64) (float64, error) {
+	if sameZone(c.incoming, resting) {
+		return amountMWh, nil
+	}
+
+	remaining, ok := c.remaining[*resting.ZoneID]
+	if !ok {
+		from, to := c.path(resting)
+		capacity, err := repo.LockTransmissionCapacity(from, to, c.incoming.ProductID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get transmission capacity: %w", err)
+		}
+		if capacity != nil {
+			remaining = capacity.RemainingMWh
+		}
+		c.remaining[*resting.ZoneID] = remaining
+	}
+	return math.Min(amountMWh, floorToLot(remaining, c.lotMWh)), nil
+}
+
+// take counts a trade of amountMWh with resting against the capacity without
+// writing it.
+func (c *zoneCapacity) take(resting *models.Order, amountMWh float64) {
+	if !sameZone(c.incoming, resting) {
+		c.remaining[*resting.ZoneID] = roundAmount(c.remaining[*resting.ZoneID] - amountMWh)
+	}
+}
+
+// use takes a trade of amountMWh with resting off the capacity between their
+// zones. limit must have been called for resting first.
+func (c *zoneCapacity) use(repo *repositories.OrderRepository, resting *models.Order, amountMWh float64) error {
+	if sameZone(c.incoming, resting) {
+		return nil
+	}
+
+	from, to := c.path(resting)
+	err := repo.UseTransmissionCapacity(from, to, c.incoming.ProductID, amountMWh)
+	if err != nil {
+		return fmt.Errorf("failed to use transmission capacity: %w", err)
+	}
+	c.take(resting, amountMWh)
+	return nil
+}
+
+// GetZonePrices returns the bidding zones with the last price paid for
+// energy delivered into each, for a product or the undated market, or with
+// their clearing prices in a delivery period of an auction.
+func (s *OrderService) GetZonePrices(filter models.ZoneFilter) ([]models.ZonePrice, error) {
+	if filter.AuctionID != 0 {
+		return s.orderRepo.GetAuctionZonePrices(filter.AuctionID, filter.DeliveryPeriod)
+	}
+	return s.orderRepo.GetZonePrices(productRef(filter.ProductID))
+}
+
+// GetTransmissionCapacities returns the capacity left between the zones for
+// a product or the undated market, or what a delivery period of an auction
+// left of it.
+func (s *OrderService) GetTransmissionCapacities(filter models.ZoneFilter) ([]models.TransmissionCapacity, error) {
+	if filter.AuctionID != 0 {
+		return s.orderRepo.GetAuctionCapacities(filter.AuctionID, filter.DeliveryPeriod)
+	}
+	return s.orderRepo.GetTransmissionCapacities(productRef(filter.ProductID))
+}
+
+// productRef turns a product_id query parameter into a product reference,
+// zero meaning the undated market.
+func productRef(productID int) *int {
+	if productID == 0 {
+		return nil
+	}
+	return &productID
+}
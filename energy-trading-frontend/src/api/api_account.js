@@ -170,5 +170,32 @@ export const statisticsAPI = {
   }
 };
 
+// Market data API functions, public and built from the executed trades
+export const marketAPI = {
+  // Get last price, best bid/ask and 24h volume, high, low and change
+  getTicker: async (params = {}) => {
+    const response = await api.get('/market/ticker', { params });
+    return response.data;
+  },
+
+  // Get OHLCV candles, interval is one of 1m, 15m, 1h, 1d
+  getCandles: async (params = {}) => {
+    const response = await api.get('/market/candles', { params });
+    return response.data;
+  },
+
+  // Get aggregated bid and ask levels
+  getDepth: async (params = {}) => {
+    const response = await api.get('/market/depth', { params });
+    return response.data;
+  },
+
+  // Get the session state (open, pre_open, closed, halted) and upcoming transitions
+  getStatus: async (params = {}) => {
+    const response = await api.get('/market/status', { params });
+    return response.data;
+  }
+};
+
 // Export the base api instance for custom requests
 export default api;
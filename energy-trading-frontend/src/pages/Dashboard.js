@@ -344,7 +344,7 @@ const Dashboard = () => {
                             Sell Order
                           </Typography>
                           <Typography variant="caption" color="text.secondary">
-                            by {order.user_name}
+                            by {order.user_name || 'anonymous seller'}
                           </Typography>
                         </Box>
                         <Typography variant="h6" color="primary" gutterBottom>
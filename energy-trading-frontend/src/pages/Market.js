@@ -41,12 +41,28 @@ import {
   TrendingDown
 } from '@mui/icons-material';
 import { useNavigate } from 'react-router-dom';
-import { ordersAPI } from '../api/api_account';
+import { ordersAPI, marketAPI } from '../api/api_account';
+
+const sessionLabels = {
+  open: 'Open',
+  pre_open: 'Pre-open',
+  closed: 'Closed',
+  halted: 'Halted'
+};
+
+const sessionColors = {
+  open: 'success',
+  pre_open: 'info',
+  closed: 'default',
+  halted: 'error'
+};
 
 const Market = () => {
   const token = localStorage.getItem('token');
 
   const [marketOrders, setMarketOrders] = useState([]);
+  const [ticker, setTicker] = useState(null);
+  const [marketStatus, setMarketStatus] = useState(null);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState(null);
   const [sortBy, setSortBy] = useState('price');
@@ -65,6 +81,12 @@ const Market = () => {
     try {
       setLoading(true);
       const response = await ordersAPI.getSellOrders();
+      marketAPI.getTicker()
+        .then(setTicker)
+        .catch(tickerError => console.error('Ticker error:', tickerError));
+      marketAPI.getStatus()
+        .then(setMarketStatus)
+        .catch(statusError => console.error('Market status error:', statusError));
       // Filter out user's own orders from market view (only if user is logged in)
       if (token) {
         try {
@@ -187,9 +209,23 @@ const Market = () => {
 
       {/* Header */}
       <Box display="flex" justifyContent="space-between" alignItems="center" mb={3}>
-        <Typography variant="h4" component="h1" gutterBottom>
-          Energy Market
-        </Typography>
+        <Box display="flex" alignItems="center" gap={2}>
+          <Typography variant="h4" component="h1" gutterBottom>
+            Energy Market
+          </Typography>
+          {marketStatus && (
+            <Tooltip
+              title={marketStatus.transitions.length > 0
+                ? `${sessionLabels[marketStatus.transitions[0].state]} at ${new Date(marketStatus.transitions[0].at).toLocaleString()}`
+                : ''}
+            >
+              <Chip
+                label={sessionLabels[marketStatus.state] || marketStatus.state}
+                color={sessionColors[marketStatus.state] || 'default'}
+              />
+            </Tooltip>
+          )}
+        </Box>
         <Button
           variant="outlined"
           startIcon={<Refresh />}
@@ -199,6 +235,68 @@ const Market = () => {
         </Button>
       </Box>
 
+      {/* 24h Ticker */}
+      {ticker && (
+        <Grid container spacing={3} mb={3}>
+          <Grid item xs={12} sm={6} md={3}>
+            <Card>
+              <CardContent>
+                <Typography color="textSecondary" gutterBottom>
+                  Last Price
+                </Typography>
+                <Typography variant="h4" component="h2">
+                  {ticker.last_price != null ? formatCurrency(ticker.last_price) : '-'}
+                </Typography>
+                {ticker.change_pct_24h != null && (
+                  <Chip
+                    size="small"
+                    icon={ticker.change_24h >= 0 ? <TrendingUp /> : <TrendingDown />}
+                    color={ticker.change_24h >= 0 ? 'success' : 'error'}
+                    label={`${ticker.change_24h >= 0 ? '+' : ''}${ticker.change_pct_24h}% (24h)`}
+                  />
+                )}
+              </CardContent>
+            </Card>
+          </Grid>
+          <Grid item xs={12} sm={6} md={3}>
+            <Card>
+              <CardContent>
+                <Typography color="textSecondary" gutterBottom>
+                  Best Bid / Ask
+                </Typography>
+                <Typography variant="h6" component="h2">
+                  {ticker.best_bid != null ? formatCurrency(ticker.best_bid) : '-'} / {ticker.best_ask != null ? formatCurrency(ticker.best_ask) : '-'}
+                </Typography>
+              </CardContent>
+            </Card>
+          </Grid>
+          <Grid item xs={12} sm={6} md={3}>
+            <Card>
+              <CardContent>
+                <Typography color="textSecondary" gutterBottom>
+                  24h Volume
+                </Typography>
+                <Typography variant="h4" component="h2">
+                  {formatEnergy(ticker.volume_24h_mwh)}
+                </Typography>
+              </CardContent>
+            </Card>
+          </Grid>
+          <Grid item xs={12} sm={6} md={3}>
+            <Card>
+              <CardContent>
+                <Typography color="textSecondary" gutterBottom>
+                  24h Low - High
+                </Typography>
+                <Typography variant="h6" component="h2">
+                  {ticker.low_24h != null ? `${formatCurrency(ticker.low_24h)} - ${formatCurrency(ticker.high_24h)}` : '-'}
+                </Typography>
+              </CardContent>
+            </Card>
+          </Grid>
+        </Grid>
+      )}
+
       {/* Market Statistics */}
       {stats && (
         <Grid container spacing={3} mb={3}>
@@ -370,7 +468,7 @@ const Market = () => {
                         <Box display="flex" alignItems="center" gap={1}>
                           <Person color="action" />
                           <Typography variant="body2">
-                            {order.user_name}
+                            {order.user_name || 'Anonymous seller'}
                           </Typography>
                         </Box>
                       </TableCell>
@@ -443,7 +541,7 @@ const Market = () => {
                         <Box display="flex" alignItems="center" gap={1}>
                           <TrendingUp color="error" fontSize="small" />
                           <Typography variant="body1">
-                            {order.user_name} listed {formatEnergy(order.amount_mwh)} for sale
+                            {order.user_name || 'A seller'} listed {formatEnergy(order.amount_mwh)} for sale
                           </Typography>
                         </Box>
                       }
@@ -52,7 +52,7 @@ const OrderDetail = () => {
       const response = await ordersAPI.getOrder(id);
       setOrder(response);
       setEditForm({
-        amount_mwh: response.amount_mwh,
+        amount_mwh: response.original_amount_mwh,
         price_eur_per_mwh: response.price_eur_per_mwh
       });
       setError(null);
@@ -68,7 +68,7 @@ const OrderDetail = () => {
     setEditMode(true);
     // Ensure edit form is properly initialized
     setEditForm({
-      amount_mwh: order.amount_mwh,
+      amount_mwh: order.original_amount_mwh,
       price_eur_per_mwh: order.price_eur_per_mwh
     });
   };
@@ -78,7 +78,7 @@ const OrderDetail = () => {
       setSaving(true);
       
       const updates = {};
-      if (editForm.amount_mwh !== order.amount_mwh) {
+      if (editForm.amount_mwh !== order.original_amount_mwh) {
         updates.amount_mwh = parseFloat(editForm.amount_mwh);
       }
       if (editForm.price_eur_per_mwh !== order.price_eur_per_mwh) {
@@ -98,7 +98,7 @@ const OrderDetail = () => {
   const handleCancel = () => {
     setEditMode(false);
     setEditForm({
-      amount_mwh: order.amount_mwh,
+      amount_mwh: order.original_amount_mwh,
       price_eur_per_mwh: order.price_eur_per_mwh
     });
   };
@@ -136,6 +136,7 @@ const OrderDetail = () => {
   const getStatusColor = (status) => {
     switch (status) {
       case 'open': return 'primary';
+      case 'partially_filled': return 'info';
       case 'completed': return 'success';
       case 'canceled': return 'error';
       default: return 'default';
@@ -188,15 +189,17 @@ const OrderDetail = () => {
             Order #{order.id}
           </Typography>
         </Box>
-        {order.status === 'open' && !editMode && (
+        {(order.status === 'open' || order.status === 'partially_filled') && !order.parent_order_id && !editMode && (
           <Box display="flex" gap={1}>
-            <Button
-              variant="outlined"
-              startIcon={<Edit />}
-              onClick={handleEdit}
-            >
-              Edit
-            </Button>
+            {!order.block_first_period && (
+              <Button
+                variant="outlined"
+                startIcon={<Edit />}
+                onClick={handleEdit}
+              >
+                Edit
+              </Button>
+            )}
             <Button
               variant="outlined"
               color="error"
@@ -297,6 +300,30 @@ const OrderDetail = () => {
                     </Typography>
                   )}
                 </Grid>
+                {order.block_first_period && (
+                  <Grid item xs={12}>
+                    <Typography variant="body2" color="text.secondary">
+                      Block Periods
+                    </Typography>
+                    <Typography variant="h6">
+                      {order.block_first_period} - {order.block_last_period} (per period)
+                    </Typography>
+                  </Grid>
+                )}
+                {order.parent_order_id && (
+                  <Grid item xs={12}>
+                    <Typography variant="body2" color="text.secondary">
+                      Part of Block Order
+                    </Typography>
+                    <Button
+                      variant="text"
+                      onClick={() => navigate(`/orders/${order.parent_order_id}`)}
+                      sx={{ mt: 1, px: 0 }}
+                    >
+                      Order #{order.parent_order_id}, period {order.delivery_period}
+                    </Button>
+                  </Grid>
+                )}
                 <Grid item xs={12}>
                   <Typography variant="body2" color="text.secondary">
                     Total Value
@@ -350,6 +377,42 @@ const OrderDetail = () => {
             </CardContent>
           </Card>
         </Grid>
+
+        {/* Block Periods */}
+        {order.children && order.children.length > 0 && (
+          <Grid item xs={12}>
+            <Card>
+              <CardContent>
+                <Typography variant="h6" gutterBottom>
+                  Block Periods
+                </Typography>
+                {order.children.map((child) => (
+                  <Box
+                    key={child.id}
+                    display="flex"
+                    justifyContent="space-between"
+                    alignItems="center"
+                    py={1}
+                    sx={{ cursor: 'pointer' }}
+                    onClick={() => navigate(`/orders/${child.id}`)}
+                  >
+                    <Typography variant="body1">
+                      Period {child.delivery_period}
+                    </Typography>
+                    <Typography variant="body2" color="text.secondary">
+                      {formatEnergy(child.filled_amount_mwh)} / {formatEnergy(child.original_amount_mwh)}
+                    </Typography>
+                    <Chip
+                      label={child.status}
+                      color={getStatusColor(child.status)}
+                      size="small"
+                    />
+                  </Box>
+                ))}
+              </CardContent>
+            </Card>
+          </Grid>
+        )}
       </Grid>
 
       {/* Delete Confirmation Dialog */}
@@ -130,6 +130,7 @@ const Orders = () => {
   const getStatusColor = (status) => {
     switch (status) {
       case 'open': return 'primary';
+      case 'partially_filled': return 'info';
       case 'completed': return 'success';
       case 'canceled': return 'error';
       default: return 'default';
@@ -240,6 +241,7 @@ const Orders = () => {
                 >
                   <MenuItem value="">All Statuses</MenuItem>
                   <MenuItem value="open">Open</MenuItem>
+                  <MenuItem value="partially_filled">Partially Filled</MenuItem>
                   <MenuItem value="completed">Completed</MenuItem>
                   <MenuItem value="canceled">Canceled</MenuItem>
                 </Select>
@@ -319,7 +321,7 @@ const Orders = () => {
                               <Visibility />
                             </IconButton>
                           </Tooltip>
-                          {order.status === 'open' && (
+                          {(order.status === 'open' || order.status === 'partially_filled') && (
                             <>
                               <Tooltip title="Edit Order">
                                 <IconButton